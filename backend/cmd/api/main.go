@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os/signal"
+	"syscall"
+
+	"github.com/nesohq/backend/internal/app"
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/tracing"
+)
+
+// Dashboard API: auth, domains, API keys, stats, exports and public badges.
+// It never touches the queue.
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Load config
+	cfg, err := config.Load()
+	if err != nil {
+		logging.Fatal(slog.Default(), "failed to load config", err)
+	}
+
+	// Initialize logging
+	logger := logging.New(cfg.Environment, cfg.LogLevel)
+	slog.SetDefault(logger)
+	if cfg.LiteMode {
+		logging.Fatal(logger, "cannot run the API on its own", app.ErrLiteMode)
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(ctx, cfg.OTLPEndpoint, "krakens-api")
+	if err != nil {
+		logging.Fatal(logger, "failed to set up tracing", err)
+	}
+
+	// Initialize MongoDB
+	mongodb, err := db.NewMongoDB(cfg.MongoDBURI, cfg.MongoDBDatabase)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to MongoDB", err)
+	}
+	if cfg.MigrateOnStart {
+		app.Migrate(ctx, logger, mongodb)
+	}
+
+	// Initialize ClickHouse, if raw events are kept there
+	clickhouse := app.ConnectClickHouse(ctx, logger, cfg)
+
+	// Initialize Redis
+	redisCache, err := cache.NewRedisCache(cfg.RedisURL)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to Redis", err)
+	}
+
+	// Setup router
+	router := app.NewRouter(cfg, logger)
+	app.RegisterAPIRoutes(router, cfg, logger, app.MongoStores(mongodb, clickhouse), redisCache)
+	app.RegisterHealthRoutes(router, mongodb, clickhouse, nil, redisCache, nil)
+
+	// Start server
+	srv := app.NewServer(cfg, router)
+	metricsSrv := app.NewMetricsServer(cfg, app.NewMetricsRouter())
+	if err := app.Serve(ctx, logger, srv, metricsSrv); err != nil {
+		logging.Fatal(logger, "failed to start server", err)
+	}
+	stop()
+
+	app.Shutdown(logger, cfg.ShutdownTimeout,
+		app.ServerShutdown(srv),
+		app.ServerShutdown(metricsSrv),
+		app.CloseStep("redis", redisCache.Close),
+		app.CloseStep("mongodb", mongodb.Close),
+		app.CloseStep("clickhouse", clickhouse.Close),
+		app.ShutdownStep{Name: "tracing", Run: shutdownTracing},
+	)
+}
@@ -0,0 +1,78 @@
+// Command import loads historical Google Analytics or Plausible CSV exports
+// into a domain's daily rollups.
+//
+//	go run ./cmd/import -domain <domain id> -source plausible export.zip
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nesohq/backend/internal/app"
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func main() {
+	domainFlag := flag.String("domain", "", "ID of the domain to import into")
+	sourceFlag := flag.String("source", domain.ImportSourceGoogleAnalytics, "export source: google_analytics or plausible")
+	flag.Parse()
+
+	domainID, err := primitive.ObjectIDFromHex(*domainFlag)
+	if err != nil || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load config:", err)
+	}
+
+	var stores *app.Stores
+	if cfg.LiteMode {
+		database, err := db.NewSQLite(cfg.SQLitePath)
+		if err != nil {
+			log.Fatal("Failed to open SQLite:", err)
+		}
+		defer database.Close()
+		stores = app.SQLiteStores(database)
+	} else {
+		mongodb, err := db.NewMongoDB(cfg.MongoDBURI, cfg.MongoDBDatabase)
+		if err != nil {
+			log.Fatal("Failed to connect to MongoDB:", err)
+		}
+		defer mongodb.Close()
+		stores = app.MongoStores(mongodb, nil)
+	}
+
+	var files []service.ImportFile
+	for _, path := range flag.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal("Failed to read file:", err)
+		}
+		files = append(files, service.ImportFile{Name: filepath.Base(path), Data: data})
+	}
+
+	importService := service.NewImportService(stores.Domains, stores.Rollups)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	result, err := importService.Import(ctx, domainID, *sourceFlag, files)
+	if err != nil {
+		log.Fatal("Import failed:", err)
+	}
+
+	out, _ := json.MarshalIndent(result, "", "  ")
+	log.Printf("Import complete:\n%s", out)
+}
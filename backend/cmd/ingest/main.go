@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os/signal"
+	"syscall"
+
+	"github.com/nesohq/backend/internal/app"
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/infrastructure/queue"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/tracing"
+)
+
+// Ingestion server: validates tracking hits and publishes them to the queue.
+// Nothing is written to MongoDB here; the worker persists what it publishes.
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Load config
+	cfg, err := config.Load()
+	if err != nil {
+		logging.Fatal(slog.Default(), "failed to load config", err)
+	}
+
+	// Initialize logging
+	logger := logging.New(cfg.Environment, cfg.LogLevel)
+	slog.SetDefault(logger)
+	if cfg.LiteMode {
+		logging.Fatal(logger, "cannot run ingestion on its own", app.ErrLiteMode)
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(ctx, cfg.OTLPEndpoint, "krakens-ingest")
+	if err != nil {
+		logging.Fatal(logger, "failed to set up tracing", err)
+	}
+
+	// Initialize MongoDB
+	mongodb, err := db.NewMongoDB(cfg.MongoDBURI, cfg.MongoDBDatabase)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to MongoDB", err)
+	}
+	if cfg.MigrateOnStart {
+		app.Migrate(ctx, logger, mongodb)
+	}
+
+	// Initialize Redis
+	redisCache, err := cache.NewRedisCache(cfg.RedisURL)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to Redis", err)
+	}
+
+	// Initialize NATS
+	natsQueue, err := queue.NewNATSQueue(cfg.NATSURL, logger)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to NATS", err)
+	}
+
+	// Setup router
+	router := app.NewRouter(cfg, logger)
+	app.RegisterIngestRoutes(router, cfg, logger, app.MongoStores(mongodb, nil), redisCache, natsQueue)
+	app.RegisterHealthRoutes(router, mongodb, nil, nil, redisCache, natsQueue)
+
+	// Start server
+	srv := app.NewServer(cfg, router)
+	metricsSrv := app.NewMetricsServer(cfg, app.NewMetricsRouter())
+	if err := app.Serve(ctx, logger, srv, metricsSrv); err != nil {
+		logging.Fatal(logger, "failed to start server", err)
+	}
+	stop()
+
+	// In-flight requests finish publishing before the connection is drained
+	app.Shutdown(logger, cfg.ShutdownTimeout,
+		app.ServerShutdown(srv),
+		app.ServerShutdown(metricsSrv),
+		app.ShutdownStep{Name: "nats", Run: natsQueue.Drain},
+		app.CloseStep("redis", redisCache.Close),
+		app.CloseStep("mongodb", mongodb.Close),
+		app.ShutdownStep{Name: "tracing", Run: shutdownTracing},
+	)
+}
@@ -2,160 +2,147 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"log"
+	"log/slog"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/app"
 	"github.com/nesohq/backend/internal/config"
-	"github.com/nesohq/backend/internal/domain"
-	"github.com/nesohq/backend/internal/handler"
 	"github.com/nesohq/backend/internal/infrastructure/cache"
 	"github.com/nesohq/backend/internal/infrastructure/db"
 	"github.com/nesohq/backend/internal/infrastructure/queue"
-	"github.com/nesohq/backend/internal/middleware"
-	"github.com/nesohq/backend/internal/repository"
-	"github.com/nesohq/backend/internal/service"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/tracing"
 )
 
+// liteQueueSize is how many messages per subject lite mode buffers before
+// tracking requests wait for the workers.
+const liteQueueSize = 10000
+
+// All-in-one server: dashboard API, tracking ingestion and queue workers in a
+// single process. See cmd/api, cmd/ingest and cmd/worker to run them apart.
+// With LITE_MODE it needs nothing else: data is kept in SQLite and the cache
+// and queue live in memory.
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Load config
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal("Failed to load config:", err)
+		logging.Fatal(slog.Default(), "failed to load config", err)
+	}
+
+	// Initialize logging
+	logger := logging.New(cfg.Environment, cfg.LogLevel)
+	slog.SetDefault(logger)
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(ctx, cfg.OTLPEndpoint, "krakens")
+	if err != nil {
+		logging.Fatal(logger, "failed to set up tracing", err)
+	}
+
+	if cfg.LiteMode {
+		runLite(ctx, stop, cfg, logger, shutdownTracing)
+		return
 	}
 
 	// Initialize MongoDB
 	mongodb, err := db.NewMongoDB(cfg.MongoDBURI, cfg.MongoDBDatabase)
 	if err != nil {
-		log.Fatal("Failed to connect to MongoDB:", err)
+		logging.Fatal(logger, "failed to connect to MongoDB", err)
+	}
+	if cfg.MigrateOnStart {
+		app.Migrate(ctx, logger, mongodb)
 	}
-	defer mongodb.Close()
+
+	// Initialize ClickHouse, if raw events are kept there
+	clickhouse := app.ConnectClickHouse(ctx, logger, cfg)
 
 	// Initialize Redis
 	redisCache, err := cache.NewRedisCache(cfg.RedisURL)
 	if err != nil {
-		log.Fatal("Failed to connect to Redis:", err)
+		logging.Fatal(logger, "failed to connect to Redis", err)
 	}
-	defer redisCache.Close()
 
 	// Initialize NATS
-	natsQueue, err := queue.NewNATSQueue(cfg.NATSURL)
+	natsQueue, err := queue.NewNATSQueue(cfg.NATSURL, logger)
 	if err != nil {
-		log.Fatal("Failed to connect to NATS:", err)
+		logging.Fatal(logger, "failed to connect to NATS", err)
 	}
-	defer natsQueue.Close()
-
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(mongodb.Database)
-	domainRepo := repository.NewDomainRepository(mongodb.Database)
-	apiKeyRepo := repository.NewAPIKeyRepository(mongodb.Database)
-	eventRepo := repository.NewEventRepository(mongodb.Database)
-
-	// Initialize services
-	authService := service.NewAuthService(userRepo, cfg.JWTSecret)
-	domainService := service.NewDomainService(domainRepo)
-	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
-	trackingService := service.NewTrackingService(eventRepo, redisCache, natsQueue)
-
-	// Initialize handlers
-	authHandler := handler.NewAuthHandler(authService)
-	domainHandler := handler.NewDomainHandler(domainService)
-	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
-	trackingHandler := handler.NewTrackingHandler(trackingService, apiKeyService)
-	badgeHandler := handler.NewBadgeHandler(trackingService)
-	avatarHandler := handler.NewAvatarHandler()
-
-	// Start event worker
-	go startEventWorker(natsQueue, eventRepo)
-
-	// Setup router
-	router := gin.Default()
-
-	// Tracking endpoint (with permissive CORS - needs to accept requests from any website)
-	router.OPTIONS("/api/track", middleware.TrackingCORSMiddleware())
-	router.POST("/api/track", middleware.TrackingCORSMiddleware(), trackingHandler.Track)
 
-	// Public Assets (Badges, Avatars) - accessible from any origin
-	router.OPTIONS("/api/badges/:domain_id/live.svg", middleware.PublicGetCORSMiddleware())
-	router.GET("/api/badges/:domain_id/live.svg", middleware.PublicGetCORSMiddleware(), badgeHandler.GetLiveBadge)
+	// Start workers
+	stores := app.MongoStores(mongodb, clickhouse)
+	jobsDone := app.StartWorkers(ctx, cfg, logger, stores, redisCache, natsQueue)
 
-	router.OPTIONS("/api/avatars/:seed", middleware.PublicGetCORSMiddleware())
-	router.GET("/api/avatars/:seed", middleware.PublicGetCORSMiddleware(), avatarHandler.GetAvatar)
-
-	// Public routes (with restricted CORS)
-	router.OPTIONS("/api/auth/register", middleware.CORSMiddleware(cfg.FrontendURL))
-	router.OPTIONS("/api/auth/login", middleware.CORSMiddleware(cfg.FrontendURL))
-
-	public := router.Group("/api")
-	public.Use(middleware.CORSMiddleware(cfg.FrontendURL))
-	{
-		public.POST("/auth/register", authHandler.Register)
-		public.POST("/auth/login", authHandler.Login)
-	}
-
-	// Protected routes
-	router.OPTIONS("/api/stats/realtime", middleware.CORSMiddleware(cfg.FrontendURL))
-	router.OPTIONS("/api/stats/overview", middleware.CORSMiddleware(cfg.FrontendURL))
-	router.OPTIONS("/api/domains", middleware.CORSMiddleware(cfg.FrontendURL))
-	router.OPTIONS("/api/domains/:id", middleware.CORSMiddleware(cfg.FrontendURL))
-	router.OPTIONS("/api/api-keys", middleware.CORSMiddleware(cfg.FrontendURL))
-	router.OPTIONS("/api/api-keys/:id", middleware.CORSMiddleware(cfg.FrontendURL))
-
-	protected := router.Group("/api")
-	protected.Use(middleware.CORSMiddleware(cfg.FrontendURL))
-	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
-	{
-		// Domains
-		protected.GET("/domains", domainHandler.List)
-		protected.POST("/domains", domainHandler.Create)
-		protected.GET("/domains/:id", domainHandler.GetByID)
-		protected.PUT("/domains/:id", domainHandler.Update)
-		protected.DELETE("/domains/:id", domainHandler.Delete)
-
-		// API Keys
-		protected.GET("/api-keys", apiKeyHandler.List)
-		protected.POST("/api-keys", apiKeyHandler.Create)
-		protected.DELETE("/api-keys/:id", apiKeyHandler.Revoke)
-
-		// Stats
-		protected.GET("/stats/realtime", trackingHandler.GetRealtimeStats)
-		protected.GET("/stats/overview", trackingHandler.GetOverviewStats)
-	}
-
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	// Setup router
+	router := app.NewRouter(cfg, logger)
+	app.RegisterIngestRoutes(router, cfg, logger, stores, redisCache, natsQueue)
+	app.RegisterAPIRoutes(router, cfg, logger, stores, redisCache)
+	app.RegisterHealthRoutes(router, mongodb, clickhouse, nil, redisCache, natsQueue)
 
 	// Start server
-	addr := fmt.Sprintf(":%s", cfg.Port)
-	log.Printf("Server starting on %s", addr)
-	if err := router.Run(addr); err != nil {
-		log.Fatal("Failed to start server:", err)
+	srv := app.NewServer(cfg, router)
+	metricsSrv := app.NewMetricsServer(cfg, app.NewMetricsRouter())
+	if err := app.Serve(ctx, logger, srv, metricsSrv); err != nil {
+		logging.Fatal(logger, "failed to start server", err)
 	}
+	// A second signal kills the process straight away
+	stop()
+
+	// Stop taking hits first so everything they published reaches the
+	// workers, then let the workers flush before closing their stores
+	app.Shutdown(logger, cfg.ShutdownTimeout,
+		app.ServerShutdown(srv),
+		app.ServerShutdown(metricsSrv),
+		app.ShutdownStep{Name: "nats", Run: natsQueue.Drain},
+		app.WaitStep("background jobs", jobsDone),
+		app.CloseStep("redis", redisCache.Close),
+		app.CloseStep("mongodb", mongodb.Close),
+		app.CloseStep("clickhouse", clickhouse.Close),
+		app.ShutdownStep{Name: "tracing", Run: shutdownTracing},
+	)
 }
 
-func startEventWorker(natsQueue *queue.NATSQueue, eventRepo *repository.EventRepository) {
-	log.Println("Starting event worker...")
+// runLite serves everything from one SQLite file, with the cache and queue in
+// memory. Visitors' active state is lost on restart, as are hits still
+// queued if the process is killed rather than stopped.
+func runLite(ctx context.Context, stop context.CancelFunc, cfg *config.Config, logger *slog.Logger, shutdownTracing func(context.Context) error) {
+	logger.Info("starting in lite mode", "sqlite_path", cfg.SQLitePath)
 
-	_, err := natsQueue.Subscribe("events", func(data []byte) {
-		var event domain.Event
-		if err := json.Unmarshal(data, &event); err != nil {
-			log.Printf("Failed to unmarshal event: %v", err)
-			return
-		}
+	sqlite := app.OpenSQLite(ctx, logger, cfg)
+	stores := app.SQLiteStores(sqlite)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	memoryCache := cache.NewMemoryCache()
+	go app.SweepCache(ctx, memoryCache, time.Minute)
 
-		if err := eventRepo.Create(ctx, &event); err != nil {
-			log.Printf("Failed to save event: %v", err)
-		}
-	})
+	channelQueue := queue.NewChannelQueue(logger, liteQueueSize)
 
-	if err != nil {
-		log.Fatal("Failed to subscribe to events:", err)
+	// Start workers
+	jobsDone := app.StartWorkers(ctx, cfg, logger, stores, memoryCache, channelQueue)
+
+	// Setup router
+	router := app.NewRouter(cfg, logger)
+	app.RegisterIngestRoutes(router, cfg, logger, stores, memoryCache, channelQueue)
+	app.RegisterAPIRoutes(router, cfg, logger, stores, memoryCache)
+	app.RegisterHealthRoutes(router, nil, nil, sqlite, nil, nil)
+
+	// Start server
+	srv := app.NewServer(cfg, router)
+	metricsSrv := app.NewMetricsServer(cfg, app.NewMetricsRouter())
+	if err := app.Serve(ctx, logger, srv, metricsSrv); err != nil {
+		logging.Fatal(logger, "failed to start server", err)
 	}
+	stop()
+
+	app.Shutdown(logger, cfg.ShutdownTimeout,
+		app.ServerShutdown(srv),
+		app.ServerShutdown(metricsSrv),
+		app.ShutdownStep{Name: "queue", Run: channelQueue.Drain},
+		app.WaitStep("background jobs", jobsDone),
+		app.CloseStep("sqlite", sqlite.Close),
+		app.ShutdownStep{Name: "tracing", Run: shutdownTracing},
+	)
 }
@@ -0,0 +1,112 @@
+// Command migrate applies MongoDB schema migrations or reports their status.
+// In lite mode it does the same for the SQLite database.
+//
+//	go run ./cmd/migrate [up|status]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/migrations"
+	"github.com/nesohq/backend/internal/repository/sqlite"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: migrate [up|status]")
+	}
+	flag.Parse()
+
+	command := "up"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+	if flag.NArg() > 1 || (command != "up" && command != "status") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load()
+	if err != nil {
+		logging.Fatal(slog.Default(), "failed to load config", err)
+	}
+
+	logger := logging.New(cfg.Environment, cfg.LogLevel)
+
+	if cfg.LiteMode {
+		migrateSQLite(ctx, logger, cfg, command)
+		return
+	}
+
+	mongodb, err := db.NewMongoDB(cfg.MongoDBURI, cfg.MongoDBDatabase)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to MongoDB", err)
+	}
+	defer mongodb.Close()
+
+	// Index builds on large collections can take a while
+	ctx, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+
+	switch command {
+	case "up":
+		if err := migrations.Up(ctx, mongodb.Database, logger); err != nil {
+			logging.Fatal(logger, "migration failed", err)
+		}
+		logger.Info("database is up to date")
+	case "status":
+		statuses, err := migrations.List(ctx, mongodb.Database)
+		if err != nil {
+			logging.Fatal(logger, "failed to read migrations", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+	}
+}
+
+func migrateSQLite(ctx context.Context, logger *slog.Logger, cfg *config.Config, command string) {
+	database, err := db.NewSQLite(cfg.SQLitePath)
+	if err != nil {
+		logging.Fatal(logger, "failed to open SQLite", err)
+	}
+	defer database.Close()
+
+	switch command {
+	case "up":
+		if _, err := sqlite.Migrate(ctx, database.DB); err != nil {
+			logging.Fatal(logger, "migration failed", err)
+		}
+		logger.Info("database is up to date")
+	case "status":
+		current, latest, err := sqlite.SchemaVersion(ctx, database.DB)
+		if err != nil {
+			logging.Fatal(logger, "failed to read schema version", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tLATEST")
+		fmt.Fprintf(w, "%d\t%d\n", current, latest)
+		w.Flush()
+	}
+}
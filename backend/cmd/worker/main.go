@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os/signal"
+	"syscall"
+
+	"github.com/nesohq/backend/internal/app"
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/infrastructure/queue"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/tracing"
+)
+
+// Worker: drains the event, error and purchase queues into MongoDB and runs
+// the retention and alert jobs. It serves no API traffic.
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Load config
+	cfg, err := config.Load()
+	if err != nil {
+		logging.Fatal(slog.Default(), "failed to load config", err)
+	}
+
+	// Initialize logging
+	logger := logging.New(cfg.Environment, cfg.LogLevel)
+	slog.SetDefault(logger)
+	if cfg.LiteMode {
+		logging.Fatal(logger, "cannot run the workers on its own", app.ErrLiteMode)
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(ctx, cfg.OTLPEndpoint, "krakens-worker")
+	if err != nil {
+		logging.Fatal(logger, "failed to set up tracing", err)
+	}
+
+	// Initialize MongoDB
+	mongodb, err := db.NewMongoDB(cfg.MongoDBURI, cfg.MongoDBDatabase)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to MongoDB", err)
+	}
+	if cfg.MigrateOnStart {
+		app.Migrate(ctx, logger, mongodb)
+	}
+
+	// Initialize ClickHouse, if raw events are kept there
+	clickhouse := app.ConnectClickHouse(ctx, logger, cfg)
+
+	// Initialize Redis, for the unique visitor counts the retention job rolls up
+	redisCache, err := cache.NewRedisCache(cfg.RedisURL)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to Redis", err)
+	}
+
+	// Initialize NATS
+	natsQueue, err := queue.NewNATSQueue(cfg.NATSURL, logger)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to NATS", err)
+	}
+
+	jobsDone := app.StartWorkers(ctx, cfg, logger, app.MongoStores(mongodb, clickhouse), redisCache, natsQueue)
+
+	// The worker has no public listener; metrics and health checks share
+	// the metrics port
+	metricsRouter := app.NewMetricsRouter()
+	app.RegisterHealthRoutes(metricsRouter, mongodb, clickhouse, nil, redisCache, natsQueue)
+	metricsSrv := app.NewMetricsServer(cfg, metricsRouter)
+	if err := app.Serve(ctx, logger, metricsSrv); err != nil {
+		logging.Fatal(logger, "failed to start metrics server", err)
+	}
+	stop()
+
+	// Buffered batches are written before Mongo goes away
+	app.Shutdown(logger, cfg.ShutdownTimeout,
+		app.ServerShutdown(metricsSrv),
+		app.ShutdownStep{Name: "nats", Run: natsQueue.Drain},
+		app.WaitStep("background jobs", jobsDone),
+		app.CloseStep("redis", redisCache.Close),
+		app.CloseStep("mongodb", mongodb.Close),
+		app.CloseStep("clickhouse", clickhouse.Close),
+		app.ShutdownStep{Name: "tracing", Run: shutdownTracing},
+	)
+}
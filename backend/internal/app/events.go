@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/repository"
+)
+
+// ConnectClickHouse connects to ClickHouse and creates the events table when
+// cfg keeps raw events there, and returns nil otherwise. Like Migrate, it
+// exits the process if ClickHouse is selected but unusable.
+func ConnectClickHouse(ctx context.Context, logger *slog.Logger, cfg *config.Config) *db.ClickHouse {
+	if cfg.EventStore != config.EventStoreClickHouse {
+		return nil
+	}
+
+	clickhouse, err := db.NewClickHouse(cfg.ClickHouseURL)
+	if err != nil {
+		logging.Fatal(logger, "failed to connect to ClickHouse", err)
+	}
+	if err := repository.NewClickHouseEventRepository(clickhouse).EnsureSchema(ctx); err != nil {
+		logging.Fatal(logger, "failed to create ClickHouse schema", err)
+	}
+	return clickhouse
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/handler"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/infrastructure/queue"
+	"github.com/nesohq/backend/internal/service"
+)
+
+// RegisterHealthRoutes mounts liveness (/healthz, and /health for older
+// probes) and readiness (/readyz). Readiness pings whichever of the
+// dependencies the process uses; pass nil for the ones it doesn't.
+func RegisterHealthRoutes(router gin.IRouter, mongodb *db.MongoDB, clickhouse *db.ClickHouse, sqlite *db.SQLite, redisCache *cache.RedisCache, natsQueue *queue.NATSQueue) {
+	var checks []service.HealthCheck
+	if mongodb != nil {
+		checks = append(checks, service.HealthCheck{Name: "mongodb", Ping: mongodb.Ping})
+	}
+	if clickhouse != nil {
+		checks = append(checks, service.HealthCheck{Name: "clickhouse", Ping: clickhouse.Ping})
+	}
+	if sqlite != nil {
+		checks = append(checks, service.HealthCheck{Name: "sqlite", Ping: sqlite.Ping})
+	}
+	if redisCache != nil {
+		checks = append(checks, service.HealthCheck{Name: "redis", Ping: redisCache.Ping})
+	}
+
+	var queueLag func(ctx context.Context) (map[string]domain.QueueLag, error)
+	if natsQueue != nil {
+		checks = append(checks, service.HealthCheck{Name: "nats", Ping: natsQueue.Ping})
+		queueLag = func(ctx context.Context) (map[string]domain.QueueLag, error) {
+			lag, err := natsQueue.Lag(ctx)
+			if err != nil {
+				return nil, err
+			}
+			out := make(map[string]domain.QueueLag, len(lag))
+			for subject, l := range lag {
+				out[subject] = domain.QueueLag{Pending: l.Pending, AckPending: l.AckPending}
+			}
+			return out, nil
+		}
+	}
+
+	healthHandler := handler.NewHealthHandler(service.NewHealthService(checks, queueLag))
+
+	router.GET("/health", healthHandler.Liveness)
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+}
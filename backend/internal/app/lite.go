@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/repository/sqlite"
+)
+
+// ErrLiteMode is why the api, ingest and worker commands refuse lite mode:
+// the in-memory cache and queue cannot be shared between processes.
+var ErrLiteMode = errors.New("lite mode runs as a single process, start cmd/main.go instead")
+
+// OpenSQLite opens the lite mode database and applies pending schema
+// versions, exiting the process if either fails. Unlike MongoDB there is
+// only ever one process using the file, so it always migrates on start.
+func OpenSQLite(ctx context.Context, logger *slog.Logger, cfg *config.Config) *db.SQLite {
+	database, err := db.NewSQLite(cfg.SQLitePath)
+	if err != nil {
+		logging.Fatal(logger, "failed to open SQLite", err)
+	}
+
+	version, err := sqlite.Migrate(ctx, database.DB)
+	if err != nil {
+		logging.Fatal(logger, "failed to migrate SQLite", err)
+	}
+	logger.Info("opened SQLite", "path", cfg.SQLitePath, "schema_version", version)
+	return database
+}
+
+// SweepCache drops expired keys from memoryCache every interval until ctx is
+// cancelled. Redis does this on its own; the memory cache otherwise only
+// forgets a key when it is next read.
+func SweepCache(ctx context.Context, memoryCache *cache.MemoryCache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			memoryCache.Sweep()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
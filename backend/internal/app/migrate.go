@@ -0,0 +1,18 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/migrations"
+)
+
+// Migrate applies pending schema migrations and exits the process if one
+// fails, so a server never runs against a schema it does not expect.
+func Migrate(ctx context.Context, logger *slog.Logger, mongodb *db.MongoDB) {
+	if err := migrations.Up(ctx, mongodb.Database, logger); err != nil {
+		logging.Fatal(logger, "failed to migrate MongoDB", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Package app wires repositories, services and handlers together for the
+// api, ingest and worker processes, so each binary only builds (and only
+// connects to) what it actually needs.
+package app
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/handler"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/infrastructure/queue"
+	"github.com/nesohq/backend/internal/middleware"
+	"github.com/nesohq/backend/internal/service"
+)
+
+// RegisterAPIRoutes mounts the dashboard API and public assets. It needs the
+// stores and the cache (Redis, or memory in lite mode).
+func RegisterAPIRoutes(router *gin.Engine, cfg *config.Config, logger *slog.Logger, stores *Stores, redisCache cache.Cache) {
+	// Initialize repositories
+	userRepo := stores.Users
+	domainRepo := stores.Domains
+	apiKeyRepo := stores.APIKeys
+	eventRepo := stores.Events
+	errorRepo := stores.Errors
+	purchaseRepo := stores.Purchases
+	privacyRequestRepo := stores.PrivacyRequests
+	rollupRepo := stores.Rollups
+
+	// Initialize services
+	authService := service.NewAuthService(userRepo, cfg.JWTSecret, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+	domainService := service.NewDomainService(domainRepo, userRepo, redisCache)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	uniqueVisitorService := service.NewUniqueVisitorService(redisCache, rollupRepo)
+	statsService := service.NewStatsService(eventRepo, rollupRepo, domainRepo, uniqueVisitorService, redisCache, logger, cfg.ActiveVisitorWindow)
+	errorService := service.NewErrorService(domainRepo, errorRepo)
+	purchaseService := service.NewPurchaseService(domainRepo, purchaseRepo)
+	rollupService := service.NewRollupService(eventRepo, rollupRepo, uniqueVisitorService)
+	exportService := service.NewExportService(domainRepo, eventRepo)
+	importService := service.NewImportService(domainRepo, rollupRepo)
+	privacyService := service.NewPrivacyService(domainRepo, eventRepo, errorRepo, purchaseRepo, privacyRequestRepo, rollupService, redisCache)
+	alertService := service.NewAlertService(stores.AlertRules, stores.AlertDeliveries, domainRepo, statsService, redisCache, logger, cfg.AlertAllowPrivateWebhooks)
+
+	// Initialize handlers
+	authHandler := handler.NewAuthHandler(authService)
+	domainHandler := handler.NewDomainHandler(domainService)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	statsHandler := handler.NewStatsHandler(statsService)
+	errorHandler := handler.NewErrorHandler(errorService)
+	purchaseHandler := handler.NewPurchaseHandler(purchaseService)
+	privacyHandler := handler.NewPrivacyHandler(privacyService)
+	exportHandler := handler.NewExportHandler(exportService)
+	importHandler := handler.NewImportHandler(importService)
+	alertHandler := handler.NewAlertHandler(alertService)
+	badgeHandler := handler.NewBadgeHandler(statsService, logger)
+	avatarHandler := handler.NewAvatarHandler()
+
+	// Public Assets (Badges, Avatars) - accessible from any origin
+	router.OPTIONS("/api/badges/:domain_id/live.svg", middleware.PublicGetCORSMiddleware())
+	router.GET("/api/badges/:domain_id/live.svg", middleware.PublicGetCORSMiddleware(), badgeHandler.GetLiveBadge)
+
+	router.OPTIONS("/api/avatars/:seed", middleware.PublicGetCORSMiddleware())
+	router.GET("/api/avatars/:seed", middleware.PublicGetCORSMiddleware(), avatarHandler.GetAvatar)
+
+	// Public routes (with restricted CORS)
+	router.OPTIONS("/api/auth/register", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/auth/login", middleware.CORSMiddleware(cfg.FrontendURL))
+
+	public := router.Group("/api")
+	public.Use(middleware.CORSMiddleware(cfg.FrontendURL))
+	{
+		public.POST("/auth/register", authHandler.Register)
+		public.POST("/auth/login", authHandler.Login)
+	}
+
+	// Protected routes
+	router.OPTIONS("/api/stats/realtime", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/stats/live", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/stats/overview", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/errors", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/stats/revenue", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/privacy/visitors/:visitor_id", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/privacy/requests", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/export/events", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/export/reports/:report", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/import", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/domains", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/domains/:id", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/api-keys", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/api-keys/:id", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/alerts", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/alerts/:id", middleware.CORSMiddleware(cfg.FrontendURL))
+	router.OPTIONS("/api/alerts/:id/deliveries", middleware.CORSMiddleware(cfg.FrontendURL))
+
+	protected := router.Group("/api")
+	protected.Use(middleware.CORSMiddleware(cfg.FrontendURL))
+	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	{
+		// Domains
+		protected.GET("/domains", domainHandler.List)
+		protected.POST("/domains", domainHandler.Create)
+		protected.GET("/domains/:id", domainHandler.GetByID)
+		protected.PUT("/domains/:id", domainHandler.Update)
+		protected.DELETE("/domains/:id", domainHandler.Delete)
+
+		// API Keys
+		protected.GET("/api-keys", apiKeyHandler.List)
+		protected.POST("/api-keys", apiKeyHandler.Create)
+		protected.DELETE("/api-keys/:id", apiKeyHandler.Revoke)
+
+		// Stats
+		protected.GET("/stats/realtime", statsHandler.GetRealtimeStats)
+		protected.GET("/stats/live", statsHandler.GetLiveView)
+		protected.GET("/stats/overview", statsHandler.GetOverviewStats)
+		protected.GET("/stats/revenue", purchaseHandler.GetRevenueStats)
+
+		// Errors
+		protected.GET("/errors", errorHandler.ListIssues)
+
+		// Data subject requests
+		protected.GET("/privacy/visitors/:visitor_id", privacyHandler.ExportVisitor)
+		protected.DELETE("/privacy/visitors/:visitor_id", privacyHandler.EraseVisitor)
+		protected.GET("/privacy/requests", privacyHandler.ListRequests)
+
+		// Exports
+		protected.GET("/export/events", exportHandler.ExportEvents)
+		protected.GET("/export/reports/:report", exportHandler.ExportReport)
+
+		// Imports
+		protected.POST("/import", importHandler.Import)
+
+		// Alerts
+		protected.GET("/alerts", alertHandler.List)
+		protected.POST("/alerts", alertHandler.Create)
+		protected.PUT("/alerts/:id", alertHandler.Update)
+		protected.DELETE("/alerts/:id", alertHandler.Delete)
+		protected.GET("/alerts/:id/deliveries", alertHandler.ListDeliveries)
+	}
+}
+
+// RegisterIngestRoutes mounts the public tracking endpoints. It needs the
+// domain and API key stores, the cache and the queue (NATS, or the
+// in-process queue in lite mode).
+func RegisterIngestRoutes(router *gin.Engine, cfg *config.Config, logger *slog.Logger, stores *Stores, redisCache cache.Cache, publisher queue.Publisher) {
+	domainRepo := stores.Domains
+	apiKeyRepo := stores.APIKeys
+
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	uniqueVisitorService := service.NewUniqueVisitorService(redisCache, stores.Rollups)
+	trackingService := service.NewTrackingService(domainRepo, redisCache, publisher, uniqueVisitorService, cfg.ActiveVisitorTTL)
+
+	trackingHandler := handler.NewTrackingHandler(trackingService, apiKeyService, logger)
+
+	// Tracking endpoint (with permissive CORS - needs to accept requests from any website)
+	router.OPTIONS("/api/track", middleware.TrackingCORSMiddleware())
+	router.POST("/api/track", middleware.TrackingCORSMiddleware(), trackingHandler.Track)
+	router.OPTIONS("/api/track/error", middleware.TrackingCORSMiddleware())
+	router.POST("/api/track/error", middleware.TrackingCORSMiddleware(), trackingHandler.TrackError)
+	router.OPTIONS("/api/track/purchase", middleware.TrackingCORSMiddleware())
+	router.POST("/api/track/purchase", middleware.TrackingCORSMiddleware(), trackingHandler.TrackPurchase)
+}
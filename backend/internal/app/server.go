@@ -0,0 +1,46 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/metrics"
+	"github.com/nesohq/backend/internal/middleware"
+)
+
+// NewRouter returns the gin engine every HTTP process starts from.
+func NewRouter(cfg *config.Config, logger *slog.Logger) *gin.Engine {
+	if cfg.Environment == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	router := gin.New()
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(middleware.TracingMiddleware())
+	router.Use(middleware.LoggingMiddleware(logger))
+	router.Use(middleware.MetricsMiddleware())
+	router.Use(gin.Recovery())
+	return router
+}
+
+// NewServer wraps router in an http.Server listening on cfg.Port.
+func NewServer(cfg *config.Config, router http.Handler) *http.Server {
+	return &http.Server{Addr: fmt.Sprintf(":%s", cfg.Port), Handler: router}
+}
+
+// NewMetricsRouter serves /metrics. Processes without a public listener
+// also mount their health checks on it.
+func NewMetricsRouter() *gin.Engine {
+	router := gin.New()
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	return router
+}
+
+// NewMetricsServer listens on cfg.MetricsPort. It is kept off the public
+// listener so per-domain series are not exposed to the internet.
+func NewMetricsServer(cfg *config.Config, router http.Handler) *http.Server {
+	return &http.Server{Addr: fmt.Sprintf(":%s", cfg.MetricsPort), Handler: router}
+}
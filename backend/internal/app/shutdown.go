@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ShutdownStep is one stage of an ordered shutdown, such as draining the HTTP
+// server or closing a database connection.
+type ShutdownStep struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Serve starts servers and blocks until ctx is cancelled (typically by
+// SIGINT or SIGTERM) or a listener fails. It does not stop the servers; pass
+// ServerShutdown for each of them to Shutdown for that.
+func Serve(ctx context.Context, logger *slog.Logger, servers ...*http.Server) error {
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			logger.Info("server starting", "addr", srv.Addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- err
+			}
+		}(srv)
+	}
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		logger.Info("shutdown signal received")
+		return nil
+	}
+}
+
+// ServerShutdown stops srv accepting new connections and waits for in-flight
+// requests to complete.
+func ServerShutdown(srv *http.Server) ShutdownStep {
+	return ShutdownStep{Name: "http server " + srv.Addr, Run: srv.Shutdown}
+}
+
+// Shutdown runs steps in order, sharing a single deadline of timeout between
+// them. A failing step is logged and the remaining ones still run, so
+// connections are always closed.
+func Shutdown(logger *slog.Logger, timeout time.Duration, steps ...ShutdownStep) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, step := range steps {
+		start := time.Now()
+		if err := step.Run(ctx); err != nil {
+			logger.Error("shutdown step failed", "step", step.Name, "duration", time.Since(start), "error", err)
+			continue
+		}
+		logger.Info("shutdown step done", "step", step.Name, "duration", time.Since(start))
+	}
+}
+
+// WaitStep waits for done to be closed, e.g. a background job noticing that
+// its context was cancelled.
+func WaitStep(name string, done <-chan struct{}) ShutdownStep {
+	return ShutdownStep{Name: name, Run: func(ctx context.Context) error {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}
+}
+
+// CloseStep adapts a Close method that takes no context.
+func CloseStep(name string, close func() error) ShutdownStep {
+	return ShutdownStep{Name: name, Run: func(context.Context) error {
+		return close()
+	}}
+}
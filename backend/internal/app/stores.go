@@ -0,0 +1,60 @@
+package app
+
+import (
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"github.com/nesohq/backend/internal/repository"
+	"github.com/nesohq/backend/internal/repository/sqlite"
+)
+
+// Stores are the repositories the services are built on, backed either by
+// MongoDB (and ClickHouse) or, in lite mode, by SQLite.
+type Stores struct {
+	Users           repository.UserStore
+	Domains         repository.DomainStore
+	APIKeys         repository.APIKeyStore
+	Events          repository.EventStore
+	Errors          repository.ErrorStore
+	Purchases       repository.PurchaseStore
+	Rollups         repository.RollupStore
+	PrivacyRequests repository.PrivacyRequestStore
+	AlertRules      repository.AlertRuleStore
+	AlertDeliveries repository.AlertDeliveryStore
+}
+
+// MongoStores keeps everything in MongoDB, except raw events when clickhouse
+// is non-nil.
+func MongoStores(mongodb *db.MongoDB, clickhouse *db.ClickHouse) *Stores {
+	var events repository.EventStore = repository.NewEventRepository(mongodb.Database)
+	if clickhouse != nil {
+		events = repository.NewClickHouseEventRepository(clickhouse)
+	}
+
+	return &Stores{
+		Users:           repository.NewUserRepository(mongodb.Database),
+		Domains:         repository.NewDomainRepository(mongodb.Database),
+		APIKeys:         repository.NewAPIKeyRepository(mongodb.Database),
+		Events:          events,
+		Errors:          repository.NewErrorRepository(mongodb.Database),
+		Purchases:       repository.NewPurchaseRepository(mongodb.Database),
+		Rollups:         repository.NewRollupRepository(mongodb.Database),
+		PrivacyRequests: repository.NewPrivacyRequestRepository(mongodb.Database),
+		AlertRules:      repository.NewAlertRuleRepository(mongodb.Database),
+		AlertDeliveries: repository.NewAlertDeliveryRepository(mongodb.Database),
+	}
+}
+
+// SQLiteStores keeps everything in one SQLite file, for lite mode.
+func SQLiteStores(database *db.SQLite) *Stores {
+	return &Stores{
+		Users:           sqlite.NewUserRepository(database.DB),
+		Domains:         sqlite.NewDomainRepository(database.DB),
+		APIKeys:         sqlite.NewAPIKeyRepository(database.DB),
+		Events:          sqlite.NewEventRepository(database.DB),
+		Errors:          sqlite.NewErrorRepository(database.DB),
+		Purchases:       sqlite.NewPurchaseRepository(database.DB),
+		Rollups:         sqlite.NewRollupRepository(database.DB),
+		PrivacyRequests: sqlite.NewPrivacyRequestRepository(database.DB),
+		AlertRules:      sqlite.NewAlertRuleRepository(database.DB),
+		AlertDeliveries: sqlite.NewAlertDeliveryRepository(database.DB),
+	}
+}
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/config"
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/infrastructure/queue"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/metrics"
+	"github.com/nesohq/backend/internal/repository"
+	"github.com/nesohq/backend/internal/service"
+)
+
+// StartWorkers consumes the queues into the stores and runs the retention
+// and alert jobs until ctx is cancelled. Both jobs read counters from the
+// cache. The queue consumers are stopped by draining consumer; the returned
+// channel is closed once both jobs have exited.
+func StartWorkers(ctx context.Context, cfg *config.Config, logger *slog.Logger, stores *Stores, redisCache cache.Cache, consumer queue.Consumer) <-chan struct{} {
+	userRepo := stores.Users
+	domainRepo := stores.Domains
+	eventRepo := stores.Events
+	errorRepo := stores.Errors
+	purchaseRepo := stores.Purchases
+	rollupRepo := stores.Rollups
+
+	uniqueVisitorService := service.NewUniqueVisitorService(redisCache, rollupRepo)
+	rollupService := service.NewRollupService(eventRepo, rollupRepo, uniqueVisitorService)
+	retentionService := service.NewRetentionService(domainRepo, userRepo, eventRepo, errorRepo, rollupRepo, rollupService, redisCache, logger)
+	statsService := service.NewStatsService(eventRepo, rollupRepo, domainRepo, uniqueVisitorService, redisCache, logger, cfg.ActiveVisitorWindow)
+	alertService := service.NewAlertService(stores.AlertRules, stores.AlertDeliveries, domainRepo, statsService, redisCache, logger, cfg.AlertAllowPrivateWebhooks)
+
+	startEventWorker(logger, consumer, eventRepo, queue.BatchOptions{
+		Size:        cfg.WorkerBatchSize,
+		Interval:    cfg.WorkerFlushInterval,
+		Concurrency: cfg.WorkerConcurrency,
+	})
+	startErrorWorker(logger, consumer, errorRepo)
+	startPurchaseWorker(logger, consumer, purchaseRepo)
+
+	var jobs sync.WaitGroup
+	jobs.Add(2)
+	go func() {
+		defer jobs.Done()
+		startRetentionJob(ctx, logger, retentionService, cfg.RetentionInterval)
+	}()
+	go func() {
+		defer jobs.Done()
+		startAlertJob(ctx, logger, alertService, cfg.AlertInterval)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func startEventWorker(logger *slog.Logger, consumer queue.Consumer, eventRepo repository.EventStore, opts queue.BatchOptions) {
+	logger.Info("starting event worker", "batch_size", opts.Size, "concurrency", opts.Concurrency)
+
+	err := consumer.SubscribeBatch(queue.SubjectEvents, opts, func(ctx context.Context, batch []queue.Message) []error {
+		errs := make([]error, len(batch))
+		events := make([]*domain.Event, 0, len(batch))
+		positions := make([]int, 0, len(batch))
+
+		for i, msg := range batch {
+			var event domain.Event
+			if err := json.Unmarshal(msg.Data, &event); err != nil {
+				errs[i] = queue.Permanent(err)
+				continue
+			}
+			events = append(events, &event)
+			positions = append(positions, i)
+		}
+		if len(events) == 0 {
+			return errs
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		// Failed inserts are retried by the queue, so only log them here
+		start := time.Now()
+		failed, err := eventRepo.CreateMany(ctx, events)
+		metrics.WorkerInsertDuration.WithLabelValues(queue.SubjectEvents, metrics.Status(err)).Observe(time.Since(start).Seconds())
+		if err != nil {
+			requestIDs := make([]string, 0, len(positions))
+			for _, i := range positions {
+				errs[i] = err
+				requestIDs = append(requestIDs, batch[i].RequestID)
+			}
+			logger.ErrorContext(ctx, "failed to save events", "count", len(events), "request_ids", requestIDs, "error", err)
+			return errs
+		}
+		for index, err := range failed {
+			i := positions[index]
+			logger.ErrorContext(ctx, "failed to save event",
+				"event_id", events[index].ID.Hex(), "request_id", batch[i].RequestID, "error", err)
+			errs[i] = err
+		}
+		return errs
+	})
+
+	if err != nil {
+		logging.Fatal(logger, "failed to subscribe to events", err)
+	}
+}
+
+func startErrorWorker(logger *slog.Logger, consumer queue.Consumer, errorRepo repository.ErrorStore) {
+	logger.Info("starting error worker")
+
+	err := consumer.Subscribe(queue.SubjectErrors, func(ctx context.Context, data []byte) error {
+		var event domain.ErrorEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return queue.Permanent(err)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		// A failed insert is retried by the queue, so only log it here
+		start := time.Now()
+		err := errorRepo.Create(ctx, &event)
+		metrics.WorkerInsertDuration.WithLabelValues(queue.SubjectErrors, metrics.Status(err)).Observe(time.Since(start).Seconds())
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to save error event", "error", err)
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		logging.Fatal(logger, "failed to subscribe to errors", err)
+	}
+}
+
+func startPurchaseWorker(logger *slog.Logger, consumer queue.Consumer, purchaseRepo repository.PurchaseStore) {
+	logger.Info("starting purchase worker")
+
+	err := consumer.Subscribe(queue.SubjectPurchases, func(ctx context.Context, data []byte) error {
+		var purchase domain.Purchase
+		if err := json.Unmarshal(data, &purchase); err != nil {
+			return queue.Permanent(err)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		// A failed insert is retried by the queue, so only log it here
+		start := time.Now()
+		err := purchaseRepo.Create(ctx, &purchase)
+		metrics.WorkerInsertDuration.WithLabelValues(queue.SubjectPurchases, metrics.Status(err)).Observe(time.Since(start).Seconds())
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to save purchase", "order_id", purchase.OrderID, "error", err)
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		logging.Fatal(logger, "failed to subscribe to purchases", err)
+	}
+}
+
+func startRetentionJob(ctx context.Context, logger *slog.Logger, retentionService *service.RetentionService, interval time.Duration) {
+	logger.Info("starting retention job", "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Cancelling ctx aborts a run part-way; it is safe to resume next time
+		runCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+		if err := retentionService.Run(runCtx); err != nil && ctx.Err() == nil {
+			logger.Error("retention run failed", "error", err)
+		}
+		cancel()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Info("retention job stopped")
+			return
+		}
+	}
+}
+
+func startAlertJob(ctx context.Context, logger *slog.Logger, alertService *service.AlertService, interval time.Duration) {
+	logger.Info("starting alert job", "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Webhook retries are abandoned on shutdown; the rule's state is
+		// already saved, so they are not sent again
+		runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		if err := alertService.Run(runCtx); err != nil && ctx.Err() == nil {
+			logger.Error("alert run failed", "error", err)
+		}
+		cancel()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Info("alert job stopped")
+			return
+		}
+	}
+}
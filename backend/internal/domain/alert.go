@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Alert rule types.
+const (
+	// AlertActiveVisitorsAbove fires while more than Threshold visitors are
+	// active.
+	AlertActiveVisitorsAbove = "active_visitors_above"
+	// AlertPageviewsDrop fires while the last hour's pageviews are at least
+	// Threshold percent below the average hour of the previous week.
+	AlertPageviewsDrop = "pageviews_drop"
+	// AlertNoEvents fires after Minutes minutes without a single hit.
+	AlertNoEvents = "no_events"
+	// AlertErrorsAbove fires while more than Threshold error events were
+	// reported in the last Minutes minutes.
+	AlertErrorsAbove = "errors_above"
+)
+
+// Alert notification events.
+const (
+	AlertTriggered = "triggered"
+	AlertResolved  = "resolved"
+)
+
+// AlertRule watches one of a domain's traffic signals and notifies a webhook
+// when its condition starts and stops holding.
+type AlertRule struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	DomainID   primitive.ObjectID `bson:"domain_id" json:"domain_id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Type       string             `bson:"type" json:"type"`
+	Threshold  float64            `bson:"threshold" json:"threshold"`
+	Minutes    int                `bson:"minutes" json:"minutes"`
+	WebhookURL string             `bson:"webhook_url" json:"webhook_url"`
+	// Secret is the HMAC key webhook payloads are signed with.
+	Secret  string `bson:"secret" json:"secret"`
+	Enabled bool   `bson:"enabled" json:"enabled"`
+
+	// Firing is whether the condition held when last notified. Notifications
+	// are sent when the condition no longer matches it, and it only changes
+	// once the webhook has accepted one.
+	Firing        bool      `bson:"firing" json:"firing"`
+	LastValue     float64   `bson:"last_value" json:"last_value"`
+	LastCheckedAt time.Time `bson:"last_checked_at" json:"last_checked_at"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type UpdateAlertRuleRequest struct {
+	Type       string  `json:"type" binding:"required,oneof=active_visitors_above pageviews_drop no_events errors_above"`
+	Threshold  float64 `json:"threshold" binding:"min=0"`
+	Minutes    int     `json:"minutes" binding:"min=0"`
+	WebhookURL string  `json:"webhook_url" binding:"required,url"`
+	Enabled    *bool   `json:"enabled"`
+}
+
+type CreateAlertRuleRequest struct {
+	DomainID string `json:"domain_id" binding:"required"`
+	UpdateAlertRuleRequest
+}
+
+// AlertNotification is the JSON body posted to a rule's webhook.
+type AlertNotification struct {
+	DeliveryID primitive.ObjectID `json:"delivery_id"`
+	Event      string             `json:"event"`
+	RuleID     primitive.ObjectID `json:"rule_id"`
+	RuleType   string             `json:"rule_type"`
+	DomainID   primitive.ObjectID `json:"domain_id"`
+	Domain     string             `json:"domain"`
+	Threshold  float64            `json:"threshold"`
+	Minutes    int                `json:"minutes,omitempty"`
+	// Value is what was measured: visitors, pageviews in the last hour, hits
+	// or error events.
+	Value float64 `json:"value"`
+	// Baseline is the average hourly pageviews a drop is measured against.
+	Baseline  float64   `json:"baseline,omitempty"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AlertDelivery records one notification and how its delivery went.
+type AlertDelivery struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RuleID     primitive.ObjectID `bson:"rule_id" json:"rule_id"`
+	DomainID   primitive.ObjectID `bson:"domain_id" json:"domain_id"`
+	Event      string             `bson:"event" json:"event"`
+	URL        string             `bson:"url" json:"url"`
+	Payload    string             `bson:"payload" json:"payload"`
+	Delivered  bool               `bson:"delivered" json:"delivered"`
+	Attempts   int                `bson:"attempts" json:"attempts"`
+	StatusCode int                `bson:"status_code" json:"status_code"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
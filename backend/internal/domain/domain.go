@@ -17,13 +17,34 @@ type Domain struct {
 }
 
 type DomainSettings struct {
-	AnonymizeIP      bool   `bson:"anonymize_ip" json:"anonymize_ip"`
-	RateLimit        int    `bson:"rate_limit" json:"rate_limit"`
+	AnonymizeIP bool `bson:"anonymize_ip" json:"anonymize_ip"`
+	// RateLimit is how many page views a minute are accepted; the rest are
+	// refused with 429. Zero means no limit.
+	RateLimit        int    `bson:"rate_limit" json:"rate_limit" binding:"min=0"`
 	TrackQueryParams bool   `bson:"track_query_params" json:"track_query_params"`
 	SessionTimeout   int    `bson:"session_timeout" json:"session_timeout"`
 	Timezone         string `bson:"timezone" json:"timezone"`
+	// Cookieless derives visitor ids server-side from a daily rotating salt
+	// instead of trusting the client-generated id kept in local storage.
+	Cookieless bool `bson:"cookieless" json:"cookieless"`
+	// PrivacySignalPolicy decides what happens to requests carrying DNT or
+	// Sec-GPC headers. One of the PrivacyPolicy* constants.
+	PrivacySignalPolicy string `bson:"privacy_signal_policy" json:"privacy_signal_policy" binding:"omitempty,oneof=track anonymous drop"`
+	// RetentionDays is how long raw events are kept before being purged. Zero
+	// means the maximum allowed by the owner's plan.
+	RetentionDays int `bson:"retention_days" json:"retention_days" binding:"min=0"`
 }
 
+const (
+	// PrivacyPolicyTrack ignores privacy signals and tracks normally.
+	PrivacyPolicyTrack = "track"
+	// PrivacyPolicyAnonymous counts the hit but strips the visitor id, IP
+	// hash and user agent.
+	PrivacyPolicyAnonymous = "anonymous"
+	// PrivacyPolicyDrop discards the hit entirely.
+	PrivacyPolicyDrop = "drop"
+)
+
 type CreateDomainRequest struct {
 	Domain string `json:"domain" binding:"required"`
 }
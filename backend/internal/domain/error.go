@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ErrorEvent struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	DomainID    primitive.ObjectID `bson:"domain_id" json:"domain_id"`
+	Timestamp   time.Time          `bson:"timestamp" json:"timestamp"`
+	Fingerprint string             `bson:"fingerprint" json:"fingerprint"`
+	Message     string             `bson:"message" json:"message"`
+	Source      string             `bson:"source" json:"source"`
+	Line        int                `bson:"line" json:"line"`
+	Column      int                `bson:"column" json:"column"`
+	Stack       string             `bson:"stack" json:"stack"`
+	Path        string             `bson:"path" json:"path"`
+	Browser     string             `bson:"browser" json:"browser"`
+	VisitorID   string             `bson:"visitor_id" json:"visitor_id"`
+}
+
+type TrackErrorRequest struct {
+	Message   string `json:"message" binding:"required"`
+	Source    string `json:"source"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	Stack     string `json:"stack"`
+	Path      string `json:"path"`
+	VisitorID string `json:"visitor_id"`
+	// Consent and PrivacySignal apply the domain's privacy settings as for
+	// page views
+	Consent       *bool `json:"consent"`
+	PrivacySignal bool  `json:"-"`
+}
+
+// ErrorIssue groups every occurrence of an error sharing the same fingerprint.
+type ErrorIssue struct {
+	Fingerprint      string    `bson:"_id" json:"fingerprint"`
+	Message          string    `bson:"message" json:"message"`
+	Source           string    `bson:"source" json:"source"`
+	Line             int       `bson:"line" json:"line"`
+	Column           int       `bson:"column" json:"column"`
+	Occurrences      int64     `bson:"occurrences" json:"occurrences"`
+	AffectedVisitors int64     `bson:"affected_visitors" json:"affected_visitors"`
+	FirstSeen        time.Time `bson:"first_seen" json:"first_seen"`
+	LastSeen         time.Time `bson:"last_seen" json:"last_seen"`
+}
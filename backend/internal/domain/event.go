@@ -25,6 +25,11 @@ type TrackRequest struct {
 	Referrer  string `json:"referrer"`
 	UserAgent string `json:"user_agent"`
 	VisitorID string `json:"visitor_id"`
+	// Consent is nil when the site does not manage consent. When false the
+	// hit is downgraded to anonymous tracking until consent is given.
+	Consent *bool `json:"consent"`
+	// PrivacySignal is set from the DNT and Sec-GPC request headers.
+	PrivacySignal bool `json:"-"`
 }
 
 type RealtimeStats struct {
@@ -38,6 +43,29 @@ type RealtimeStats struct {
 	Browsers         map[string]int  `json:"browsers"`
 }
 
+// LiveView shows where the domain's active visitors are right now.
+type LiveView struct {
+	ActiveVisitors int           `json:"active_visitors"`
+	Pages          []LivePage    `json:"pages"`
+	Visitors       []LiveVisitor `json:"visitors"`
+}
+
+// LivePage counts the active visitors whose latest hit was on Path.
+type LivePage struct {
+	Path     string `json:"path"`
+	Visitors int    `json:"visitors"`
+}
+
+// LiveVisitor is an active visitor as of their latest hit.
+type LiveVisitor struct {
+	VisitorID string    `json:"visitor_id"`
+	Path      string    `json:"path"`
+	Referrer  string    `json:"referrer"`
+	Country   string    `json:"country"`
+	Device    string    `json:"device"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
 type HitsPerMinute struct {
 	Minute string `json:"minute"`
 	Hits   int    `json:"hits"`
@@ -53,6 +81,13 @@ type ReferrerStats struct {
 	Hits     int    `json:"hits"`
 }
 
+// BreakdownRow is one row of a breakdown report such as top pages.
+type BreakdownRow struct {
+	Key      string `bson:"_id" json:"key"`
+	Hits     int64  `bson:"hits" json:"hits"`
+	Visitors int64  `bson:"visitors" json:"visitors"`
+}
+
 type OverviewStats struct {
 	TotalHits      int64   `json:"total_hits"`
 	UniqueVisitors int64   `json:"unique_visitors"`
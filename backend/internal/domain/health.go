@@ -0,0 +1,27 @@
+package domain
+
+const (
+	HealthStatusUp   = "up"
+	HealthStatusDown = "down"
+)
+
+// ComponentHealth is the result of pinging one dependency.
+type ComponentHealth struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// QueueLag is how far a worker consumer is behind its subject.
+type QueueLag struct {
+	Pending    uint64 `json:"pending"`
+	AckPending int    `json:"ack_pending"`
+}
+
+// HealthReport is the body of the readiness endpoint.
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Version    string                     `json:"version"`
+	Components map[string]ComponentHealth `json:"components"`
+	QueueLag   map[string]QueueLag        `json:"queue_lag,omitempty"`
+}
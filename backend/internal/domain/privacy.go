@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PrivacyRequestExport = "export"
+	PrivacyRequestErase  = "erase"
+)
+
+// PrivacyRequest is the audit record kept for every data subject request.
+type PrivacyRequest struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	DomainID       primitive.ObjectID `bson:"domain_id" json:"domain_id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	VisitorID      string             `bson:"visitor_id" json:"visitor_id"`
+	Type           string             `bson:"type" json:"type"`
+	EventsAffected int64              `bson:"events_affected" json:"events_affected"`
+	ErrorsAffected int64              `bson:"errors_affected" json:"errors_affected"`
+	OrdersAffected int64              `bson:"orders_affected" json:"orders_affected"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type VisitorExport struct {
+	DomainID   primitive.ObjectID `json:"domain_id"`
+	VisitorID  string             `json:"visitor_id"`
+	ExportedAt time.Time          `json:"exported_at"`
+	Events     []*Event           `json:"events"`
+	Errors     []*ErrorEvent      `json:"errors"`
+	Purchases  []*Purchase        `json:"purchases"`
+}
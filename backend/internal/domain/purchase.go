@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Purchase struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	DomainID    primitive.ObjectID `bson:"domain_id" json:"domain_id"`
+	OrderID     string             `bson:"order_id" json:"order_id"`
+	Currency    string             `bson:"currency" json:"currency"`
+	Total       float64            `bson:"total" json:"total"`
+	Items       []LineItem         `bson:"items" json:"items"`
+	VisitorID   string             `bson:"visitor_id" json:"visitor_id"`
+	Source      string             `bson:"source" json:"source"`
+	Campaign    string             `bson:"campaign" json:"campaign"`
+	LandingPage string             `bson:"landing_page" json:"landing_page"`
+	Timestamp   time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+type LineItem struct {
+	SKU      string  `bson:"sku" json:"sku" binding:"required"`
+	Name     string  `bson:"name" json:"name"`
+	Quantity int     `bson:"quantity" json:"quantity" binding:"min=1"`
+	Price    float64 `bson:"price" json:"price" binding:"min=0"`
+}
+
+type TrackPurchaseRequest struct {
+	OrderID     string     `json:"order_id" binding:"required"`
+	Currency    string     `json:"currency" binding:"required,len=3"`
+	Total       float64    `json:"total" binding:"min=0"`
+	Items       []LineItem `json:"items" binding:"dive"`
+	VisitorID   string     `json:"visitor_id"`
+	Referrer    string     `json:"referrer"`
+	Source      string     `json:"source"`
+	Campaign    string     `json:"campaign"`
+	LandingPage string     `json:"landing_page"`
+	// Consent and PrivacySignal apply the domain's privacy settings as for
+	// page views
+	Consent       *bool `json:"consent"`
+	PrivacySignal bool  `json:"-"`
+}
+
+type RevenueStats struct {
+	Currency          string             `json:"currency"`
+	Revenue           float64            `json:"revenue"`
+	Orders            int64              `json:"orders"`
+	AverageOrderValue float64            `json:"average_order_value"`
+	BySource          []RevenueBreakdown `json:"by_source"`
+	ByCampaign        []RevenueBreakdown `json:"by_campaign"`
+	ByLandingPage     []RevenueBreakdown `json:"by_landing_page"`
+}
+
+type RevenueBreakdown struct {
+	Key     string  `bson:"_id" json:"key"`
+	Revenue float64 `bson:"revenue" json:"revenue"`
+	Orders  int64   `bson:"orders" json:"orders"`
+}
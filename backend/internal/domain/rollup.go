@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ImportSourceGoogleAnalytics = "google_analytics"
+	ImportSourcePlausible       = "plausible"
+)
+
+// DailyRollup summarises one UTC day of traffic for a domain. Rollups are
+// kept after the raw events they were built from have been purged.
+//
+// Imported rollups hold history brought in from another analytics tool. They
+// are stored alongside, never merged into, rollups built from our own events.
+type DailyRollup struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	DomainID     primitive.ObjectID `bson:"domain_id" json:"domain_id"`
+	Date         time.Time          `bson:"date" json:"date"`
+	Pageviews    int64              `bson:"pageviews" json:"pageviews"`
+	Visitors     int64              `bson:"visitors" json:"visitors"`
+	Pages        []PageStats        `bson:"pages" json:"pages"`
+	Referrers    []ReferrerStats    `bson:"referrers" json:"referrers"`
+	Countries    map[string]int     `bson:"countries" json:"countries"`
+	Devices      map[string]int     `bson:"devices" json:"devices"`
+	Browsers     map[string]int     `bson:"browsers" json:"browsers"`
+	Imported     bool               `bson:"imported" json:"imported"`
+	ImportSource string             `bson:"import_source,omitempty" json:"import_source,omitempty"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// VisitorSketch is the day's unique visitor HyperLogLog as Redis stores
+	// it, so unique counts over past days survive the Redis keys expiring.
+	// Imported rollups have none.
+	VisitorSketch []byte `bson:"visitor_sketch,omitempty" json:"-"`
+}
+
+// ImportResult summarises an import of historical data.
+type ImportResult struct {
+	Source    string   `json:"source"`
+	Files     []string `json:"files"`
+	Days      int      `json:"days"`
+	FirstDay  string   `json:"first_day,omitempty"`
+	LastDay   string   `json:"last_day,omitempty"`
+	Pageviews int64    `json:"pageviews"`
+}
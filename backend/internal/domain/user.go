@@ -16,6 +16,35 @@ type User struct {
 	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanEnterprise = "enterprise"
+)
+
+// PlanLimits bounds what a user's domains may be configured with.
+type PlanLimits struct {
+	// MaxRetentionDays caps how long raw events may be kept.
+	MaxRetentionDays int
+	// RollupRetentionDays is how long daily rollups built from tracked
+	// events are kept. Imported rollups are kept for good.
+	RollupRetentionDays int
+}
+
+var planLimits = map[string]PlanLimits{
+	PlanFree:       {MaxRetentionDays: 30, RollupRetentionDays: 365},
+	PlanPro:        {MaxRetentionDays: 365, RollupRetentionDays: 3 * 365},
+	PlanEnterprise: {MaxRetentionDays: 3 * 365, RollupRetentionDays: 10 * 365},
+}
+
+// LimitsForPlan returns the limits of plan, treating unknown plans as free.
+func LimitsForPlan(plan string) PlanLimits {
+	if limits, ok := planLimits[plan]; ok {
+		return limits
+	}
+	return planLimits[PlanFree]
+}
+
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AlertHandler struct {
+	alertService *service.AlertService
+}
+
+func NewAlertHandler(alertService *service.AlertService) *AlertHandler {
+	return &AlertHandler{alertService: alertService}
+}
+
+func (h *AlertHandler) List(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+
+	rules, err := h.alertService.List(c.Request.Context(), userID, domainID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *AlertHandler) Create(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	var req domain.CreateAlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.alertService.Create(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *AlertHandler) Update(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	id, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+	var req domain.UpdateAlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.alertService.Update(c.Request.Context(), userID, id, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *AlertHandler) Delete(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	id, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+	if err := h.alertService.Delete(c.Request.Context(), userID, id); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *AlertHandler) ListDeliveries(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	id, _ := primitive.ObjectIDFromHex(c.Param("id"))
+
+	deliveries, err := h.alertService.ListDeliveries(c.Request.Context(), userID, id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func (h *AlertHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrDomainNotFound), errors.Is(err, service.ErrAlertRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidAlertRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
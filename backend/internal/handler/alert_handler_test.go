@@ -0,0 +1,46 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/handler"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAlertRulesListChecksDomainID(t *testing.T) {
+	domains := memory.NewDomainRepository()
+	alerts := service.NewAlertService(memory.NewAlertRuleRepository(), memory.NewAlertDeliveryRepository(), domains,
+		nil, cache.NewMemoryCache(), discardLogger(), false)
+	router := newUserRouter()
+	router.GET("/api/alerts", handler.NewAlertHandler(alerts).List)
+
+	owner := primitive.NewObjectID()
+	d := &domain.Domain{UserID: owner, Domain: "example.com"}
+	if err := domains.Create(context.Background(), d); err != nil {
+		t.Fatalf("creating domain: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     primitive.ObjectID
+		domainID string
+		want     int
+	}{
+		{"owner", owner, d.ID.Hex(), http.StatusOK},
+		{"another user", primitive.NewObjectID(), d.ID.Hex(), http.StatusNotFound},
+		{"invalid domain_id", owner, "not-an-id", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := serve(router, http.MethodGet, "/api/alerts?domain_id="+tt.domainID, nil,
+			map[string]string{"X-Test-User": tt.user.Hex()})
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (body %s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
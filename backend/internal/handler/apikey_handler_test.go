@@ -0,0 +1,69 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/handler"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newAPIKeyRouter mounts the API key handlers behind a stand-in for the auth
+// middleware that authenticates every request as the user in X-Test-User.
+func newAPIKeyRouter() *gin.Engine {
+	h := handler.NewAPIKeyHandler(service.NewAPIKeyService(memory.NewAPIKeyRepository()))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-Test-User"))
+		c.Next()
+	})
+	router.GET("/api/api-keys", h.List)
+	router.POST("/api/api-keys", h.Create)
+	router.DELETE("/api/api-keys/:id", h.Revoke)
+	return router
+}
+
+func TestAPIKeyHandler(t *testing.T) {
+	router := newAPIKeyRouter()
+	alice := map[string]string{"X-Test-User": primitive.NewObjectID().Hex()}
+	bob := map[string]string{"X-Test-User": primitive.NewObjectID().Hex()}
+	domainID := primitive.NewObjectID()
+
+	w := serve(router, http.MethodPost, "/api/api-keys", gin.H{"domain_ids": []string{domainID.Hex()}}, alice)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201 (body %s)", w.Code, w.Body.String())
+	}
+	var created domain.APIKey
+	decode(t, w, &created)
+	if created.Key == "" || len(created.DomainIDs) != 1 || created.DomainIDs[0] != domainID {
+		t.Errorf("created = %+v", created)
+	}
+
+	if w := serve(router, http.MethodPost, "/api/api-keys", gin.H{"domain_ids": "not-a-list"}, alice); w.Code != http.StatusBadRequest {
+		t.Errorf("create with bad body: status = %d, want 400", w.Code)
+	}
+
+	var keys []domain.APIKey
+	decode(t, serve(router, http.MethodGet, "/api/api-keys", nil, alice), &keys)
+	if len(keys) != 1 || keys[0].ID != created.ID {
+		t.Errorf("alice's keys = %+v, want the created key", keys)
+	}
+	decode(t, serve(router, http.MethodGet, "/api/api-keys", nil, bob), &keys)
+	if len(keys) != 0 {
+		t.Errorf("bob sees %d of alice's keys", len(keys))
+	}
+
+	w = serve(router, http.MethodDelete, "/api/api-keys/"+created.ID.Hex(), nil, alice)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: status = %d, want 204", w.Code)
+	}
+	decode(t, serve(router, http.MethodGet, "/api/api-keys", nil, alice), &keys)
+	if len(keys) != 1 || !keys[0].Revoked {
+		t.Errorf("after revoke keys = %+v, want the key marked revoked", keys)
+	}
+}
@@ -0,0 +1,83 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/handler"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+)
+
+func newAuthRouter() *gin.Engine {
+	authService := service.NewAuthService(memory.NewUserRepository(), "test-secret-that-is-long-enough-for-hs256", time.Hour, 24*time.Hour)
+	h := handler.NewAuthHandler(authService)
+
+	router := gin.New()
+	router.POST("/api/auth/register", h.Register)
+	router.POST("/api/auth/login", h.Login)
+	return router
+}
+
+func TestAuthHandlerRegisterAndLogin(t *testing.T) {
+	router := newAuthRouter()
+	credentials := gin.H{"email": "ada@example.com", "password": "correct horse"}
+
+	w := serve(router, http.MethodPost, "/api/auth/register", credentials, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: status = %d, want 201 (body %s)", w.Code, w.Body.String())
+	}
+	var registered domain.AuthResponse
+	decode(t, w, &registered)
+	if registered.Token == "" || registered.RefreshToken == "" || registered.User.Email != "ada@example.com" {
+		t.Errorf("register response = %+v", registered)
+	}
+	if body := w.Body.String(); strings.Contains(body, "password_hash") || strings.Contains(body, "$2a$") {
+		t.Errorf("register response leaks the password hash: %s", body)
+	}
+
+	if w := serve(router, http.MethodPost, "/api/auth/register", credentials, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("duplicate register: status = %d, want 400", w.Code)
+	}
+
+	w = serve(router, http.MethodPost, "/api/auth/login", credentials, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	var loggedIn domain.AuthResponse
+	decode(t, w, &loggedIn)
+	if loggedIn.User.ID != registered.User.ID {
+		t.Errorf("logged in as %s, want %s", loggedIn.User.ID.Hex(), registered.User.ID.Hex())
+	}
+
+	wrong := gin.H{"email": "ada@example.com", "password": "battery staple"}
+	if w := serve(router, http.MethodPost, "/api/auth/login", wrong, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want 401", w.Code)
+	}
+}
+
+func TestAuthHandlerValidation(t *testing.T) {
+	router := newAuthRouter()
+
+	tests := []struct {
+		name string
+		path string
+		body gin.H
+	}{
+		{name: "register without email", path: "/api/auth/register", body: gin.H{"password": "correct horse"}},
+		{name: "register with bad email", path: "/api/auth/register", body: gin.H{"email": "ada", "password": "correct horse"}},
+		{name: "register with short password", path: "/api/auth/register", body: gin.H{"email": "ada@example.com", "password": "short"}},
+		{name: "login without password", path: "/api/auth/login", body: gin.H{"email": "ada@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(router, http.MethodPost, tt.path, tt.body, nil); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+		})
+	}
+}
@@ -2,7 +2,7 @@ package handler
 
 import (
 	"bytes"
-	"fmt"
+	"log/slog"
 	"net/http"
 	"text/template"
 
@@ -12,12 +12,14 @@ import (
 )
 
 type BadgeHandler struct {
-	trackingService *service.TrackingService
+	statsService *service.StatsService
+	logger       *slog.Logger
 }
 
-func NewBadgeHandler(trackingService *service.TrackingService) *BadgeHandler {
+func NewBadgeHandler(statsService *service.StatsService, logger *slog.Logger) *BadgeHandler {
 	return &BadgeHandler{
-		trackingService: trackingService,
+		statsService: statsService,
+		logger:       logger,
 	}
 }
 
@@ -36,10 +38,10 @@ func (h *BadgeHandler) GetLiveBadge(c *gin.Context) {
 		return
 	}
 
-	count, err := h.trackingService.GetActiveVisitorCount(c.Request.Context(), domainID)
+	count, err := h.statsService.GetActiveVisitorCount(c.Request.Context(), domainID)
 	if err != nil {
 		// Log error but display 0
-		fmt.Printf("Error getting active count for badge: %v\n", err)
+		h.logger.WarnContext(c.Request.Context(), "failed to get active count for badge", "domain_id", domainIDStr, "error", err)
 		count = 0
 	}
 
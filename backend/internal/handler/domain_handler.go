@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -71,6 +72,10 @@ func (h *DomainHandler) Update(c *gin.Context) {
 	}
 
 	d, err := h.domainService.Update(c.Request.Context(), id, &req)
+	if errors.Is(err, service.ErrRetentionExceedsPlan) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
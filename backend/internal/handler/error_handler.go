@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ErrorHandler struct {
+	errorService *service.ErrorService
+}
+
+func NewErrorHandler(errorService *service.ErrorService) *ErrorHandler {
+	return &ErrorHandler{errorService: errorService}
+}
+
+func (h *ErrorHandler) ListIssues(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days"})
+		return
+	}
+
+	issues, err := h.errorService.ListIssues(c.Request.Context(), userID, domainID, days)
+	if errors.Is(err, service.ErrDomainNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, issues)
+}
@@ -0,0 +1,51 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/handler"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestListIssuesChecksOwnership(t *testing.T) {
+	domains := memory.NewDomainRepository()
+	errorRepo := memory.NewErrorRepository()
+	h := handler.NewErrorHandler(service.NewErrorService(domains, errorRepo))
+
+	router := newUserRouter()
+	router.GET("/api/errors", h.ListIssues)
+
+	owner := primitive.NewObjectID()
+	d := &domain.Domain{UserID: owner, Domain: "example.com"}
+	if err := domains.Create(context.Background(), d); err != nil {
+		t.Fatalf("creating domain: %v", err)
+	}
+	event := &domain.ErrorEvent{DomainID: d.ID, Message: "TypeError: x is undefined", Fingerprint: "abc"}
+	if err := errorRepo.Create(context.Background(), event); err != nil {
+		t.Fatalf("creating error event: %v", err)
+	}
+
+	w := serve(router, http.MethodGet, "/api/errors?domain_id="+d.ID.Hex(), nil, map[string]string{"X-Test-User": owner.Hex()})
+	if w.Code != http.StatusOK {
+		t.Fatalf("owner: status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	var issues []domain.ErrorIssue
+	decode(t, w, &issues)
+	if len(issues) != 1 {
+		t.Errorf("owner sees %d issues, want 1", len(issues))
+	}
+
+	w = serve(router, http.MethodGet, "/api/errors?domain_id="+d.ID.Hex(), nil, map[string]string{"X-Test-User": primitive.NewObjectID().Hex()})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("another user: status = %d, want 404 (body %s)", w.Code, w.Body.String())
+	}
+	w = serve(router, http.MethodGet, "/api/errors?domain_id=nope", nil, map[string]string{"X-Test-User": owner.Hex()})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid domain_id: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ExportHandler struct {
+	exportService *service.ExportService
+}
+
+func NewExportHandler(exportService *service.ExportService) *ExportHandler {
+	return &ExportHandler{exportService: exportService}
+}
+
+var eventColumns = []string{"timestamp", "path", "referrer", "country", "device", "browser", "visitor_id", "user_agent"}
+
+var breakdownColumns = []string{"key", "hits", "visitors"}
+
+func (h *ExportHandler) ExportEvents(c *gin.Context) {
+	domainID, from, to, format, ok := h.parseRequest(c, "")
+	if !ok {
+		return
+	}
+
+	out := newExportWriter(c, format, fmt.Sprintf("events-%s", domainID.Hex()), eventColumns)
+	err := h.exportService.StreamEvents(c.Request.Context(), domainID, from, to, func(e *domain.Event) error {
+		return out.write(e, []string{
+			e.Timestamp.UTC().Format(time.RFC3339),
+			e.Path,
+			e.Referrer,
+			e.Country,
+			e.Device,
+			e.Browser,
+			e.VisitorID,
+			e.UserAgent,
+		})
+	})
+	out.finish(err)
+}
+
+func (h *ExportHandler) ExportReport(c *gin.Context) {
+	report := c.Param("report")
+	domainID, from, to, format, ok := h.parseRequest(c, report)
+	if !ok {
+		return
+	}
+
+	out := newExportWriter(c, format, fmt.Sprintf("%s-%s", report, domainID.Hex()), breakdownColumns)
+	err := h.exportService.StreamReport(c.Request.Context(), domainID, report, from, to, func(row *domain.BreakdownRow) error {
+		return out.write(row, []string{
+			row.Key,
+			strconv.FormatInt(row.Hits, 10),
+			strconv.FormatInt(row.Visitors, 10),
+		})
+	})
+	out.finish(err)
+}
+
+// parseRequest validates the query and access rights before anything is
+// streamed. Dates are inclusive UTC days and default to the last 30 days.
+func (h *ExportHandler) parseRequest(c *gin.Context, report string) (primitive.ObjectID, time.Time, time.Time, string, bool) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return domainID, time.Time{}, time.Time{}, "", false
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return domainID, time.Time{}, time.Time{}, "", false
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, err := parseDay(c.Query("from"), today.AddDate(0, 0, -29))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+		return domainID, time.Time{}, time.Time{}, "", false
+	}
+	to, err := parseDay(c.Query("to"), today)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+		return domainID, time.Time{}, time.Time{}, "", false
+	}
+
+	if err := h.exportService.CheckAccess(c.Request.Context(), userID, domainID, report); err != nil {
+		if errors.Is(err, service.ErrDomainNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return domainID, time.Time{}, time.Time{}, "", false
+	}
+
+	return domainID, from, to.AddDate(0, 0, 1), format, true
+}
+
+func parseDay(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// exportWriter streams rows as CSV or NDJSON, flushing as it goes.
+type exportWriter struct {
+	c       *gin.Context
+	csv     *csv.Writer
+	json    *json.Encoder
+	rows    int
+	started bool
+	columns []string
+}
+
+func newExportWriter(c *gin.Context, format, filename string, columns []string) *exportWriter {
+	w := &exportWriter{c: c, columns: columns}
+	if format == "ndjson" {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.ndjson", filename))
+		w.json = json.NewEncoder(c.Writer)
+	} else {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+		w.csv = csv.NewWriter(c.Writer)
+	}
+	c.Status(http.StatusOK)
+	return w
+}
+
+func (w *exportWriter) write(value interface{}, record []string) error {
+	if w.csv != nil {
+		if !w.started {
+			w.started = true
+			if err := w.csv.Write(w.columns); err != nil {
+				return err
+			}
+		}
+		if err := w.csv.Write(record); err != nil {
+			return err
+		}
+	} else if err := w.json.Encode(value); err != nil {
+		return err
+	}
+
+	w.rows++
+	if w.rows%1000 == 0 {
+		w.flush()
+	}
+	return nil
+}
+
+func (w *exportWriter) finish(err error) {
+	// An empty CSV still gets its header row
+	if w.csv != nil && !w.started {
+		w.csv.Write(w.columns)
+	}
+	w.flush()
+
+	if err != nil {
+		// Headers are already sent; the truncated body is all we can signal.
+		// The error still reaches the access log.
+		w.c.Error(fmt.Errorf("export aborted after %d rows: %w", w.rows, err))
+		w.c.Abort()
+	}
+}
+
+func (w *exportWriter) flush() {
+	if w.csv != nil {
+		w.csv.Flush()
+	}
+	w.c.Writer.Flush()
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/service"
+	"github.com/nesohq/backend/internal/version"
+)
+
+type HealthHandler struct {
+	healthService *service.HealthService
+}
+
+func NewHealthHandler(healthService *service.HealthService) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// Liveness only reports that the process is serving requests. It never
+// checks dependencies, so an outage elsewhere doesn't get pods restarted.
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "version": version.String()})
+}
+
+// Readiness returns 503 when any dependency is down so the orchestrator stops
+// routing traffic here.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report, ready := h.healthService.Check(c.Request.Context())
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxImportSize bounds the total size of an import upload.
+const maxImportSize = 64 << 20
+
+type ImportHandler struct {
+	importService *service.ImportService
+}
+
+func NewImportHandler(importService *service.ImportService) *ImportHandler {
+	return &ImportHandler{importService: importService}
+}
+
+func (h *ImportHandler) Import(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+	source := c.Query("source")
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var files []service.ImportFile
+	for _, header := range form.File["files"] {
+		f, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		files = append(files, service.ImportFile{Name: header.Filename, Data: data})
+	}
+
+	result, err := h.importService.ImportForUser(c.Request.Context(), userID, domainID, source, files)
+	if errors.Is(err, service.ErrDomainNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PrivacyHandler struct {
+	privacyService *service.PrivacyService
+}
+
+func NewPrivacyHandler(privacyService *service.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{privacyService: privacyService}
+}
+
+func (h *PrivacyHandler) ExportVisitor(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+	visitorID := c.Param("visitor_id")
+
+	export, err := h.privacyService.ExportVisitor(c.Request.Context(), userID, domainID, visitorID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=visitor-%s.json", visitorID))
+	c.JSON(http.StatusOK, export)
+}
+
+func (h *PrivacyHandler) EraseVisitor(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+	visitorID := c.Param("visitor_id")
+
+	record, err := h.privacyService.EraseVisitor(c.Request.Context(), userID, domainID, visitorID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+func (h *PrivacyHandler) ListRequests(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+
+	requests, err := h.privacyService.ListRequests(c.Request.Context(), userID, domainID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+func (h *PrivacyHandler) writeError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrDomainNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
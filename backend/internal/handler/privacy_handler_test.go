@@ -0,0 +1,63 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/handler"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/repository"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// unavailableDomains fails every lookup, as a store that cannot be reached.
+type unavailableDomains struct {
+	repository.DomainStore
+}
+
+func (unavailableDomains) FindByID(context.Context, primitive.ObjectID) (*domain.Domain, error) {
+	return nil, errors.New("server selection timeout")
+}
+
+func TestPrivacyRequestsTellMissingDomainsFromOutages(t *testing.T) {
+	domains := memory.NewDomainRepository()
+	owner := primitive.NewObjectID()
+	d := &domain.Domain{UserID: owner, Domain: "example.com"}
+	if err := domains.Create(context.Background(), d); err != nil {
+		t.Fatalf("creating domain: %v", err)
+	}
+
+	newRouter := func(domains repository.DomainStore) http.Handler {
+		privacy := service.NewPrivacyService(domains, memory.NewEventRepository(), memory.NewErrorRepository(),
+			memory.NewPurchaseRepository(), memory.NewPrivacyRequestRepository(), nil, cache.NewMemoryCache())
+		router := newUserRouter()
+		router.GET("/api/privacy/requests", handler.NewPrivacyHandler(privacy).ListRequests)
+		return router
+	}
+
+	tests := []struct {
+		name     string
+		domains  repository.DomainStore
+		user     primitive.ObjectID
+		domainID string
+		want     int
+	}{
+		{"owner", domains, owner, d.ID.Hex(), http.StatusOK},
+		{"another user", domains, primitive.NewObjectID(), d.ID.Hex(), http.StatusNotFound},
+		{"missing domain", domains, owner, primitive.NewObjectID().Hex(), http.StatusNotFound},
+		{"invalid domain_id", domains, owner, "not-an-id", http.StatusBadRequest},
+		{"store unavailable", unavailableDomains{domains}, owner, d.ID.Hex(), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := serve(newRouter(tt.domains), http.MethodGet, "/api/privacy/requests?domain_id="+tt.domainID, nil,
+			map[string]string{"X-Test-User": tt.user.Hex()})
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (body %s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
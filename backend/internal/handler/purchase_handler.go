@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PurchaseHandler struct {
+	purchaseService *service.PurchaseService
+}
+
+func NewPurchaseHandler(purchaseService *service.PurchaseService) *PurchaseHandler {
+	return &PurchaseHandler{purchaseService: purchaseService}
+}
+
+func (h *PurchaseHandler) GetRevenueStats(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+	currency := c.DefaultQuery("currency", "USD")
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days"})
+		return
+	}
+
+	stats, err := h.purchaseService.GetRevenueStats(c.Request.Context(), userID, domainID, currency, days)
+	if errors.Is(err, service.ErrDomainNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
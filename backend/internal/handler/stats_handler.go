@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type StatsHandler struct {
+	statsService *service.StatsService
+}
+
+func NewStatsHandler(statsService *service.StatsService) *StatsHandler {
+	return &StatsHandler{statsService: statsService}
+}
+
+func (h *StatsHandler) GetRealtimeStats(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.statsService.GetRealtimeStats(c.Request.Context(), userID, domainID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetLiveView lists where the domain's active visitors are right now.
+func (h *StatsHandler) GetLiveView(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+
+	view, err := h.statsService.GetLiveView(c.Request.Context(), userID, domainID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// GetOverviewStats counts unique visitors over the last 24 hours, or over the
+// inclusive UTC days from and to when either is given, at most 366 days.
+func (h *StatsHandler) GetOverviewStats(c *gin.Context) {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	domainID, ok := domainIDQuery(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	from, to := now.Add(-24*time.Hour), now
+	if c.Query("from") != "" || c.Query("to") != "" {
+		today := now.UTC().Truncate(24 * time.Hour)
+		var err error
+		if from, err = parseDay(c.Query("from"), today.AddDate(0, 0, -29)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return
+		}
+		if to, err = parseDay(c.Query("to"), today); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	stats, err := h.statsService.GetOverviewStats(c.Request.Context(), userID, domainID, from, to)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *StatsHandler) writeError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrDomainNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrRangeTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// domainIDQuery parses the domain_id query parameter, answering 400 if it is
+// not a valid id.
+func domainIDQuery(c *gin.Context) (primitive.ObjectID, bool) {
+	domainID, err := primitive.ObjectIDFromHex(c.Query("domain_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain_id"})
+		return primitive.NilObjectID, false
+	}
+	return domainID, true
+}
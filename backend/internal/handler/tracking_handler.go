@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/metrics"
 	"github.com/nesohq/backend/internal/service"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -12,73 +15,152 @@ import (
 type TrackingHandler struct {
 	trackingService *service.TrackingService
 	apiKeyService   *service.APIKeyService
+	logger          *slog.Logger
 }
 
-func NewTrackingHandler(trackingService *service.TrackingService, apiKeyService *service.APIKeyService) *TrackingHandler {
+func NewTrackingHandler(trackingService *service.TrackingService, apiKeyService *service.APIKeyService, logger *slog.Logger) *TrackingHandler {
 	return &TrackingHandler{
 		trackingService: trackingService,
 		apiKeyService:   apiKeyService,
+		logger:          logger,
 	}
 }
 
-func (h *TrackingHandler) Track(c *gin.Context) {
+// Kinds of tracking hit, used to label ingestion metrics.
+const (
+	kindPageview = "pageview"
+	kindError    = "error"
+	kindPurchase = "purchase"
+)
+
+// trackingDomainID resolves the domain an ingestion request belongs to from
+// its X-API-Key header. It writes the error response itself and reports
+// whether the caller should continue.
+func trackingDomainID(c *gin.Context, apiKeyService *service.APIKeyService, kind string) (primitive.ObjectID, bool) {
 	apiKey := c.GetHeader("X-API-Key")
 	if apiKey == "" {
+		metrics.EventsRejected.WithLabelValues(kind, metrics.RejectMissingKey).Inc()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
-		return
+		return primitive.NilObjectID, false
 	}
 
 	// Validate API key
-	key, err := h.apiKeyService.Validate(c.Request.Context(), apiKey)
+	key, err := apiKeyService.Validate(c.Request.Context(), apiKey)
 	if err != nil {
+		metrics.EventsRejected.WithLabelValues(kind, metrics.RejectBadKey).Inc()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		return primitive.NilObjectID, false
+	}
+
+	// Get domain ID (use first domain for now)
+	if len(key.DomainIDs) == 0 {
+		metrics.EventsRejected.WithLabelValues(kind, metrics.RejectNoDomain).Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no domains associated with API key"})
+		return primitive.NilObjectID, false
+	}
+
+	return key.DomainIDs[0], true
+}
+
+func (h *TrackingHandler) Track(c *gin.Context) {
+	domainID, ok := trackingDomainID(c, h.apiKeyService, kindPageview)
+	if !ok {
 		return
 	}
 
 	var req domain.TrackRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		metrics.EventsRejected.WithLabelValues(kindPageview, metrics.RejectInvalidPayload).Inc()
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get domain ID (use first domain for now)
-	if len(key.DomainIDs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no domains associated with API key"})
-		return
-	}
-
-	domainID := key.DomainIDs[0]
 	ip := c.ClientIP()
 	userAgent := c.GetHeader("User-Agent")
+	req.PrivacySignal = privacySignal(c)
 
 	if err := h.trackingService.Track(c.Request.Context(), domainID, &req, ip, userAgent); err != nil {
+		if errors.Is(err, service.ErrTrackingDropped) {
+			metrics.EventsRejected.WithLabelValues(kindPageview, metrics.RejectPrivacyPolicy).Inc()
+			c.JSON(http.StatusOK, gin.H{"status": "dropped"})
+			return
+		}
+		if errors.Is(err, service.ErrRateLimited) {
+			metrics.EventsRejected.WithLabelValues(kindPageview, metrics.RejectRateLimit).Inc()
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.ErrorContext(c.Request.Context(), "failed to track hit", "kind", kindPageview, "domain_id", domainID.Hex(), "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	metrics.EventsIngested.WithLabelValues(domainID.Hex(), kindPageview).Inc()
 	c.JSON(http.StatusOK, gin.H{"status": "tracked"})
 }
 
-func (h *TrackingHandler) GetRealtimeStats(c *gin.Context) {
-	domainID, _ := primitive.ObjectIDFromHex(c.Query("domain_id"))
+func (h *TrackingHandler) TrackError(c *gin.Context) {
+	domainID, ok := trackingDomainID(c, h.apiKeyService, kindError)
+	if !ok {
+		return
+	}
+
+	var req domain.TrackErrorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		metrics.EventsRejected.WithLabelValues(kindError, metrics.RejectInvalidPayload).Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	stats, err := h.trackingService.GetRealtimeStats(c.Request.Context(), domainID)
-	if err != nil {
+	req.PrivacySignal = privacySignal(c)
+
+	if err := h.trackingService.TrackError(c.Request.Context(), domainID, &req, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+		if errors.Is(err, service.ErrTrackingDropped) {
+			metrics.EventsRejected.WithLabelValues(kindError, metrics.RejectPrivacyPolicy).Inc()
+			c.JSON(http.StatusOK, gin.H{"status": "dropped"})
+			return
+		}
+		h.logger.ErrorContext(c.Request.Context(), "failed to track hit", "kind", kindError, "domain_id", domainID.Hex(), "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, stats)
+	metrics.EventsIngested.WithLabelValues(domainID.Hex(), kindError).Inc()
+	c.JSON(http.StatusOK, gin.H{"status": "tracked"})
 }
 
-func (h *TrackingHandler) GetOverviewStats(c *gin.Context) {
-	domainID, _ := primitive.ObjectIDFromHex(c.Query("domain_id"))
+func (h *TrackingHandler) TrackPurchase(c *gin.Context) {
+	domainID, ok := trackingDomainID(c, h.apiKeyService, kindPurchase)
+	if !ok {
+		return
+	}
 
-	stats, err := h.trackingService.GetOverviewStats(c.Request.Context(), domainID)
-	if err != nil {
+	var req domain.TrackPurchaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		metrics.EventsRejected.WithLabelValues(kindPurchase, metrics.RejectInvalidPayload).Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.PrivacySignal = privacySignal(c)
+
+	if err := h.trackingService.TrackPurchase(c.Request.Context(), domainID, &req, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+		if errors.Is(err, service.ErrTrackingDropped) {
+			metrics.EventsRejected.WithLabelValues(kindPurchase, metrics.RejectPrivacyPolicy).Inc()
+			c.JSON(http.StatusOK, gin.H{"status": "dropped"})
+			return
+		}
+		h.logger.ErrorContext(c.Request.Context(), "failed to track hit", "kind", kindPurchase, "domain_id", domainID.Hex(), "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, stats)
+	metrics.EventsIngested.WithLabelValues(domainID.Hex(), kindPurchase).Inc()
+	c.JSON(http.StatusOK, gin.H{"status": "tracked"})
+}
+
+// privacySignal reports whether the request carries a DNT or Global Privacy
+// Control signal.
+func privacySignal(c *gin.Context) bool {
+	return c.GetHeader("DNT") == "1" || c.GetHeader("Sec-GPC") == "1"
 }
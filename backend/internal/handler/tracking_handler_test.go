@@ -0,0 +1,258 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/handler"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/infrastructure/queue"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type trackingFixture struct {
+	router  *gin.Engine
+	domains *memory.DomainRepository
+	keys    *memory.APIKeyRepository
+	queue   *queue.MemoryQueue
+}
+
+func newTrackingFixture() *trackingFixture {
+	f := &trackingFixture{
+		domains: memory.NewDomainRepository(),
+		keys:    memory.NewAPIKeyRepository(),
+		queue:   queue.NewMemoryQueue(),
+	}
+	memoryCache := cache.NewMemoryCache()
+	uniques := service.NewUniqueVisitorService(memoryCache, memory.NewRollupRepository())
+	trackingService := service.NewTrackingService(f.domains, memoryCache, f.queue, uniques, time.Hour)
+	apiKeyService := service.NewAPIKeyService(f.keys)
+	h := handler.NewTrackingHandler(trackingService, apiKeyService, discardLogger())
+
+	f.router = gin.New()
+	f.router.POST("/api/track", h.Track)
+	f.router.POST("/api/track/error", h.TrackError)
+	f.router.POST("/api/track/purchase", h.TrackPurchase)
+	return f
+}
+
+// addKey stores a domain with the given privacy policy and an API key for
+// it, returning the key.
+func (f *trackingFixture) addKey(t *testing.T, policy string) string {
+	t.Helper()
+	ctx := context.Background()
+	d := &domain.Domain{Domain: "example.com", Settings: domain.DomainSettings{PrivacySignalPolicy: policy}}
+	if err := f.domains.Create(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	key := &domain.APIKey{Key: "hrd_" + d.ID.Hex(), DomainIDs: []primitive.ObjectID{d.ID}}
+	if err := f.keys.Create(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	return key.Key
+}
+
+func TestTrackHandler(t *testing.T) {
+	pageview := gin.H{"path": "/", "visitor_id": "v1"}
+
+	tests := []struct {
+		name       string
+		key        func(t *testing.T, f *trackingFixture) string
+		headers    map[string]string
+		body       interface{}
+		queueErr   error
+		wantStatus int
+		wantBody   string
+		wantQueued int
+	}{
+		{
+			name:       "tracked",
+			key:        func(t *testing.T, f *trackingFixture) string { return f.addKey(t, domain.PrivacyPolicyTrack) },
+			body:       pageview,
+			wantStatus: http.StatusOK,
+			wantBody:   "tracked",
+			wantQueued: 1,
+		},
+		{
+			name:       "missing key",
+			key:        func(t *testing.T, f *trackingFixture) string { return "" },
+			body:       pageview,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown key",
+			key:        func(t *testing.T, f *trackingFixture) string { return "hrd_nope" },
+			body:       pageview,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "revoked key",
+			key: func(t *testing.T, f *trackingFixture) string {
+				key := f.addKey(t, domain.PrivacyPolicyTrack)
+				stored, _ := f.keys.FindByKey(context.Background(), key)
+				f.keys.Revoke(context.Background(), stored.ID)
+				return key
+			},
+			body:       pageview,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "key without domains",
+			key: func(t *testing.T, f *trackingFixture) string {
+				key := &domain.APIKey{Key: "hrd_nodomains"}
+				f.keys.Create(context.Background(), key)
+				return key.Key
+			},
+			body:       pageview,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing path",
+			key:        func(t *testing.T, f *trackingFixture) string { return f.addKey(t, domain.PrivacyPolicyTrack) },
+			body:       gin.H{"visitor_id": "v1"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "global privacy control with drop policy",
+			key:        func(t *testing.T, f *trackingFixture) string { return f.addKey(t, domain.PrivacyPolicyDrop) },
+			headers:    map[string]string{"Sec-GPC": "1"},
+			body:       pageview,
+			wantStatus: http.StatusOK,
+			wantBody:   "dropped",
+		},
+		{
+			name:       "do not track with drop policy",
+			key:        func(t *testing.T, f *trackingFixture) string { return f.addKey(t, domain.PrivacyPolicyDrop) },
+			headers:    map[string]string{"DNT": "1"},
+			body:       pageview,
+			wantStatus: http.StatusOK,
+			wantBody:   "dropped",
+		},
+		{
+			name: "rate limited",
+			key: func(t *testing.T, f *trackingFixture) string {
+				key := f.addKey(t, domain.PrivacyPolicyTrack)
+				stored, _ := f.keys.FindByKey(context.Background(), key)
+				d, _ := f.domains.FindByID(context.Background(), stored.DomainIDs[0])
+				d.Settings.RateLimit = 1
+				f.domains.Update(context.Background(), d)
+				serve(f.router, http.MethodPost, "/api/track", pageview, map[string]string{"X-API-Key": key})
+				return key
+			},
+			body:       pageview,
+			wantStatus: http.StatusTooManyRequests,
+			wantQueued: 1,
+		},
+		{
+			name:       "queue unavailable",
+			key:        func(t *testing.T, f *trackingFixture) string { return f.addKey(t, domain.PrivacyPolicyTrack) },
+			body:       pageview,
+			queueErr:   errors.New("nats: timeout"),
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTrackingFixture()
+			headers := map[string]string{"User-Agent": "Mozilla/5.0 Firefox/121.0"}
+			if key := tt.key(t, f); key != "" {
+				headers["X-API-Key"] = key
+			}
+			for k, v := range tt.headers {
+				headers[k] = v
+			}
+			f.queue.FailWith(tt.queueErr)
+
+			w := serve(f.router, http.MethodPost, "/api/track", tt.body, headers)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			var body map[string]string
+			decode(t, w, &body)
+			if tt.wantBody != "" && body["status"] != tt.wantBody {
+				t.Errorf("status = %q, want %q", body["status"], tt.wantBody)
+			}
+			if tt.wantBody == "" && body["error"] == "" {
+				t.Errorf("body = %v, want an error message", body)
+			}
+			if n := len(f.queue.Messages(queue.SubjectEvents)); n != tt.wantQueued {
+				t.Errorf("queued %d events, want %d", n, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestTrackErrorHandler(t *testing.T) {
+	f := newTrackingFixture()
+	key := f.addKey(t, domain.PrivacyPolicyTrack)
+
+	w := serve(f.router, http.MethodPost, "/api/track/error", gin.H{"source": "app.js"}, map[string]string{"X-API-Key": key})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("error without a message: status = %d, want 400", w.Code)
+	}
+
+	w = serve(f.router, http.MethodPost, "/api/track/error", gin.H{"message": "boom", "source": "app.js"}, map[string]string{"X-API-Key": key})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	if n := len(f.queue.Messages(queue.SubjectErrors)); n != 1 {
+		t.Errorf("queued %d errors, want 1", n)
+	}
+
+	// Privacy signals apply to errors as to page views
+	dropKey := f.addKey(t, domain.PrivacyPolicyDrop)
+	w = serve(f.router, http.MethodPost, "/api/track/error", gin.H{"message": "boom"}, map[string]string{"X-API-Key": dropKey, "Sec-GPC": "1"})
+	var body map[string]string
+	decode(t, w, &body)
+	if w.Code != http.StatusOK || body["status"] != "dropped" {
+		t.Errorf("error with GPC and drop policy: status = %d, body %v, want dropped", w.Code, body)
+	}
+	if n := len(f.queue.Messages(queue.SubjectErrors)); n != 1 {
+		t.Errorf("queued %d errors, want the dropped one left out", n)
+	}
+}
+
+func TestTrackPurchaseHandler(t *testing.T) {
+	f := newTrackingFixture()
+	key := f.addKey(t, domain.PrivacyPolicyTrack)
+	headers := map[string]string{"X-API-Key": key}
+
+	invalid := []gin.H{
+		{"currency": "USD", "total": 10},
+		{"order_id": "o1", "currency": "DOLLARS", "total": 10},
+		{"order_id": "o1", "currency": "USD", "items": []gin.H{{"sku": "a", "quantity": 0, "price": 1}}},
+	}
+	for _, body := range invalid {
+		if w := serve(f.router, http.MethodPost, "/api/track/purchase", body, headers); w.Code != http.StatusBadRequest {
+			t.Errorf("purchase %v: status = %d, want 400", body, w.Code)
+		}
+	}
+
+	body := gin.H{"order_id": "o1", "currency": "usd", "items": []gin.H{{"sku": "a", "quantity": 2, "price": 3}}}
+	if w := serve(f.router, http.MethodPost, "/api/track/purchase", body, headers); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	if n := len(f.queue.Messages(queue.SubjectPurchases)); n != 1 {
+		t.Errorf("queued %d purchases, want 1", n)
+	}
+
+	dropKey := f.addKey(t, domain.PrivacyPolicyDrop)
+	w := serve(f.router, http.MethodPost, "/api/track/purchase", body, map[string]string{"X-API-Key": dropKey, "DNT": "1"})
+	var status map[string]string
+	decode(t, w, &status)
+	if w.Code != http.StatusOK || status["status"] != "dropped" {
+		t.Errorf("purchase with DNT and drop policy: status = %d, body %v, want dropped", w.Code, status)
+	}
+	if n := len(f.queue.Messages(queue.SubjectPurchases)); n != 1 {
+		t.Errorf("queued %d purchases, want the dropped one left out", n)
+	}
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache is the subset of Redis the services use. A missing key is reported
+// as redis.Nil by every implementation.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	// MGet returns each key's value as a string, or nil where the key does
+	// not exist or does not hold a string.
+	MGet(ctx context.Context, keys ...string) ([]interface{}, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	// Incr returns the value after incrementing.
+	Incr(ctx context.Context, key string) (int64, error)
+	Expire(ctx context.Context, key string, expiration time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+	Publish(ctx context.Context, channel string, message interface{}) error
+	ZAdd(ctx context.Context, key string, members ...redis.Z) error
+	ZRem(ctx context.Context, key string, members ...interface{}) error
+	ZRemRangeByScore(ctx context.Context, key, min, max string) error
+	ZCard(ctx context.Context, key string) (int64, error)
+	ZRevRange(ctx context.Context, key string, start, stop int64) ([]string, error)
+	ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error)
+	ZIncrBy(ctx context.Context, key string, increment float64, member string) error
+	// ZUnionStore stores the sum of the sorted sets at keys in dest.
+	ZUnionStore(ctx context.Context, dest string, keys ...string) error
+	PFAdd(ctx context.Context, key string, elements ...interface{}) error
+	PFCount(ctx context.Context, keys ...string) (int64, error)
+	PFMerge(ctx context.Context, dest string, keys ...string) error
+	// Pipelined sends the commands fn queues on the Pipe in one round trip.
+	// Every command runs even if an earlier one fails; the first error is
+	// returned.
+	Pipelined(ctx context.Context, fn func(Pipe)) error
+}
+
+// Pipe queues write commands for Pipelined. Their results are not needed,
+// so the methods return nothing.
+type Pipe interface {
+	Set(key string, value interface{}, expiration time.Duration)
+	Incr(key string)
+	Expire(key string, expiration time.Duration)
+	Publish(channel string, message interface{})
+	ZAdd(key string, members ...redis.Z)
+	ZIncrBy(key string, increment float64, member string)
+	ZUnionStore(dest string, keys ...string)
+	PFAdd(key string, elements ...interface{})
+}
+
+var _ Cache = (*RedisCache)(nil)
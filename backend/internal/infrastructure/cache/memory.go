@@ -0,0 +1,678 @@
+package cache
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MemoryCache is an in-process Cache, used by tests and by lite mode in
+// place of Redis. It follows Redis semantics closely enough for the
+// services: keys expire, sorted sets order by score then member, and values
+// are converted the way go-redis converts command arguments, so a value
+// Redis would reject is rejected here too. Expired keys are dropped when
+// next touched or by Sweep.
+type MemoryCache struct {
+	mu        sync.Mutex
+	strings   map[string]string
+	zsets     map[string]map[string]float64
+	expiry    map[string]time.Time
+	published map[string][]string
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		strings:   make(map[string]string),
+		zsets:     make(map[string]map[string]float64),
+		expiry:    make(map[string]time.Time),
+		published: make(map[string][]string),
+	}
+}
+
+var _ Cache = (*MemoryCache)(nil)
+
+func (m *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	value, ok := m.strings[key]
+	if !ok {
+		return "", redis.Nil
+	}
+	return value, nil
+}
+
+func (m *MemoryCache) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		m.expire(key)
+		if value, ok := m.strings[key]; ok {
+			values[i] = value
+		}
+	}
+	return values, nil
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	s, err := argString(value)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.delete(key)
+	m.strings[key] = s
+	if expiration > 0 {
+		m.expiry[key] = time.Now().Add(expiration)
+	}
+	return nil
+}
+
+func (m *MemoryCache) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	s, err := argString(value)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+	if m.exists(key) {
+		return false, nil
+	}
+	m.strings[key] = s
+	if expiration > 0 {
+		m.expiry[key] = time.Now().Add(expiration)
+	}
+	return true, nil
+}
+
+func (m *MemoryCache) Incr(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	if _, ok := m.zsets[key]; ok {
+		return 0, wrongType()
+	}
+	n := int64(0)
+	if value, ok := m.strings[key]; ok {
+		var err error
+		if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, errors.New("ERR value is not an integer or out of range")
+		}
+	}
+	n++
+	m.strings[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (m *MemoryCache) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	if !m.exists(key) {
+		return nil
+	}
+	if expiration <= 0 {
+		m.delete(key)
+		return nil
+	}
+	m.expiry[key] = time.Now().Add(expiration)
+	return nil
+}
+
+func (m *MemoryCache) Del(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		m.delete(key)
+	}
+	return nil
+}
+
+// publishedLimit is how many messages Published keeps per channel.
+const publishedLimit = 100
+
+// Publish records the message; there are no subscribers. Published returns
+// the latest messages sent on a channel.
+func (m *MemoryCache) Publish(ctx context.Context, channel string, message interface{}) error {
+	s, err := argString(message)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := append(m.published[channel], s)
+	if len(messages) > publishedLimit {
+		messages = append([]string(nil), messages[len(messages)-publishedLimit:]...)
+	}
+	m.published[channel] = messages
+	return nil
+}
+
+func (m *MemoryCache) ZAdd(ctx context.Context, key string, members ...redis.Z) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	if _, ok := m.strings[key]; ok {
+		return wrongType()
+	}
+	set, ok := m.zsets[key]
+	if !ok {
+		set = make(map[string]float64)
+	}
+	for _, z := range members {
+		member, err := argString(z.Member)
+		if err != nil {
+			return err
+		}
+		set[member] = z.Score
+	}
+	m.zsets[key] = set
+	return nil
+}
+
+func (m *MemoryCache) ZRem(ctx context.Context, key string, members ...interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	set := m.zsets[key]
+	for _, member := range members {
+		s, err := argString(member)
+		if err != nil {
+			return err
+		}
+		delete(set, s)
+	}
+	m.dropEmpty(key)
+	return nil
+}
+
+func (m *MemoryCache) ZRemRangeByScore(ctx context.Context, key, min, max string) error {
+	lower, lowerExclusive, err := parseScore(min)
+	if err != nil {
+		return err
+	}
+	upper, upperExclusive, err := parseScore(max)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	set := m.zsets[key]
+	for member, score := range set {
+		aboveMin := score > lower || (!lowerExclusive && score == lower)
+		belowMax := score < upper || (!upperExclusive && score == upper)
+		if aboveMin && belowMax {
+			delete(set, member)
+		}
+	}
+	m.dropEmpty(key)
+	return nil
+}
+
+func (m *MemoryCache) ZCard(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+	return int64(len(m.zsets[key])), nil
+}
+
+func (m *MemoryCache) ZRevRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+	return m.revRange(key, start, stop), nil
+}
+
+func (m *MemoryCache) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	members := m.revRange(key, start, stop)
+	zs := make([]redis.Z, len(members))
+	for i, member := range members {
+		zs[i] = redis.Z{Score: m.zsets[key][member], Member: member}
+	}
+	return zs, nil
+}
+
+func (m *MemoryCache) ZIncrBy(ctx context.Context, key string, increment float64, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	if _, ok := m.strings[key]; ok {
+		return wrongType()
+	}
+	set, ok := m.zsets[key]
+	if !ok {
+		set = make(map[string]float64)
+		m.zsets[key] = set
+	}
+	set[member] += increment
+	return nil
+}
+
+// ZUnionStore replaces dest, dropping any expiry, and stores nothing when
+// the union is empty, as Redis does.
+func (m *MemoryCache) ZUnionStore(ctx context.Context, dest string, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	union := make(map[string]float64)
+	for _, key := range keys {
+		m.expire(key)
+		if _, ok := m.strings[key]; ok {
+			return wrongType()
+		}
+		for member, score := range m.zsets[key] {
+			union[member] += score
+		}
+	}
+
+	m.delete(dest)
+	if len(union) > 0 {
+		m.zsets[dest] = union
+	}
+	return nil
+}
+
+// revRange returns the members of the sorted set at key from start to stop,
+// highest score first. Callers hold mu and have expired key.
+func (m *MemoryCache) revRange(key string, start, stop int64) []string {
+	set := m.zsets[key]
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if set[members[i]] != set[members[j]] {
+			return set[members[i]] > set[members[j]]
+		}
+		return members[i] > members[j]
+	})
+
+	// Negative indexes count from the end, as in Redis
+	n := int64(len(members))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return []string{}
+	}
+	return members[start : stop+1]
+}
+
+// HyperLogLogs are kept as dense registers of hashed elements, encoded in a
+// string value as Redis does, so GET and SET copy them. As in Redis, no
+// element is kept, only a few bits of its hash, and counts are estimates.
+
+func (m *MemoryCache) PFAdd(ctx context.Context, key string, elements ...interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	registers, err := m.hll(key)
+	if err != nil {
+		return err
+	}
+	for _, element := range elements {
+		s, err := argString(element)
+		if err != nil {
+			return err
+		}
+		index, rank := hllPosition(s)
+		if rank > registers[index] {
+			registers[index] = rank
+		}
+	}
+	m.setHLL(key, registers)
+	return nil
+}
+
+func (m *MemoryCache) PFCount(ctx context.Context, keys ...string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	union, err := m.union(keys)
+	if err != nil {
+		return 0, err
+	}
+	return hllEstimate(union), nil
+}
+
+func (m *MemoryCache) PFMerge(ctx context.Context, dest string, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	union, err := m.union(append([]string{dest}, keys...))
+	if err != nil {
+		return err
+	}
+	m.setHLL(dest, union)
+	return nil
+}
+
+// Pipelined runs the queued commands in order once fn returns.
+func (m *MemoryCache) Pipelined(ctx context.Context, fn func(Pipe)) error {
+	pipe := &memoryPipe{}
+	fn(pipe)
+
+	var first error
+	for _, cmd := range pipe.cmds {
+		if err := cmd(ctx, m); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// memoryPipe records commands for MemoryCache.Pipelined.
+type memoryPipe struct {
+	cmds []func(context.Context, *MemoryCache) error
+}
+
+func (p *memoryPipe) Set(key string, value interface{}, expiration time.Duration) {
+	p.cmds = append(p.cmds, func(ctx context.Context, m *MemoryCache) error {
+		return m.Set(ctx, key, value, expiration)
+	})
+}
+
+func (p *memoryPipe) Incr(key string) {
+	p.cmds = append(p.cmds, func(ctx context.Context, m *MemoryCache) error {
+		_, err := m.Incr(ctx, key)
+		return err
+	})
+}
+
+func (p *memoryPipe) Expire(key string, expiration time.Duration) {
+	p.cmds = append(p.cmds, func(ctx context.Context, m *MemoryCache) error {
+		return m.Expire(ctx, key, expiration)
+	})
+}
+
+func (p *memoryPipe) Publish(channel string, message interface{}) {
+	p.cmds = append(p.cmds, func(ctx context.Context, m *MemoryCache) error {
+		return m.Publish(ctx, channel, message)
+	})
+}
+
+func (p *memoryPipe) ZAdd(key string, members ...redis.Z) {
+	p.cmds = append(p.cmds, func(ctx context.Context, m *MemoryCache) error {
+		return m.ZAdd(ctx, key, members...)
+	})
+}
+
+func (p *memoryPipe) ZIncrBy(key string, increment float64, member string) {
+	p.cmds = append(p.cmds, func(ctx context.Context, m *MemoryCache) error {
+		return m.ZIncrBy(ctx, key, increment, member)
+	})
+}
+
+func (p *memoryPipe) ZUnionStore(dest string, keys ...string) {
+	p.cmds = append(p.cmds, func(ctx context.Context, m *MemoryCache) error {
+		return m.ZUnionStore(ctx, dest, keys...)
+	})
+}
+
+func (p *memoryPipe) PFAdd(key string, elements ...interface{}) {
+	p.cmds = append(p.cmds, func(ctx context.Context, m *MemoryCache) error {
+		return m.PFAdd(ctx, key, elements...)
+	})
+}
+
+// Published returns the last messages sent on channel, oldest first.
+func (m *MemoryCache) Published(channel string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.published[channel]...)
+}
+
+// TTL returns the time left before key expires, or false if it has no expiry
+// or does not exist.
+func (m *MemoryCache) TTL(key string) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(key)
+
+	at, ok := m.expiry[key]
+	if !ok {
+		return 0, false
+	}
+	return time.Until(at), true
+}
+
+// Sweep drops every expired key. Without it, keys that are never read
+// again would stay in memory after expiring.
+func (m *MemoryCache) Sweep() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.expiry {
+		m.expire(key)
+	}
+}
+
+func (m *MemoryCache) exists(key string) bool {
+	_, isString := m.strings[key]
+	_, isSet := m.zsets[key]
+	return isString || isSet
+}
+
+// expire drops key if its deadline has passed. Callers hold mu.
+func (m *MemoryCache) expire(key string) {
+	if at, ok := m.expiry[key]; ok && !time.Now().Before(at) {
+		m.delete(key)
+	}
+}
+
+func (m *MemoryCache) delete(key string) {
+	delete(m.strings, key)
+	delete(m.zsets, key)
+	delete(m.expiry, key)
+}
+
+// dropEmpty removes a sorted set once its last member is gone, like Redis.
+func (m *MemoryCache) dropEmpty(key string) {
+	if set, ok := m.zsets[key]; ok && len(set) == 0 {
+		m.delete(key)
+	}
+}
+
+// hllPrefix starts every HyperLogLog value, like the "HYLL" header of Redis'
+// own encoding.
+const hllPrefix = "HYLL"
+
+// hllBits selects a register by the low bits of an element's hash, giving
+// the same 16384 registers and 0.81% standard error as Redis.
+const (
+	hllBits      = 14
+	hllRegisters = 1 << hllBits
+)
+
+// hllPosition hashes element and returns its register and the rank to record
+// there: one more than the number of trailing zeros of the remaining bits.
+func hllPosition(element string) (int, uint8) {
+	h := fnv.New64a()
+	h.Write([]byte(element))
+	// FNV alone spreads short, similar strings poorly over the low bits
+	sum := h.Sum64()
+	sum ^= sum >> 33
+	sum *= 0xff51afd7ed558ccd
+	sum ^= sum >> 33
+	sum *= 0xc4ceb9fe1a85ec53
+	sum ^= sum >> 33
+
+	rest := sum>>hllBits | 1<<(64-hllBits)
+	return int(sum & (hllRegisters - 1)), uint8(bits.TrailingZeros64(rest) + 1)
+}
+
+// hllEstimate is the HyperLogLog estimate of the number of distinct elements
+// added to registers, using linear counting while many registers are empty.
+func hllEstimate(registers []uint8) int64 {
+	const m = float64(hllRegisters)
+	var sum float64
+	empty := 0
+	for _, rank := range registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			empty++
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && empty > 0 {
+		estimate = m * math.Log(m/float64(empty))
+	}
+	return int64(math.Round(estimate))
+}
+
+// hll decodes the HyperLogLog at key, or returns empty registers if key does
+// not exist. Callers hold mu and have expired key.
+func (m *MemoryCache) hll(key string) ([]uint8, error) {
+	if _, ok := m.zsets[key]; ok {
+		return nil, wrongType()
+	}
+	value, ok := m.strings[key]
+	if !ok {
+		return make([]uint8, hllRegisters), nil
+	}
+	if !strings.HasPrefix(value, hllPrefix) || len(value) != len(hllPrefix)+hllRegisters {
+		return nil, errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	}
+	return []uint8(value[len(hllPrefix):]), nil
+}
+
+// setHLL stores registers at key, keeping any expiry. Callers hold mu.
+func (m *MemoryCache) setHLL(key string, registers []uint8) {
+	m.strings[key] = hllPrefix + string(registers)
+}
+
+// union merges the HyperLogLogs at keys, keeping the highest rank of each
+// register; missing keys count as empty. Callers hold mu.
+func (m *MemoryCache) union(keys []string) ([]uint8, error) {
+	union := make([]uint8, hllRegisters)
+	for _, key := range keys {
+		m.expire(key)
+		registers, err := m.hll(key)
+		if err != nil {
+			return nil, err
+		}
+		for i, rank := range registers {
+			if rank > union[i] {
+				union[i] = rank
+			}
+		}
+	}
+	return union, nil
+}
+
+func wrongType() error {
+	return errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+// parseScore reads a ZRANGEBYSCORE bound: a number, -inf/+inf, or either
+// prefixed with "(" to exclude it.
+func parseScore(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+
+	switch s {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+	return f, exclusive, nil
+}
+
+// argString converts a command argument the way go-redis writes it.
+func argString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.FormatInt(v.Nanoseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("redis: can't marshal %T (implement encoding.BinaryMarshaler)", v)
+	}
+}
@@ -0,0 +1,56 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+)
+
+func TestMemoryHyperLogLogEstimatesWithoutKeepingElements(t *testing.T) {
+	c := cache.NewMemoryCache()
+	ctx := context.Background()
+
+	for _, n := range []int{50, 1000, 100000} {
+		key := fmt.Sprintf("visitors:%d", n)
+		for i := 0; i < n; i++ {
+			// Adding each element twice must not count it twice
+			if err := c.PFAdd(ctx, key, fmt.Sprintf("visitor-%d", i), fmt.Sprintf("visitor-%d", i)); err != nil {
+				t.Fatalf("PFAdd: %v", err)
+			}
+		}
+		count, err := c.PFCount(ctx, key)
+		if err != nil {
+			t.Fatalf("PFCount: %v", err)
+		}
+		if off := math.Abs(float64(count-int64(n))) / float64(n); off > 0.02 {
+			t.Errorf("PFCount of %d elements = %d, off by %.1f%%", n, count, 100*off)
+		}
+	}
+
+	value, err := c.Get(ctx, "visitors:50")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if strings.Contains(value, "visitor-") {
+		t.Error("the stored HyperLogLog contains the elements added to it")
+	}
+
+	// Merging overlapping sets counts their union
+	if err := c.PFMerge(ctx, "merged", "visitors:50", "visitors:1000"); err != nil {
+		t.Fatalf("PFMerge: %v", err)
+	}
+	if count, err := c.PFCount(ctx, "merged"); err != nil || math.Abs(float64(count-1000)) > 20 {
+		t.Errorf("PFCount of the merge = %d, %v, want about 1000", count, err)
+	}
+
+	if err := c.Set(ctx, "plain", "value", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := c.PFAdd(ctx, "plain", "v1"); err == nil {
+		t.Error("PFAdd to a plain string succeeded")
+	}
+}
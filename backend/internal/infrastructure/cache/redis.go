@@ -2,8 +2,12 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"net"
 	"time"
 
+	"github.com/nesohq/backend/internal/metrics"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -18,6 +22,10 @@ func NewRedisCache(url string) (*RedisCache, error) {
 	}
 
 	client := redis.NewClient(opts)
+	client.AddHook(metricsHook{})
+	if err := redisotel.InstrumentTracing(client); err != nil {
+		return nil, err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -29,16 +37,28 @@ func NewRedisCache(url string) (*RedisCache, error) {
 	return &RedisCache{client: client}, nil
 }
 
+func (r *RedisCache) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 func (r *RedisCache) Get(ctx context.Context, key string) (string, error) {
 	return r.client.Get(ctx, key).Result()
 }
 
+func (r *RedisCache) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	return r.client.MGet(ctx, keys...).Result()
+}
+
 func (r *RedisCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	return r.client.Set(ctx, key, value, expiration).Err()
 }
 
-func (r *RedisCache) Incr(ctx context.Context, key string) error {
-	return r.client.Incr(ctx, key).Err()
+func (r *RedisCache) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, expiration).Result()
+}
+
+func (r *RedisCache) Incr(ctx context.Context, key string) (int64, error) {
+	return r.client.Incr(ctx, key).Result()
 }
 
 func (r *RedisCache) Expire(ctx context.Context, key string, expiration time.Duration) error {
@@ -65,6 +85,10 @@ func (r *RedisCache) ZAdd(ctx context.Context, key string, members ...redis.Z) e
 	return r.client.ZAdd(ctx, key, members...).Err()
 }
 
+func (r *RedisCache) ZRem(ctx context.Context, key string, members ...interface{}) error {
+	return r.client.ZRem(ctx, key, members...).Err()
+}
+
 func (r *RedisCache) ZRemRangeByScore(ctx context.Context, key, min, max string) error {
 	return r.client.ZRemRangeByScore(ctx, key, min, max).Err()
 }
@@ -76,3 +100,109 @@ func (r *RedisCache) ZCard(ctx context.Context, key string) (int64, error) {
 func (r *RedisCache) ZRevRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
 	return r.client.ZRevRange(ctx, key, start, stop).Result()
 }
+
+func (r *RedisCache) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	return r.client.ZRevRangeWithScores(ctx, key, start, stop).Result()
+}
+
+func (r *RedisCache) ZIncrBy(ctx context.Context, key string, increment float64, member string) error {
+	return r.client.ZIncrBy(ctx, key, increment, member).Err()
+}
+
+func (r *RedisCache) ZUnionStore(ctx context.Context, dest string, keys ...string) error {
+	return r.client.ZUnionStore(ctx, dest, &redis.ZStore{Keys: keys}).Err()
+}
+
+func (r *RedisCache) PFAdd(ctx context.Context, key string, elements ...interface{}) error {
+	return r.client.PFAdd(ctx, key, elements...).Err()
+}
+
+func (r *RedisCache) PFCount(ctx context.Context, keys ...string) (int64, error) {
+	return r.client.PFCount(ctx, keys...).Result()
+}
+
+func (r *RedisCache) PFMerge(ctx context.Context, dest string, keys ...string) error {
+	return r.client.PFMerge(ctx, dest, keys...).Err()
+}
+
+func (r *RedisCache) Pipelined(ctx context.Context, fn func(Pipe)) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		fn(redisPipe{ctx: ctx, pipe: pipe})
+		return nil
+	})
+	return err
+}
+
+// redisPipe queues commands on a go-redis pipeline.
+type redisPipe struct {
+	ctx  context.Context
+	pipe redis.Pipeliner
+}
+
+func (p redisPipe) Set(key string, value interface{}, expiration time.Duration) {
+	p.pipe.Set(p.ctx, key, value, expiration)
+}
+
+func (p redisPipe) Incr(key string) {
+	p.pipe.Incr(p.ctx, key)
+}
+
+func (p redisPipe) Expire(key string, expiration time.Duration) {
+	p.pipe.Expire(p.ctx, key, expiration)
+}
+
+func (p redisPipe) Publish(channel string, message interface{}) {
+	p.pipe.Publish(p.ctx, channel, message)
+}
+
+func (p redisPipe) ZAdd(key string, members ...redis.Z) {
+	p.pipe.ZAdd(p.ctx, key, members...)
+}
+
+func (p redisPipe) ZIncrBy(key string, increment float64, member string) {
+	p.pipe.ZIncrBy(p.ctx, key, increment, member)
+}
+
+func (p redisPipe) ZUnionStore(dest string, keys ...string) {
+	p.pipe.ZUnionStore(p.ctx, dest, &redis.ZStore{Keys: keys})
+}
+
+func (p redisPipe) PFAdd(key string, elements ...interface{}) {
+	p.pipe.PFAdd(p.ctx, key, elements...)
+}
+
+// metricsHook counts failed commands. redis.Nil is a cache miss, not a
+// failure.
+type metricsHook struct{}
+
+func (metricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			metrics.StoreErrors.WithLabelValues("redis", "dial").Inc()
+		}
+		return conn, err
+	}
+}
+
+func (metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			metrics.StoreErrors.WithLabelValues("redis", cmd.Name()).Inc()
+		}
+		return err
+	}
+}
+
+func (metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			if cmdErr := cmd.Err(); cmdErr != nil && !errors.Is(cmdErr, redis.Nil) {
+				metrics.StoreErrors.WithLabelValues("redis", cmd.Name()).Inc()
+			}
+		}
+		return err
+	}
+}
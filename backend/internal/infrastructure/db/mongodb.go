@@ -17,7 +17,7 @@ func NewMongoDB(uri, database string) (*MongoDB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetMonitor(newCommandMonitor()))
 	if err != nil {
 		return nil, err
 	}
@@ -38,6 +38,11 @@ func (m *MongoDB) Close() error {
 	return m.Client.Disconnect(ctx)
 }
 
+// Ping checks that the primary is reachable.
+func (m *MongoDB) Ping(ctx context.Context) error {
+	return m.Client.Ping(ctx, nil)
+}
+
 func (m *MongoDB) Collection(name string) *mongo.Collection {
 	return m.Database.Collection(name)
 }
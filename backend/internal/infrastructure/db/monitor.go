@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/nesohq/backend/internal/metrics"
+	"github.com/nesohq/backend/internal/tracing"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newCommandMonitor traces every command as a child of the caller's span and
+// counts failed ones. The driver reports start and finish separately, so
+// open spans are kept by request id in between.
+func newCommandMonitor() *event.CommandMonitor {
+	var spans sync.Map
+
+	finish := func(requestID int64, err error) {
+		value, ok := spans.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			// Commands outside any trace (handshakes, heartbeats) are noise
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+
+			collection, _ := e.Command.Lookup(e.CommandName).StringValueOK()
+			_, span := tracing.Tracer().Start(ctx, e.CommandName+" "+collection,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.DBSystemNameMongoDB,
+					semconv.DBNamespace(e.DatabaseName),
+					semconv.DBOperationName(e.CommandName),
+					semconv.DBCollectionName(collection),
+				),
+			)
+			spans.Store(e.RequestID, span)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, nil)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			metrics.StoreErrors.WithLabelValues("mongodb", e.CommandName).Inc()
+			finish(e.RequestID, errors.New(e.Failure))
+		},
+	}
+}
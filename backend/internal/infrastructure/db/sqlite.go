@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLite is the single-file database used in lite mode in place of MongoDB
+// (and ClickHouse).
+type SQLite struct {
+	DB *sql.DB
+}
+
+// NewSQLite opens (creating if needed) the database file at path. The
+// write-ahead log lets the dashboard read while workers write, and writers
+// wait for each other instead of failing with "database is locked".
+func NewSQLite(path string) (*SQLite, error) {
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_synchronous", "NORMAL")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_foreign_keys", "on")
+	params.Set("_txlock", "immediate")
+
+	// The path is escaped so a '?', '#' or '%' in it is not read as part of
+	// the URI
+	database, err := sql.Open("sqlite3", "file:"+url.PathEscape(path)+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := database.PingContext(ctx); err != nil {
+		database.Close()
+		return nil, err
+	}
+	return &SQLite{DB: database}, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.DB.Close()
+}
+
+// Ping checks that the database file can still be read.
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
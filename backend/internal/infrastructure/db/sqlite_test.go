@@ -0,0 +1,26 @@
+package db_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nesohq/backend/internal/infrastructure/db"
+)
+
+func TestNewSQLiteOpensPathsNeedingEscapes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats #1?mode=ro %20.db")
+
+	database, err := db.NewSQLite(path)
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	defer database.Close()
+	if _, err := database.DB.Exec("CREATE TABLE t (id INTEGER)"); err != nil {
+		t.Fatalf("writing to the database: %v", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("database file not created at %q: %v", path, err)
+	}
+}
@@ -0,0 +1,286 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/metrics"
+	"github.com/nesohq/backend/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrQueueClosed is returned by Publish once the queue is draining.
+var ErrQueueClosed = errors.New("queue is closed")
+
+// ChannelQueue hands messages to workers in the same process over buffered
+// channels, for lite mode where there is no NATS server. Failed messages are
+// retried with the same backoff as NATSQueue and then dropped with an error
+// log instead of being dead-lettered. Nothing is persisted: messages still
+// queued when the process dies are lost.
+type ChannelQueue struct {
+	logger   *slog.Logger
+	subjects map[string]chan channelMessage
+
+	mu     sync.RWMutex
+	closed bool
+
+	consumers sync.WaitGroup
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// channelMessage is a Message plus the span of the request that published
+// it, so the worker's span joins that trace.
+type channelMessage struct {
+	Message
+	producer trace.SpanContext
+}
+
+// NewChannelQueue creates a queue that buffers up to size messages per
+// subject; once a buffer is full, Publish waits for the workers to catch up.
+func NewChannelQueue(logger *slog.Logger, size int) *ChannelQueue {
+	q := &ChannelQueue{
+		logger:   logger,
+		subjects: make(map[string]chan channelMessage),
+		stop:     make(chan struct{}),
+	}
+	for _, subject := range []string{SubjectEvents, SubjectErrors, SubjectPurchases} {
+		q.subjects[subject] = make(chan channelMessage, size)
+	}
+	return q
+}
+
+var (
+	_ Publisher = (*ChannelQueue)(nil)
+	_ Consumer  = (*ChannelQueue)(nil)
+)
+
+// Publish queues data for the subject's worker. It waits at most
+// publishTimeout for room in the buffer.
+func (q *ChannelQueue) Publish(ctx context.Context, subject string, data interface{}) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	ch, ok := q.subjects[subject]
+	if !ok {
+		return fmt.Errorf("unknown subject %q", subject)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "publish "+subject,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttributes(subject)...),
+	)
+	msg := channelMessage{
+		Message:  Message{Data: bytes, RequestID: logging.RequestID(ctx)},
+		producer: trace.SpanContextFromContext(ctx),
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(publishTimeout)
+	defer timer.Stop()
+	select {
+	case ch <- msg:
+	case <-timer.C:
+		err = fmt.Errorf("%s queue is full", subject)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	metrics.QueuePublishDuration.WithLabelValues(subject, metrics.Status(err)).Observe(time.Since(start).Seconds())
+	endSpan(span, err)
+	return err
+}
+
+// Subscribe handles subject's messages one at a time. A failed message is
+// retried before the next one is taken, so a handler that keeps failing
+// holds up the subject until the backoff runs out.
+func (q *ChannelQueue) Subscribe(subject string, handler func(context.Context, []byte) error) error {
+	ch, ok := q.subjects[subject]
+	if !ok {
+		return fmt.Errorf("unknown subject %q", subject)
+	}
+
+	q.consumers.Add(1)
+	go func() {
+		defer q.consumers.Done()
+		for msg := range ch {
+			metrics.QueuePending.WithLabelValues(subject).Set(float64(len(ch)))
+			q.process(subject, []channelMessage{msg}, func(ctx context.Context, batch []Message) []error {
+				return []error{handler(ctx, batch[0].Data)}
+			})
+		}
+	}()
+	return nil
+}
+
+// SubscribeBatch is like Subscribe but hands messages to handler in batches,
+// as NATSQueue.SubscribeBatch does. Only the failed messages of a batch are
+// retried.
+func (q *ChannelQueue) SubscribeBatch(subject string, opts BatchOptions, handler func(context.Context, []Message) []error) error {
+	ch, ok := q.subjects[subject]
+	if !ok {
+		return fmt.Errorf("unknown subject %q", subject)
+	}
+
+	q.consumers.Add(1)
+	go func() {
+		defer q.consumers.Done()
+
+		slots := make(chan struct{}, opts.Concurrency)
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+
+		var inFlight sync.WaitGroup
+		defer inFlight.Wait()
+
+		var batch []channelMessage
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			msgs := batch
+			batch = nil
+
+			// Blocks while every slot is busy, which leaves new messages
+			// in the channel
+			slots <- struct{}{}
+			inFlight.Add(1)
+			go func() {
+				defer inFlight.Done()
+				defer func() { <-slots }()
+				q.process(subject, msgs, handler)
+			}()
+		}
+
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					flush()
+					return
+				}
+				metrics.QueuePending.WithLabelValues(subject).Set(float64(len(ch)))
+				batch = append(batch, msg)
+				if len(batch) >= opts.Size {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	return nil
+}
+
+// process runs handler on msgs, retrying failures with retryBackoff until
+// they succeed, fail permanently or run out of attempts.
+func (q *ChannelQueue) process(subject string, msgs []channelMessage, handler func(context.Context, []Message) []error) {
+	for attempt := 1; len(msgs) > 0; attempt++ {
+		batch := make([]Message, len(msgs))
+		links := make([]trace.Link, 0, len(msgs))
+		for i, msg := range msgs {
+			batch[i] = msg.Message
+			if msg.producer.IsValid() {
+				links = append(links, trace.Link{SpanContext: msg.producer})
+			}
+		}
+
+		ctx := context.Background()
+		if len(msgs) == 1 {
+			ctx = logging.WithRequestID(ctx, msgs[0].RequestID)
+		}
+		ctx, span := tracing.Tracer().Start(ctx, "process "+subject,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithLinks(links...),
+			trace.WithAttributes(append(messagingAttributes(subject), semconv.MessagingBatchMessageCount(len(msgs)))...),
+		)
+		errs := handler(ctx, batch)
+
+		var (
+			retry  []channelMessage
+			failed error
+		)
+		for i, msg := range msgs {
+			var err error
+			if errs != nil {
+				err = errs[i]
+			}
+			if err == nil {
+				metrics.QueueSettled.WithLabelValues(subject, "ack").Inc()
+				continue
+			}
+			if failed == nil {
+				failed = err
+			}
+
+			var permanent *permanentError
+			if errors.As(err, &permanent) || attempt > len(retryBackoff) {
+				q.drop(subject, msg, attempt, err)
+				continue
+			}
+			metrics.QueueSettled.WithLabelValues(subject, "retry").Inc()
+			retry = append(retry, msg)
+		}
+		endSpan(span, failed)
+
+		if len(retry) == 0 {
+			return
+		}
+		select {
+		case <-time.After(retryBackoff[attempt-1]):
+			msgs = retry
+		case <-q.stop:
+			for _, msg := range retry {
+				q.drop(subject, msg, attempt, failed)
+			}
+			return
+		}
+	}
+}
+
+func (q *ChannelQueue) drop(subject string, msg channelMessage, attempts int, cause error) {
+	q.logger.Error("dropped message",
+		"subject", subject, "request_id", msg.RequestID, "attempts", attempts, "error", cause)
+	metrics.QueueSettled.WithLabelValues(subject, "dropped").Inc()
+}
+
+// Drain stops accepting messages and waits for the workers to handle the
+// ones already queued. If ctx expires first, pending retries are abandoned
+// and whatever is left is lost.
+func (q *ChannelQueue) Drain(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		for _, ch := range q.subjects {
+			close(ch)
+		}
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.consumers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.stopOnce.Do(func() { close(q.stop) })
+		return ctx.Err()
+	}
+}
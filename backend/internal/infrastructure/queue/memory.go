@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/nesohq/backend/internal/logging"
+)
+
+// MemoryQueue is an in-process Publisher for tests. Messages are encoded as
+// NATSQueue would encode them and kept per subject instead of being
+// delivered.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	messages map[string][]Message
+	err      error
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{messages: make(map[string][]Message)}
+}
+
+var _ Publisher = (*MemoryQueue)(nil)
+
+func (q *MemoryQueue) Publish(ctx context.Context, subject string, data interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.err != nil {
+		return q.err
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	q.messages[subject] = append(q.messages[subject], Message{Data: bytes, RequestID: logging.RequestID(ctx)})
+	return nil
+}
+
+// Messages returns what was published on subject, oldest first.
+func (q *MemoryQueue) Messages(subject string) []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Message(nil), q.messages[subject]...)
+}
+
+// FailWith makes every later Publish return err, as if the server were
+// unreachable. A nil err restores normal publishing.
+func (q *MemoryQueue) FailWith(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.err = err
+}
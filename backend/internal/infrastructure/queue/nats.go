@@ -1,38 +1,498 @@
 package queue
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nesohq/backend/internal/logging"
+	"github.com/nesohq/backend/internal/metrics"
+	"github.com/nesohq/backend/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	SubjectEvents    = "events"
+	SubjectErrors    = "errors"
+	SubjectPurchases = "purchases"
+
+	streamName           = "KRAKENS"
+	deadLetterStreamName = "KRAKENS_DEAD_LETTER"
+	deadLetterPrefix     = "dead_letter."
+
+	requestIDHeader = "Krakens-Request-Id"
+
+	publishTimeout = 5 * time.Second
+	ackWait        = 30 * time.Second
+)
+
+// retryBackoff is the delay before each redelivery of a message whose handler
+// failed. Once it is exhausted the message goes to the dead letter stream.
+var retryBackoff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 2 * time.Minute}
+
 type NATSQueue struct {
-	conn *nats.Conn
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	logger *slog.Logger
+
+	mu            sync.Mutex
+	subscriptions []*subscription
 }
 
-func NewNATSQueue(url string) (*NATSQueue, error) {
+func NewNATSQueue(url string, logger *slog.Logger) (*NATSQueue, error) {
 	conn, err := nats.Connect(url)
 	if err != nil {
 		return nil, err
 	}
 
-	return &NATSQueue{conn: conn}, nil
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Messages stay in the work queue until a worker acks them, so nothing is
+	// lost while workers are down or Mongo is unavailable
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      streamName,
+		Subjects:  []string{SubjectEvents, SubjectErrors, SubjectPurchases},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+	}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     deadLetterStreamName,
+		Subjects: []string{deadLetterPrefix + ">"},
+		Storage:  jetstream.FileStorage,
+		MaxAge:   30 * 24 * time.Hour,
+	}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &NATSQueue{conn: conn, js: js, logger: logger}, nil
 }
 
-func (n *NATSQueue) Publish(subject string, data interface{}) error {
+// Publish stores data on the stream and waits for the server to acknowledge
+// that it has been persisted. The trace context and request id in ctx travel
+// with the message so the worker's spans and logs can be correlated.
+func (n *NATSQueue) Publish(ctx context.Context, subject string, data interface{}) error {
 	bytes, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return n.conn.Publish(subject, bytes)
+
+	ctx, span := tracing.Tracer().Start(ctx, "publish "+subject,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttributes(subject)...),
+	)
+	defer span.End()
+
+	msg := nats.NewMsg(subject)
+	msg.Data = bytes
+	tracing.Inject(ctx, msg.Header)
+	if id := logging.RequestID(ctx); id != "" {
+		msg.Header.Set(requestIDHeader, id)
+	}
+
+	// The caller's deadline may be long gone by the time a slow server
+	// answers, so bound the wait independently
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTimeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err = n.js.PublishMsg(ctx, msg)
+	metrics.QueuePublishDuration.WithLabelValues(subject, metrics.Status(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Message is one message handed to a SubscribeBatch handler.
+type Message struct {
+	Data []byte
+	// RequestID is the id of the request that published the message, if any.
+	RequestID string
+}
+
+// BatchOptions controls how SubscribeBatch groups messages.
+type BatchOptions struct {
+	// Size is the most messages handed to the handler at once.
+	Size int
+	// Interval is the longest a message waits for its batch to fill.
+	Interval time.Duration
+	// Concurrency is the most batches being handled at the same time. When
+	// all of them are busy, consumption pauses until one finishes.
+	Concurrency int
+}
+
+// subscription is a running consumer started by Subscribe or SubscribeBatch.
+type subscription struct {
+	messages jetstream.MessagesContext
+	done     chan struct{}
+}
+
+// Drain stops fetching new messages, handles the ones already buffered and
+// waits for in-flight handlers to settle them. If ctx expires first the
+// remaining messages are left unacked and will be redelivered.
+func (s *subscription) Drain(ctx context.Context) error {
+	s.messages.Drain()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		s.messages.Stop()
+		return ctx.Err()
+	}
+}
+
+// Subscribe consumes subject through a durable consumer. A message is acked
+// once handler returns nil and redelivered with backoff when it fails; after
+// the last retry, or straight away for Permanent errors, it is moved to the
+// dead letter subject. The handler's context carries a span continuing the
+// publisher's trace. Drain stops it.
+func (n *NATSQueue) Subscribe(subject string, handler func(context.Context, []byte) error) error {
+	consumer, err := n.durableConsumer(subject, 1000)
+	if err != nil {
+		return err
+	}
+
+	messages, err := consumer.Messages()
+	if err != nil {
+		return err
+	}
+
+	sub := n.track(messages)
+	go func() {
+		defer close(sub.done)
+		for {
+			msg, err := messages.Next()
+			if err != nil {
+				return
+			}
+			ctx := logging.WithRequestID(context.Background(), msg.Headers().Get(requestIDHeader))
+			ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, msg.Headers()), "process "+subject,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(messagingAttributes(subject)...),
+			)
+			err = handler(ctx, msg.Data())
+			endSpan(span, err)
+			n.settle(msg, err)
+		}
+	}()
+	return nil
+}
+
+// SubscribeBatch is like Subscribe but hands messages to handler in batches.
+// The handler returns nil when every message succeeded, or one error per
+// message (nil for the ones that succeeded) so only failures are retried.
+// Each batch gets its own span, linked to the trace of every message in it.
+func (n *NATSQueue) SubscribeBatch(subject string, opts BatchOptions, handler func(context.Context, []Message) []error) error {
+	// Bound unacked messages so a slow handler stops the server from
+	// pushing more rather than letting them pile up in memory
+	consumer, err := n.durableConsumer(subject, opts.Size*(opts.Concurrency+2))
+	if err != nil {
+		return err
+	}
+
+	messages, err := consumer.Messages(jetstream.PullMaxMessages(opts.Size))
+	if err != nil {
+		return err
+	}
+
+	sub := n.track(messages)
+	pending := make(chan jetstream.Msg, opts.Size)
+	go func() {
+		defer close(pending)
+		for {
+			msg, err := messages.Next()
+			if err != nil {
+				return
+			}
+			pending <- msg
+		}
+	}()
+	go func() {
+		defer close(sub.done)
+		n.collect(subject, pending, opts, handler)
+	}()
+	return nil
+}
+
+func (n *NATSQueue) track(messages jetstream.MessagesContext) *subscription {
+	sub := &subscription{messages: messages, done: make(chan struct{})}
+
+	n.mu.Lock()
+	n.subscriptions = append(n.subscriptions, sub)
+	n.mu.Unlock()
+	return sub
+}
+
+// collect groups messages into batches until pending is closed, then flushes
+// what is left and waits for every batch to be settled.
+func (n *NATSQueue) collect(subject string, pending <-chan jetstream.Msg, opts BatchOptions, handler func(context.Context, []Message) []error) {
+	slots := make(chan struct{}, opts.Concurrency)
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	var inFlight sync.WaitGroup
+	defer inFlight.Wait()
+
+	var batch []jetstream.Msg
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		msgs := batch
+		batch = nil
+
+		// Blocks while every slot is busy, which in turn stops Next being
+		// called so no more messages are pulled
+		slots <- struct{}{}
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			defer func() { <-slots }()
+
+			batch := make([]Message, len(msgs))
+			links := make([]trace.Link, 0, len(msgs))
+			for i, msg := range msgs {
+				batch[i] = Message{Data: msg.Data(), RequestID: msg.Headers().Get(requestIDHeader)}
+				producer := trace.SpanContextFromContext(tracing.Extract(context.Background(), msg.Headers()))
+				if producer.IsValid() {
+					links = append(links, trace.Link{SpanContext: producer})
+				}
+			}
+
+			ctx, span := tracing.Tracer().Start(context.Background(), "process "+subject,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithLinks(links...),
+				trace.WithAttributes(append(messagingAttributes(subject), semconv.MessagingBatchMessageCount(len(msgs)))...),
+			)
+			errs := handler(ctx, batch)
+
+			var failed error
+			for i, msg := range msgs {
+				var err error
+				if errs != nil {
+					err = errs[i]
+				}
+				if err != nil && failed == nil {
+					failed = err
+				}
+				n.settle(msg, err)
+			}
+			endSpan(span, failed)
+		}()
+	}
+
+	for {
+		select {
+		case msg, ok := <-pending:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) >= opts.Size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
 }
 
-func (n *NATSQueue) Subscribe(subject string, handler func([]byte)) (*nats.Subscription, error) {
-	return n.conn.Subscribe(subject, func(msg *nats.Msg) {
-		handler(msg.Data)
+func (n *NATSQueue) durableConsumer(subject string, maxAckPending int) (jetstream.Consumer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return n.js.CreateOrUpdateConsumer(ctx, streamName, jetstream.ConsumerConfig{
+		Durable:       durableName(subject),
+		FilterSubject: subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       ackWait,
+		MaxAckPending: maxAckPending,
+		// Unlimited so the server never silently stops redelivering; we
+		// dead-letter ourselves once retryBackoff is exhausted
+		MaxDeliver: -1,
 	})
 }
 
+// settle acks a handled message or schedules its retry.
+func (n *NATSQueue) settle(msg jetstream.Msg, err error) {
+	attempt := 1
+	if meta, metaErr := msg.Metadata(); metaErr == nil {
+		attempt = int(meta.NumDelivered)
+		metrics.QueueMessageAge.WithLabelValues(msg.Subject()).Observe(time.Since(meta.Timestamp).Seconds())
+		metrics.QueuePending.WithLabelValues(msg.Subject()).Set(float64(meta.NumPending))
+	}
+
+	if err == nil {
+		msg.Ack()
+		metrics.QueueSettled.WithLabelValues(msg.Subject(), "ack").Inc()
+		return
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) || attempt > len(retryBackoff) {
+		n.deadLetter(msg, attempt, err)
+		return
+	}
+
+	msg.NakWithDelay(retryBackoff[attempt-1])
+	metrics.QueueSettled.WithLabelValues(msg.Subject(), "retry").Inc()
+}
+
+func (n *NATSQueue) deadLetter(msg jetstream.Msg, attempts int, cause error) {
+	dead := nats.NewMsg(deadLetterPrefix + msg.Subject())
+	dead.Data = msg.Data()
+	// Keep the original headers so the trace can still be found
+	for key, values := range msg.Headers() {
+		dead.Header[key] = values
+	}
+	dead.Header.Set("Krakens-Error", cause.Error())
+	dead.Header.Set("Krakens-Attempts", strconv.Itoa(attempts))
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if _, err := n.js.PublishMsg(ctx, dead); err != nil {
+		// Leave the message unacked so it is retried rather than dropped
+		n.logger.Error("failed to dead-letter message",
+			"subject", msg.Subject(), "request_id", msg.Headers().Get(requestIDHeader), "error", err)
+		msg.NakWithDelay(retryBackoff[len(retryBackoff)-1])
+		metrics.QueueSettled.WithLabelValues(msg.Subject(), "retry").Inc()
+		return
+	}
+
+	n.logger.Warn("moved message to dead letter",
+		"subject", msg.Subject(), "request_id", msg.Headers().Get(requestIDHeader), "attempts", attempts, "error", cause)
+	msg.Term()
+	metrics.QueueSettled.WithLabelValues(msg.Subject(), "dead_letter").Inc()
+}
+
+// Ping checks that the connection is up and JetStream answers.
+func (n *NATSQueue) Ping(ctx context.Context) error {
+	if status := n.conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("connection %s", status)
+	}
+	_, err := n.js.AccountInfo(ctx)
+	return err
+}
+
+// ConsumerLag is how far a worker consumer is behind its subject.
+type ConsumerLag struct {
+	// Pending messages not yet delivered to the worker.
+	Pending uint64
+	// AckPending messages delivered but not yet settled.
+	AckPending int
+}
+
+// Lag reports the backlog of each worker consumer by subject. Consumers that
+// have not been created yet (no worker has started) are left out.
+func (n *NATSQueue) Lag(ctx context.Context) (map[string]ConsumerLag, error) {
+	lag := make(map[string]ConsumerLag)
+	for _, subject := range []string{SubjectEvents, SubjectErrors, SubjectPurchases} {
+		consumer, err := n.js.Consumer(ctx, streamName, durableName(subject))
+		if errors.Is(err, jetstream.ErrConsumerNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info, err := consumer.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+		lag[subject] = ConsumerLag{Pending: info.NumPending, AckPending: info.NumAckPending}
+	}
+	return lag, nil
+}
+
+// Drain stops every subscription, letting buffered messages and in-flight
+// batches finish, then flushes outstanding publishes and closes the
+// connection. It gives up when ctx expires; unacked messages are redelivered
+// to the next worker.
+func (n *NATSQueue) Drain(ctx context.Context) error {
+	n.mu.Lock()
+	subscriptions := n.subscriptions
+	n.subscriptions = nil
+	n.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(subscriptions))
+	for i, sub := range subscriptions {
+		wg.Add(1)
+		go func(i int, sub *subscription) {
+			defer wg.Done()
+			errs[i] = sub.Drain(ctx)
+		}(i, sub)
+	}
+	wg.Wait()
+
+	if err := n.conn.FlushWithContext(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	n.conn.Close()
+	return errors.Join(errs...)
+}
+
 func (n *NATSQueue) Close() {
 	n.conn.Close()
 }
+
+func durableName(subject string) string {
+	return subject + "_worker"
+}
+
+func messagingAttributes(subject string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKey.String("nats"),
+		semconv.MessagingDestinationName(subject),
+	}
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return fmt.Sprintf("permanent: %v", e.err)
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a handler error as one that retrying cannot fix, such as a
+// malformed payload, so the message is dead-lettered immediately.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
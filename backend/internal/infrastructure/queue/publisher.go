@@ -0,0 +1,22 @@
+package queue
+
+import "context"
+
+// Publisher hands messages to the workers. Services depend on it rather than
+// on NATSQueue so they can run without a NATS server.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data interface{}) error
+}
+
+// Consumer feeds published messages to the workers' handlers until it is
+// drained.
+type Consumer interface {
+	Subscribe(subject string, handler func(context.Context, []byte) error) error
+	SubscribeBatch(subject string, opts BatchOptions, handler func(context.Context, []Message) []error) error
+	Drain(ctx context.Context) error
+}
+
+var (
+	_ Publisher = (*NATSQueue)(nil)
+	_ Consumer  = (*NATSQueue)(nil)
+)
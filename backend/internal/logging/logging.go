@@ -0,0 +1,104 @@
+// Package logging builds the application's structured logger and carries the
+// request id through contexts so API, ingest and worker logs line up.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redactedKeys are attribute keys whose values never reach the logs.
+var redactedKeys = map[string]bool{
+	"api_key":       true,
+	"apikey":        true,
+	"x-api-key":     true,
+	"authorization": true,
+	"password":      true,
+	"token":         true,
+	"secret":        true,
+	"jwt_secret":    true,
+}
+
+// New returns a logger writing JSON in production and human-readable text
+// elsewhere. level is one of debug, info, warn or error.
+func New(environment, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       parseLevel(level),
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	if environment == "production" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// Fatal logs err and exits, for startup failures.
+func Fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func redact(_ []string, attr slog.Attr) slog.Attr {
+	if redactedKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, "[REDACTED]")
+	}
+	return attr
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the id stored by WithRequestID, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request and trace ids found in the context to
+// every record logged with one of the *Context methods.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
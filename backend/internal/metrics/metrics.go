@@ -0,0 +1,121 @@
+// Package metrics defines the Prometheus collectors shared by the api, ingest
+// and worker processes. They register with the default registry, which
+// Handler serves.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "krakens"
+
+// Reasons an ingestion request is rejected, used as the "reason" label of
+// EventsRejected.
+const (
+	RejectMissingKey     = "missing_key"
+	RejectBadKey         = "bad_key"
+	RejectNoDomain       = "no_domain"
+	RejectInvalidPayload = "invalid_payload"
+	RejectPrivacyPolicy  = "privacy_policy"
+	RejectRateLimit      = "rate_limit"
+)
+
+var (
+	// EventsIngested counts accepted hits per domain and kind (pageview,
+	// error, purchase).
+	EventsIngested = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_ingested_total",
+		Help:      "Tracking hits accepted and published to the queue.",
+	}, []string{"domain_id", "kind"})
+
+	// EventsRejected counts hits that were refused or dropped, by reason.
+	EventsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_rejected_total",
+		Help:      "Tracking hits rejected before reaching the queue.",
+	}, []string{"kind", "reason"})
+
+	// QueuePublishDuration is how long the server took to acknowledge a
+	// publish.
+	QueuePublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_publish_duration_seconds",
+		Help:      "Latency of publishing a message to NATS JetStream.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"subject", "status"})
+
+	// QueueMessageAge is how long a message waited on the stream before a
+	// worker settled it.
+	QueueMessageAge = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_message_age_seconds",
+		Help:      "Time between a message being published and a worker settling it.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, []string{"subject"})
+
+	// QueuePending is the number of messages still waiting for the consumer,
+	// as last reported by the server.
+	QueuePending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_pending_messages",
+		Help:      "Messages waiting to be delivered to the worker consumer.",
+	}, []string{"subject"})
+
+	// QueueSettled counts messages by outcome (ack, retry, dead_letter, and
+	// dropped in lite mode).
+	QueueSettled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_messages_settled_total",
+		Help:      "Messages handled by workers, by outcome.",
+	}, []string{"subject", "outcome"})
+
+	// WorkerInsertDuration is how long a worker took to write to MongoDB.
+	WorkerInsertDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "worker_insert_duration_seconds",
+		Help:      "Latency of worker writes to MongoDB.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"subject", "status"})
+
+	// StoreErrors counts failed Redis, MongoDB and ClickHouse commands.
+	StoreErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_errors_total",
+		Help:      "Failed Redis, MongoDB and ClickHouse operations, by store and command.",
+	}, []string{"store", "command"})
+
+	// WebhookDeliveries counts alert notifications by outcome (delivered or
+	// failed once retries ran out).
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Alert webhook notifications, by event and outcome.",
+	}, []string{"event", "outcome"})
+
+	// HTTPRequestDuration covers every request, labelled by route pattern
+	// rather than raw path to keep cardinality bounded.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Status is the "status" label for an operation that returned err.
+func Status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Handler serves the default registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
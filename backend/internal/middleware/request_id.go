@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nesohq/backend/internal/logging"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// Ids supplied by a proxy are reused only if they look like ids, so clients
+// cannot inject arbitrary text into the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{8,64}$`)
+
+// RequestIDMiddleware assigns every request an id, taken from X-Request-ID
+// when a trusted proxy set one, stores it in the request context and echoes
+// it in the response.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// LoggingMiddleware writes one access log line per request. The query string
+// is left out since it may carry tokens.
+func LoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		} else if status >= 400 || len(c.Errors) > 0 {
+			level = slog.LevelWarn
+		} else if probeRoutes[c.FullPath()] {
+			// Orchestrator probes would otherwise drown everything else
+			level = slog.LevelDebug
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+var probeRoutes = map[string]bool{"/health": true, "/healthz": true, "/readyz": true}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,105 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/nesohq/backend/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// all lists every migration. Append new ones with the next version; never
+// edit one that has been released.
+var all = []Migration{
+	{Version: 1, Name: "create indexes", Up: createInitialIndexes},
+	{Version: 2, Name: "backfill domain privacy signal policy", Up: backfillPrivacySignalPolicy},
+	{Version: 3, Name: "create alert indexes", Up: createAlertIndexes},
+}
+
+// createInitialIndexes covers the filters the repositories query by. Almost
+// every read is scoped to a domain and a time range, so domain_id leads.
+func createInitialIndexes(ctx context.Context, db *mongo.Database) error {
+	// Sign-up checks for an existing email first, but only the index stops two
+	// concurrent sign-ups from both succeeding
+	if err := createIndexes(ctx, db, "users",
+		mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+	); err != nil {
+		return err
+	}
+
+	if err := createIndexes(ctx, db, "api_keys",
+		mongo.IndexModel{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	); err != nil {
+		return err
+	}
+
+	if err := createIndexes(ctx, db, "domains",
+		mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	); err != nil {
+		return err
+	}
+
+	// Stats, exports and retention scan by domain and time; visitor lookups
+	// serve privacy requests
+	for _, collection := range []string{"events", "error_events"} {
+		if err := createIndexes(ctx, db, collection,
+			mongo.IndexModel{Keys: bson.D{{Key: "domain_id", Value: 1}, {Key: "timestamp", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "domain_id", Value: 1}, {Key: "visitor_id", Value: 1}, {Key: "timestamp", Value: 1}}},
+		); err != nil {
+			return err
+		}
+	}
+
+	// Purchases are upserted by order id, so the unique index is what makes
+	// a repeated order a no-op under concurrency
+	if err := createIndexes(ctx, db, "purchases",
+		mongo.IndexModel{Keys: bson.D{{Key: "domain_id", Value: 1}, {Key: "order_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "domain_id", Value: 1}, {Key: "timestamp", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "domain_id", Value: 1}, {Key: "visitor_id", Value: 1}, {Key: "timestamp", Value: 1}}},
+	); err != nil {
+		return err
+	}
+
+	if err := createIndexes(ctx, db, "daily_rollups",
+		mongo.IndexModel{Keys: bson.D{{Key: "domain_id", Value: 1}, {Key: "date", Value: 1}}},
+	); err != nil {
+		return err
+	}
+
+	return createIndexes(ctx, db, "privacy_requests",
+		mongo.IndexModel{Keys: bson.D{{Key: "domain_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	)
+}
+
+// backfillPrivacySignalPolicy gives domains created before privacy signal
+// handling existed an explicit policy. They have always been tracked
+// normally, so that is what they get.
+func backfillPrivacySignalPolicy(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("domains").UpdateMany(ctx,
+		bson.M{"$or": bson.A{
+			bson.M{"settings.privacy_signal_policy": bson.M{"$exists": false}},
+			bson.M{"settings.privacy_signal_policy": ""},
+		}},
+		bson.M{"$set": bson.M{"settings.privacy_signal_policy": domain.PrivacyPolicyTrack}},
+	)
+	return err
+}
+
+// createAlertIndexes covers the dashboard listing a domain's rules and a
+// rule's delivery log, and the scheduler loading every enabled rule and
+// pruning old deliveries.
+func createAlertIndexes(ctx context.Context, db *mongo.Database) error {
+	if err := createIndexes(ctx, db, "alert_rules",
+		mongo.IndexModel{Keys: bson.D{{Key: "domain_id", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "enabled", Value: 1}}},
+	); err != nil {
+		return err
+	}
+
+	return createIndexes(ctx, db, "alert_deliveries",
+		mongo.IndexModel{Keys: bson.D{{Key: "rule_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "created_at", Value: 1}}},
+	)
+}
@@ -0,0 +1,128 @@
+// Package migrations evolves the MongoDB schema: indexes and document shapes.
+// Each migration runs once per database and is recorded in the migrations
+// collection. Migrations must be idempotent, because two processes starting
+// together may both apply one before either records it.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = "migrations"
+
+// Migration is one versioned schema change. Versions are never reused or
+// renumbered once released.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is the document stored for each applied migration.
+type Record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Status pairs a known migration with when it was applied, if it was.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Up applies every migration newer than those recorded, in version order,
+// and stops at the first failure.
+func Up(ctx context.Context, db *mongo.Database, logger *slog.Logger) error {
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range sorted() {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		logger.Info("applying migration", "version", m.Version, "name", m.Name)
+		start := time.Now()
+		if err := m.Up(ctx, db); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+
+		record := Record{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+		_, err := db.Collection(collectionName).UpdateOne(ctx,
+			bson.M{"_id": m.Version},
+			bson.M{"$setOnInsert": record},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+		logger.Info("applied migration", "version", m.Version, "name", m.Name, "duration", time.Since(start))
+	}
+	return nil
+}
+
+// List reports every known migration and whether it has been applied.
+func List(ctx context.Context, db *mongo.Database) ([]Status, error) {
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(all))
+	for _, m := range sorted() {
+		status := Status{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func appliedVersions(ctx context.Context, db *mongo.Database) (map[int]Record, error) {
+	cursor, err := db.Collection(collectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]Record, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func sorted() []Migration {
+	migrations := append([]Migration(nil), all...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+// createIndexes is the building block for index migrations. Creating an index
+// that already exists with the same options is a no-op.
+func createIndexes(ctx context.Context, db *mongo.Database, collection string, indexes ...mongo.IndexModel) error {
+	if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("creating indexes on %s: %w", collection, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AlertRuleRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAlertRuleRepository(db *mongo.Database) *AlertRuleRepository {
+	return &AlertRuleRepository{
+		collection: db.Collection("alert_rules"),
+	}
+}
+
+func (r *AlertRuleRepository) Create(ctx context.Context, rule *domain.AlertRule) error {
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = time.Now()
+	result, err := r.collection.InsertOne(ctx, rule)
+	if err != nil {
+		return err
+	}
+	rule.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *AlertRuleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*domain.AlertRule, error) {
+	var rule domain.AlertRule
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&rule)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *AlertRuleRepository) FindByDomainID(ctx context.Context, domainID primitive.ObjectID) ([]*domain.AlertRule, error) {
+	return r.find(ctx, bson.M{"domain_id": domainID})
+}
+
+func (r *AlertRuleRepository) FindEnabled(ctx context.Context) ([]*domain.AlertRule, error) {
+	return r.find(ctx, bson.M{"enabled": true})
+}
+
+func (r *AlertRuleRepository) Update(ctx context.Context, rule *domain.AlertRule) error {
+	rule.UpdatedAt = time.Now()
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": rule.ID},
+		bson.M{"$set": rule},
+	)
+	return err
+}
+
+func (r *AlertRuleRepository) UpdateState(ctx context.Context, id primitive.ObjectID, firing bool, value float64, checkedAt time.Time) error {
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"firing": firing, "last_value": value, "last_checked_at": checkedAt}},
+	)
+	return err
+}
+
+func (r *AlertRuleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *AlertRuleRepository) find(ctx context.Context, filter bson.M) ([]*domain.AlertRule, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rules := []*domain.AlertRule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+type AlertDeliveryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAlertDeliveryRepository(db *mongo.Database) *AlertDeliveryRepository {
+	return &AlertDeliveryRepository{
+		collection: db.Collection("alert_deliveries"),
+	}
+}
+
+func (r *AlertDeliveryRepository) Create(ctx context.Context, delivery *domain.AlertDelivery) error {
+	delivery.CreatedAt = time.Now()
+	result, err := r.collection.InsertOne(ctx, delivery)
+	if err != nil {
+		return err
+	}
+	delivery.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByRuleID returns the rule's latest deliveries, newest first.
+func (r *AlertDeliveryRepository) FindByRuleID(ctx context.Context, ruleID primitive.ObjectID, limit int64) ([]*domain.AlertDelivery, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{"rule_id": ruleID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []*domain.AlertDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *AlertDeliveryRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"created_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
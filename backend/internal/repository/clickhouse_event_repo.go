@@ -0,0 +1,386 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// clickHouseEventsSchema partitions events by month and sorts them by domain
+// and time, which is how every query reads them. Rows with the same id are
+// collapsed when parts merge, and reads use FINAL to collapse them before
+// that, so a batch the worker writes twice after a lost ack is never counted
+// twice; retried identical inserts are dropped straight away.
+const clickHouseEventsSchema = `CREATE TABLE IF NOT EXISTS events (
+	id String,
+	domain_id String,
+	timestamp DateTime64(3, 'UTC'),
+	ip_hash String,
+	user_agent String,
+	path String,
+	referrer String,
+	country LowCardinality(String),
+	device LowCardinality(String),
+	browser LowCardinality(String),
+	visitor_id String,
+	INDEX visitor_idx visitor_id TYPE bloom_filter GRANULARITY 4
+)
+ENGINE = ReplacingMergeTree
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (domain_id, timestamp, id)
+SETTINGS non_replicated_deduplication_window = 1000`
+
+const clickHouseTimeLayout = "2006-01-02 15:04:05.000"
+
+// clickHouseEventColumns are the event fields a breakdown may group by.
+var clickHouseEventColumns = map[string]bool{
+	"path":       true,
+	"referrer":   true,
+	"country":    true,
+	"device":     true,
+	"browser":    true,
+	"visitor_id": true,
+}
+
+// ClickHouseEventRepository keeps raw events in ClickHouse, for deployments
+// whose event volume outgrows MongoDB. It behaves like EventRepository
+// except that Create does not reject a duplicate id.
+type ClickHouseEventRepository struct {
+	ch *db.ClickHouse
+}
+
+var _ EventStore = (*ClickHouseEventRepository)(nil)
+
+func NewClickHouseEventRepository(ch *db.ClickHouse) *ClickHouseEventRepository {
+	return &ClickHouseEventRepository{ch: ch}
+}
+
+// EnsureSchema creates the events table if it does not exist yet.
+func (r *ClickHouseEventRepository) EnsureSchema(ctx context.Context) error {
+	return r.ch.Exec(ctx, clickHouseEventsSchema, nil)
+}
+
+// clickHouseEvent is an events row as ClickHouse reads and writes it.
+type clickHouseEvent struct {
+	ID        string `json:"id"`
+	DomainID  string `json:"domain_id"`
+	Timestamp string `json:"timestamp"`
+	IPHash    string `json:"ip_hash"`
+	UserAgent string `json:"user_agent"`
+	Path      string `json:"path"`
+	Referrer  string `json:"referrer"`
+	Country   string `json:"country"`
+	Device    string `json:"device"`
+	Browser   string `json:"browser"`
+	VisitorID string `json:"visitor_id"`
+}
+
+func (r *ClickHouseEventRepository) Create(ctx context.Context, event *domain.Event) error {
+	_, err := r.CreateMany(ctx, []*domain.Event{event})
+	return err
+}
+
+// CreateMany inserts events in a single block, so they are written all or
+// nothing and the failed map is always empty.
+func (r *ClickHouseEventRepository) CreateMany(ctx context.Context, events []*domain.Event) (map[int]error, error) {
+	rows := make([]interface{}, len(events))
+	for i, event := range events {
+		if event.Timestamp.IsZero() {
+			event.Timestamp = time.Now()
+		}
+		// Unlike Mongo, ClickHouse has no id to fill in, so the row gets
+		// one here; the caller does not see it, as with InsertOne
+		id := event.ID
+		if id.IsZero() {
+			id = primitive.NewObjectID()
+		}
+		rows[i] = clickHouseEvent{
+			ID:        id.Hex(),
+			DomainID:  event.DomainID.Hex(),
+			Timestamp: event.Timestamp.UTC().Format(clickHouseTimeLayout),
+			IPHash:    event.IPHash,
+			UserAgent: event.UserAgent,
+			Path:      event.Path,
+			Referrer:  event.Referrer,
+			Country:   event.Country,
+			Device:    event.Device,
+			Browser:   event.Browser,
+			VisitorID: event.VisitorID,
+		}
+	}
+
+	if err := r.ch.Insert(ctx, "events", rows); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (r *ClickHouseEventRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.Event, error) {
+	events := []*domain.Event{}
+	err := r.queryEvents(ctx,
+		`SELECT * FROM events FINAL
+		WHERE domain_id = {domain_id:String} AND visitor_id = {visitor_id:String}
+		ORDER BY timestamp`,
+		map[string]string{"domain_id": domainID.Hex(), "visitor_id": visitorID},
+		func(event *domain.Event) error {
+			events = append(events, event)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// DeleteByVisitor removes the visitor's events with a lightweight delete,
+// which hides them from queries at once and drops them at the next merge.
+func (r *ClickHouseEventRepository) DeleteByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	where := "domain_id = {domain_id:String} AND visitor_id = {visitor_id:String}"
+	params := map[string]string{"domain_id": domainID.Hex(), "visitor_id": visitorID}
+	return r.deleteWhere(ctx, where, params)
+}
+
+func (r *ClickHouseEventRepository) CountTotal(ctx context.Context, domainID primitive.ObjectID) (int64, error) {
+	return r.count(ctx,
+		"SELECT count() AS n FROM events FINAL WHERE domain_id = {domain_id:String}",
+		map[string]string{"domain_id": domainID.Hex()},
+	)
+}
+
+// AggregateDay builds the rollup for events in [start, end).
+func (r *ClickHouseEventRepository) AggregateDay(ctx context.Context, domainID primitive.ObjectID, start, end time.Time) (*domain.DailyRollup, error) {
+	where := rangeWhere()
+	params := rangeParams(domainID, start, end)
+
+	rollup := &domain.DailyRollup{
+		DomainID:  domainID,
+		Date:      start,
+		Pages:     []domain.PageStats{},
+		Referrers: []domain.ReferrerStats{},
+		Countries: make(map[string]int),
+		Devices:   make(map[string]int),
+		Browsers:  make(map[string]int),
+	}
+
+	err := r.ch.Query(ctx,
+		"SELECT count() AS pageviews, uniqExactIf(visitor_id, visitor_id != '') AS visitors FROM events FINAL WHERE "+where,
+		params,
+		func(row json.RawMessage) error {
+			var totals struct {
+				Pageviews int64 `json:"pageviews"`
+				Visitors  int64 `json:"visitors"`
+			}
+			if err := json.Unmarshal(row, &totals); err != nil {
+				return err
+			}
+			rollup.Pageviews = totals.Pageviews
+			rollup.Visitors = totals.Visitors
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.countBy(ctx, "path", where, params, 100, func(key string, count int) {
+		rollup.Pages = append(rollup.Pages, domain.PageStats{Path: key, Hits: count})
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.countBy(ctx, "referrer", where+" AND referrer != ''", params, 100, func(key string, count int) {
+		rollup.Referrers = append(rollup.Referrers, domain.ReferrerStats{Referrer: key, Hits: count})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for field, counts := range map[string]map[string]int{
+		"country": rollup.Countries,
+		"device":  rollup.Devices,
+		"browser": rollup.Browsers,
+	} {
+		err := r.countBy(ctx, field, where, params, 0, func(key string, count int) {
+			counts[key] = count
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rollup, nil
+}
+
+// OldestTimestamp returns the timestamp of the domain's oldest raw event, or
+// false if the domain has none.
+func (r *ClickHouseEventRepository) OldestTimestamp(ctx context.Context, domainID primitive.ObjectID) (time.Time, bool, error) {
+	var result struct {
+		Count  int64 `json:"n"`
+		Oldest int64 `json:"oldest"`
+	}
+	err := r.ch.Query(ctx,
+		"SELECT count() AS n, toUnixTimestamp64Milli(min(timestamp)) AS oldest FROM events FINAL WHERE domain_id = {domain_id:String}",
+		map[string]string{"domain_id": domainID.Hex()},
+		func(row json.RawMessage) error {
+			return json.Unmarshal(row, &result)
+		},
+	)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if result.Count == 0 {
+		return time.Time{}, false, nil
+	}
+	return time.UnixMilli(result.Oldest).UTC(), true, nil
+}
+
+func (r *ClickHouseEventRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	where := "domain_id = {domain_id:String} AND timestamp < " + timeParam("before")
+	params := map[string]string{"domain_id": domainID.Hex(), "before": millis(before)}
+	return r.deleteWhere(ctx, where, params)
+}
+
+// StreamRange calls fn for every event in [from, to) in timestamp order,
+// decoding one row at a time so large ranges never sit in memory.
+func (r *ClickHouseEventRepository) StreamRange(ctx context.Context, domainID primitive.ObjectID, from, to time.Time, fn func(*domain.Event) error) error {
+	return r.queryEvents(ctx,
+		"SELECT * FROM events FINAL WHERE "+rangeWhere()+" ORDER BY timestamp",
+		rangeParams(domainID, from, to),
+		fn,
+	)
+}
+
+// StreamBreakdown groups events in [from, to) by field and calls fn for each
+// group, busiest first.
+func (r *ClickHouseEventRepository) StreamBreakdown(ctx context.Context, domainID primitive.ObjectID, field string, from, to time.Time, fn func(*domain.BreakdownRow) error) error {
+	// Column names cannot be query parameters, so only known ones are used
+	if !clickHouseEventColumns[field] {
+		return fmt.Errorf("unknown event field %q", field)
+	}
+
+	return r.ch.Query(ctx,
+		`SELECT `+field+` AS group_key, count() AS hits, uniqExactIf(visitor_id, visitor_id != '') AS visitors
+		FROM events FINAL WHERE `+rangeWhere()+`
+		GROUP BY group_key ORDER BY hits DESC`,
+		rangeParams(domainID, from, to),
+		func(row json.RawMessage) error {
+			var result struct {
+				Key      string `json:"group_key"`
+				Hits     int64  `json:"hits"`
+				Visitors int64  `json:"visitors"`
+			}
+			if err := json.Unmarshal(row, &result); err != nil {
+				return err
+			}
+			return fn(&domain.BreakdownRow{Key: result.Key, Hits: result.Hits, Visitors: result.Visitors})
+		},
+	)
+}
+
+func (r *ClickHouseEventRepository) queryEvents(ctx context.Context, query string, params map[string]string, fn func(*domain.Event) error) error {
+	return r.ch.Query(ctx, query, params, func(row json.RawMessage) error {
+		var stored clickHouseEvent
+		if err := json.Unmarshal(row, &stored); err != nil {
+			return err
+		}
+		event, err := stored.toDomain()
+		if err != nil {
+			return err
+		}
+		return fn(event)
+	})
+}
+
+// countBy counts events matching where by field, busiest first, keeping at
+// most limit groups when limit is positive.
+func (r *ClickHouseEventRepository) countBy(ctx context.Context, field, where string, params map[string]string, limit int, fn func(key string, count int)) error {
+	query := "SELECT " + field + " AS group_key, count() AS n FROM events FINAL WHERE " + where + " GROUP BY group_key ORDER BY n DESC, group_key"
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+	return r.ch.Query(ctx, query, params, func(row json.RawMessage) error {
+		var bucket struct {
+			Key   string `json:"group_key"`
+			Count int    `json:"n"`
+		}
+		if err := json.Unmarshal(row, &bucket); err != nil {
+			return err
+		}
+		fn(bucket.Key, bucket.Count)
+		return nil
+	})
+}
+
+func (r *ClickHouseEventRepository) count(ctx context.Context, query string, params map[string]string) (int64, error) {
+	var result struct {
+		N int64 `json:"n"`
+	}
+	err := r.ch.Query(ctx, query, params, func(row json.RawMessage) error {
+		return json.Unmarshal(row, &result)
+	})
+	return result.N, err
+}
+
+// deleteWhere counts the matching rows first, since a lightweight delete
+// does not report how many it removed.
+func (r *ClickHouseEventRepository) deleteWhere(ctx context.Context, where string, params map[string]string) (int64, error) {
+	n, err := r.count(ctx, "SELECT count() AS n FROM events FINAL WHERE "+where, params)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if err := r.ch.Exec(ctx, "DELETE FROM events WHERE "+where, params); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (e *clickHouseEvent) toDomain() (*domain.Event, error) {
+	id, err := primitive.ObjectIDFromHex(e.ID)
+	if err != nil {
+		return nil, err
+	}
+	domainID, err := primitive.ObjectIDFromHex(e.DomainID)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := time.ParseInLocation(clickHouseTimeLayout, e.Timestamp, time.UTC)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Event{
+		ID:        id,
+		DomainID:  domainID,
+		Timestamp: timestamp,
+		IPHash:    e.IPHash,
+		UserAgent: e.UserAgent,
+		Path:      e.Path,
+		Referrer:  e.Referrer,
+		Country:   e.Country,
+		Device:    e.Device,
+		Browser:   e.Browser,
+		VisitorID: e.VisitorID,
+	}, nil
+}
+
+// timeParam is a DateTime64 built from the Int64 parameter name, which holds
+// Unix milliseconds; this avoids any dependence on the server's time zone.
+func timeParam(name string) string {
+	return "fromUnixTimestamp64Milli({" + name + ":Int64}, 'UTC')"
+}
+
+func millis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func rangeWhere() string {
+	return "domain_id = {domain_id:String} AND timestamp >= " + timeParam("from") + " AND timestamp < " + timeParam("to")
+}
+
+func rangeParams(domainID primitive.ObjectID, from, to time.Time) map[string]string {
+	return map[string]string{"domain_id": domainID.Hex(), "from": millis(from), "to": millis(to)}
+}
@@ -54,6 +54,20 @@ func (r *DomainRepository) FindByUserID(ctx context.Context, userID primitive.Ob
 	return domains, nil
 }
 
+func (r *DomainRepository) FindAll(ctx context.Context) ([]*domain.Domain, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var domains []*domain.Domain
+	if err := cursor.All(ctx, &domains); err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
 func (r *DomainRepository) Update(ctx context.Context, d *domain.Domain) error {
 	d.UpdatedAt = time.Now()
 	_, err := r.collection.UpdateOne(
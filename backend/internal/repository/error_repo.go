@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ErrorRepository struct {
+	collection *mongo.Collection
+}
+
+func NewErrorRepository(db *mongo.Database) *ErrorRepository {
+	return &ErrorRepository{
+		collection: db.Collection("error_events"),
+	}
+}
+
+// Create stores the error event, stamping it with the current time unless it
+// already has one. An event whose id is already stored is skipped.
+func (r *ErrorRepository) Create(ctx context.Context, event *domain.ErrorEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	_, err := r.collection.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *ErrorRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.ErrorEvent, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{"domain_id": domainID, "visitor_id": visitorID},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*domain.ErrorEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *ErrorRepository) DeleteByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"domain_id": domainID, "visitor_id": visitorID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *ErrorRepository) ListIssues(ctx context.Context, domainID primitive.ObjectID, since time.Time, limit int64) ([]*domain.ErrorIssue, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"domain_id": domainID,
+			"timestamp": bson.M{"$gte": since},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "timestamp", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":         "$fingerprint",
+			"message":     bson.M{"$last": "$message"},
+			"source":      bson.M{"$last": "$source"},
+			"line":        bson.M{"$last": "$line"},
+			"column":      bson.M{"$last": "$column"},
+			"occurrences": bson.M{"$sum": 1},
+			"visitors":    bson.M{"$addToSet": "$visitor_id"},
+			"first_seen":  bson.M{"$min": "$timestamp"},
+			"last_seen":   bson.M{"$max": "$timestamp"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"message":           1,
+			"source":            1,
+			"line":              1,
+			"column":            1,
+			"occurrences":       1,
+			"first_seen":        1,
+			"last_seen":         1,
+			"affected_visitors": bson.M{"$size": bson.M{"$setDifference": bson.A{"$visitors", bson.A{""}}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "last_seen", Value: -1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	issues := []*domain.ErrorIssue{}
+	if err := cursor.All(ctx, &issues); err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+func (r *ErrorRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{
+		"domain_id": domainID,
+		"timestamp": bson.M{"$lt": before},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/nesohq/backend/internal/domain"
@@ -21,64 +22,272 @@ func NewEventRepository(db *mongo.Database) *EventRepository {
 	}
 }
 
+// Create stores an event. The timestamp is only filled in when the caller
+// left it unset, so backdated events keep their original time.
 func (r *EventRepository) Create(ctx context.Context, event *domain.Event) error {
-	event.Timestamp = time.Now()
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
 	_, err := r.collection.InsertOne(ctx, event)
 	return err
 }
 
-func (r *EventRepository) GetRecentEvents(ctx context.Context, domainID primitive.ObjectID, minutes int) ([]*domain.Event, error) {
-	since := time.Now().Add(-time.Duration(minutes) * time.Minute)
+// CreateMany inserts events in one unordered bulk write. It returns the
+// events that failed by index; events whose id already exists count as
+// inserted, so a redelivered batch is safe to write again. A non-nil error
+// means the write failed as a whole.
+func (r *EventRepository) CreateMany(ctx context.Context, events []*domain.Event) (map[int]error, error) {
+	docs := make([]interface{}, len(events))
+	for i, event := range events {
+		if event.Timestamp.IsZero() {
+			event.Timestamp = time.Now()
+		}
+		docs[i] = event
+	}
+
+	_, err := r.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return nil, nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return nil, err
+	}
+
+	failed := make(map[int]error)
+	for _, writeErr := range bulkErr.WriteErrors {
+		if mongo.IsDuplicateKeyError(writeErr) {
+			continue
+		}
+		failed[writeErr.Index] = writeErr
+	}
+	return failed, nil
+}
 
+func (r *EventRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.Event, error) {
 	cursor, err := r.collection.Find(
 		ctx,
-		bson.M{
-			"domain_id": domainID,
-			"timestamp": bson.M{"$gte": since},
-		},
-		options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}),
+		bson.M{"domain_id": domainID, "visitor_id": visitorID},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}),
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var events []*domain.Event
+	events := []*domain.Event{}
 	if err := cursor.All(ctx, &events); err != nil {
 		return nil, err
 	}
 	return events, nil
 }
 
+func (r *EventRepository) DeleteByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"domain_id": domainID, "visitor_id": visitorID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
 func (r *EventRepository) CountTotal(ctx context.Context, domainID primitive.ObjectID) (int64, error) {
 	return r.collection.CountDocuments(ctx, bson.M{"domain_id": domainID})
 }
 
-func (r *EventRepository) CountUnique(ctx context.Context, domainID primitive.ObjectID, since time.Time) (int64, error) {
+// AggregateDay builds the rollup for events in [start, end).
+func (r *EventRepository) AggregateDay(ctx context.Context, domainID primitive.ObjectID, start, end time.Time) (*domain.DailyRollup, error) {
+	countBy := func(field string, limit int) bson.A {
+		stages := bson.A{
+			bson.M{"$group": bson.M{"_id": field, "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}}},
+		}
+		if limit > 0 {
+			stages = append(stages, bson.M{"$limit": limit})
+		}
+		return stages
+	}
+
 	pipeline := mongo.Pipeline{
 		{{Key: "$match", Value: bson.M{
 			"domain_id": domainID,
-			"timestamp": bson.M{"$gte": since},
+			"timestamp": bson.M{"$gte": start, "$lt": end},
 		}}},
-		{{Key: "$group", Value: bson.M{
-			"_id": "$visitor_id",
+		{{Key: "$facet", Value: bson.M{
+			"totals": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":       nil,
+					"pageviews": bson.M{"$sum": 1},
+					"visitors":  bson.M{"$addToSet": "$visitor_id"},
+				}},
+				bson.M{"$project": bson.M{
+					"pageviews": 1,
+					"visitors":  bson.M{"$size": bson.M{"$setDifference": bson.A{"$visitors", bson.A{""}}}},
+				}},
+			},
+			"pages": countBy("$path", 100),
+			"referrers": append(
+				bson.A{bson.M{"$match": bson.M{"referrer": bson.M{"$ne": ""}}}},
+				countBy("$referrer", 100)...,
+			),
+			"countries": countBy("$country", 0),
+			"devices":   countBy("$device", 0),
+			"browsers":  countBy("$browser", 0),
 		}}},
-		{{Key: "$count", Value: "total"}},
 	}
 
 	cursor, err := r.collection.Aggregate(ctx, pipeline)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var result []bson.M
+	type bucket struct {
+		Key   string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	var result []struct {
+		Totals []struct {
+			Pageviews int64 `bson:"pageviews"`
+			Visitors  int64 `bson:"visitors"`
+		} `bson:"totals"`
+		Pages     []bucket `bson:"pages"`
+		Referrers []bucket `bson:"referrers"`
+		Countries []bucket `bson:"countries"`
+		Devices   []bucket `bson:"devices"`
+		Browsers  []bucket `bson:"browsers"`
+	}
 	if err := cursor.All(ctx, &result); err != nil {
+		return nil, err
+	}
+
+	rollup := &domain.DailyRollup{
+		DomainID:  domainID,
+		Date:      start,
+		Pages:     []domain.PageStats{},
+		Referrers: []domain.ReferrerStats{},
+		Countries: make(map[string]int),
+		Devices:   make(map[string]int),
+		Browsers:  make(map[string]int),
+	}
+	if len(result) == 0 {
+		return rollup, nil
+	}
+
+	facets := result[0]
+	if len(facets.Totals) > 0 {
+		rollup.Pageviews = facets.Totals[0].Pageviews
+		rollup.Visitors = facets.Totals[0].Visitors
+	}
+	for _, b := range facets.Pages {
+		rollup.Pages = append(rollup.Pages, domain.PageStats{Path: b.Key, Hits: b.Count})
+	}
+	for _, b := range facets.Referrers {
+		rollup.Referrers = append(rollup.Referrers, domain.ReferrerStats{Referrer: b.Key, Hits: b.Count})
+	}
+	for _, b := range facets.Countries {
+		rollup.Countries[b.Key] = b.Count
+	}
+	for _, b := range facets.Devices {
+		rollup.Devices[b.Key] = b.Count
+	}
+	for _, b := range facets.Browsers {
+		rollup.Browsers[b.Key] = b.Count
+	}
+	return rollup, nil
+}
+
+// OldestTimestamp returns the timestamp of the domain's oldest raw event, or
+// false if the domain has none.
+func (r *EventRepository) OldestTimestamp(ctx context.Context, domainID primitive.ObjectID) (time.Time, bool, error) {
+	var event domain.Event
+	err := r.collection.FindOne(
+		ctx,
+		bson.M{"domain_id": domainID},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: 1}}),
+	).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return event.Timestamp, true, nil
+}
+
+func (r *EventRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{
+		"domain_id": domainID,
+		"timestamp": bson.M{"$lt": before},
+	})
+	if err != nil {
 		return 0, err
 	}
+	return result.DeletedCount, nil
+}
+
+// StreamRange calls fn for every event in [from, to) in timestamp order,
+// decoding one document at a time so large ranges never sit in memory.
+func (r *EventRepository) StreamRange(ctx context.Context, domainID primitive.ObjectID, from, to time.Time, fn func(*domain.Event) error) error {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{
+			"domain_id": domainID,
+			"timestamp": bson.M{"$gte": from, "$lt": to},
+		},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}).SetBatchSize(1000),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var event domain.Event
+		if err := cursor.Decode(&event); err != nil {
+			return err
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// StreamBreakdown groups events in [from, to) by field and calls fn for each
+// group, busiest first.
+func (r *EventRepository) StreamBreakdown(ctx context.Context, domainID primitive.ObjectID, field string, from, to time.Time, fn func(*domain.BreakdownRow) error) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"domain_id": domainID,
+			"timestamp": bson.M{"$gte": from, "$lt": to},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$" + field,
+			"hits":     bson.M{"$sum": 1},
+			"visitors": bson.M{"$addToSet": "$visitor_id"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"hits":     1,
+			"visitors": bson.M{"$size": bson.M{"$setDifference": bson.A{"$visitors", bson.A{""}}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "hits", Value: -1}}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
 
-	if len(result) > 0 {
-		return int64(result[0]["total"].(int32)), nil
+	for cursor.Next(ctx) {
+		var row domain.BreakdownRow
+		if err := cursor.Decode(&row); err != nil {
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
 	}
-	return 0, nil
+	return cursor.Err()
 }
@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AlertRuleRepository struct {
+	mu    sync.Mutex
+	rules []domain.AlertRule
+}
+
+func NewAlertRuleRepository() *AlertRuleRepository {
+	return &AlertRuleRepository{}
+}
+
+var _ repository.AlertRuleStore = (*AlertRuleRepository)(nil)
+
+func (r *AlertRuleRepository) Create(ctx context.Context, rule *domain.AlertRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = time.Now()
+	if rule.ID.IsZero() {
+		rule.ID = primitive.NewObjectID()
+	}
+	r.rules = append(r.rules, *rule)
+	return nil
+}
+
+func (r *AlertRuleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*domain.AlertRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rule := range r.rules {
+		if rule.ID == id {
+			return &rule, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *AlertRuleRepository) FindByDomainID(ctx context.Context, domainID primitive.ObjectID) ([]*domain.AlertRule, error) {
+	return r.find(func(rule *domain.AlertRule) bool { return rule.DomainID == domainID }), nil
+}
+
+func (r *AlertRuleRepository) FindEnabled(ctx context.Context) ([]*domain.AlertRule, error) {
+	return r.find(func(rule *domain.AlertRule) bool { return rule.Enabled }), nil
+}
+
+func (r *AlertRuleRepository) Update(ctx context.Context, rule *domain.AlertRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rule.UpdatedAt = time.Now()
+	for i := range r.rules {
+		if r.rules[i].ID == rule.ID {
+			r.rules[i] = *rule
+		}
+	}
+	return nil
+}
+
+func (r *AlertRuleRepository) UpdateState(ctx context.Context, id primitive.ObjectID, firing bool, value float64, checkedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.rules {
+		if r.rules[i].ID == id {
+			r.rules[i].Firing = firing
+			r.rules[i].LastValue = value
+			r.rules[i].LastCheckedAt = checkedAt
+		}
+	}
+	return nil
+}
+
+func (r *AlertRuleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.rules {
+		if r.rules[i].ID == id {
+			r.rules = append(r.rules[:i], r.rules[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// find returns copies of the matching rules, oldest first.
+func (r *AlertRuleRepository) find(match func(*domain.AlertRule) bool) []*domain.AlertRule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rules := []*domain.AlertRule{}
+	for i := range r.rules {
+		if match(&r.rules[i]) {
+			rule := r.rules[i]
+			rules = append(rules, &rule)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+	})
+	return rules
+}
+
+type AlertDeliveryRepository struct {
+	mu         sync.Mutex
+	deliveries []domain.AlertDelivery
+}
+
+func NewAlertDeliveryRepository() *AlertDeliveryRepository {
+	return &AlertDeliveryRepository{}
+}
+
+var _ repository.AlertDeliveryStore = (*AlertDeliveryRepository)(nil)
+
+func (r *AlertDeliveryRepository) Create(ctx context.Context, delivery *domain.AlertDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery.CreatedAt = time.Now()
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	r.deliveries = append(r.deliveries, *delivery)
+	return nil
+}
+
+func (r *AlertDeliveryRepository) FindByRuleID(ctx context.Context, ruleID primitive.ObjectID, limit int64) ([]*domain.AlertDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deliveries := []*domain.AlertDelivery{}
+	for _, delivery := range r.deliveries {
+		if delivery.RuleID == ruleID {
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if limit > 0 && int64(len(deliveries)) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *AlertDeliveryRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.deliveries[:0]
+	for _, delivery := range r.deliveries {
+		if !delivery.CreatedAt.Before(before) {
+			kept = append(kept, delivery)
+		}
+	}
+	deleted := int64(len(r.deliveries) - len(kept))
+	r.deliveries = kept
+	return deleted, nil
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type APIKeyRepository struct {
+	mu   sync.Mutex
+	keys []domain.APIKey
+}
+
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{}
+}
+
+var _ repository.APIKeyStore = (*APIKeyRepository)(nil)
+
+func (r *APIKeyRepository) Create(ctx context.Context, apiKey *domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.Key == apiKey.Key {
+			return duplicateKeyError()
+		}
+	}
+
+	apiKey.CreatedAt = time.Now()
+	if apiKey.ID.IsZero() {
+		apiKey.ID = primitive.NewObjectID()
+	}
+	r.keys = append(r.keys, *apiKey)
+	return nil
+}
+
+func (r *APIKeyRepository) FindByKey(ctx context.Context, key string) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.Key == key && !k.Revoked {
+			return &k, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *APIKeyRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var keys []*domain.APIKey
+	for _, k := range r.keys {
+		if k.UserID == userID {
+			keys = append(keys, &k)
+		}
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepository) Revoke(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].ID == id {
+			r.keys[i].Revoked = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type DomainRepository struct {
+	mu      sync.Mutex
+	domains []domain.Domain
+}
+
+func NewDomainRepository() *DomainRepository {
+	return &DomainRepository{}
+}
+
+var _ repository.DomainStore = (*DomainRepository)(nil)
+
+func (r *DomainRepository) Create(ctx context.Context, d *domain.Domain) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d.CreatedAt = time.Now()
+	d.UpdatedAt = time.Now()
+	if d.ID.IsZero() {
+		d.ID = primitive.NewObjectID()
+	}
+	r.domains = append(r.domains, *d)
+	return nil
+}
+
+func (r *DomainRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*domain.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.domains {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *DomainRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]*domain.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var domains []*domain.Domain
+	for _, d := range r.domains {
+		if d.UserID == userID {
+			domains = append(domains, &d)
+		}
+	}
+	return domains, nil
+}
+
+func (r *DomainRepository) FindAll(ctx context.Context) ([]*domain.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var domains []*domain.Domain
+	for _, d := range r.domains {
+		domains = append(domains, &d)
+	}
+	return domains, nil
+}
+
+func (r *DomainRepository) Update(ctx context.Context, d *domain.Domain) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d.UpdatedAt = time.Now()
+	for i := range r.domains {
+		if r.domains[i].ID == d.ID {
+			r.domains[i] = *d
+		}
+	}
+	return nil
+}
+
+func (r *DomainRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.domains {
+		if r.domains[i].ID == id {
+			r.domains = append(r.domains[:i], r.domains[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ErrorRepository struct {
+	mu     sync.Mutex
+	events []domain.ErrorEvent
+}
+
+func NewErrorRepository() *ErrorRepository {
+	return &ErrorRepository{}
+}
+
+var _ repository.ErrorStore = (*ErrorRepository)(nil)
+
+func (r *ErrorRepository) Create(ctx context.Context, event *domain.ErrorEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	stored := *event
+	if stored.ID.IsZero() {
+		stored.ID = primitive.NewObjectID()
+	}
+	for _, existing := range r.events {
+		if existing.ID == stored.ID {
+			return nil
+		}
+	}
+	r.events = append(r.events, stored)
+	return nil
+}
+
+func (r *ErrorRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.ErrorEvent, error) {
+	events := r.find(func(e *domain.ErrorEvent) bool {
+		return e.DomainID == domainID && e.VisitorID == visitorID
+	})
+	return events, nil
+}
+
+func (r *ErrorRepository) DeleteByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	return r.delete(func(e *domain.ErrorEvent) bool {
+		return e.DomainID == domainID && e.VisitorID == visitorID
+	}), nil
+}
+
+// ListIssues groups errors since the given time by fingerprint, most
+// recently seen first. Each issue shows the details of its latest
+// occurrence.
+func (r *ErrorRepository) ListIssues(ctx context.Context, domainID primitive.ObjectID, since time.Time, limit int64) ([]*domain.ErrorIssue, error) {
+	issues := make(map[string]*domain.ErrorIssue)
+	visitors := make(map[string]map[string]struct{})
+	for _, e := range r.find(func(e *domain.ErrorEvent) bool {
+		return e.DomainID == domainID && !e.Timestamp.Before(since)
+	}) {
+		issue, ok := issues[e.Fingerprint]
+		if !ok {
+			issue = &domain.ErrorIssue{Fingerprint: e.Fingerprint, FirstSeen: e.Timestamp}
+			issues[e.Fingerprint] = issue
+			visitors[e.Fingerprint] = make(map[string]struct{})
+		}
+		issue.Message = e.Message
+		issue.Source = e.Source
+		issue.Line = e.Line
+		issue.Column = e.Column
+		issue.Occurrences++
+		issue.LastSeen = e.Timestamp
+		visitors[e.Fingerprint][e.VisitorID] = struct{}{}
+	}
+
+	list := make([]*domain.ErrorIssue, 0, len(issues))
+	for fingerprint, issue := range issues {
+		issue.AffectedVisitors = distinct(visitors[fingerprint])
+		list = append(list, issue)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].LastSeen.Equal(list[j].LastSeen) {
+			return list[i].LastSeen.After(list[j].LastSeen)
+		}
+		return list[i].Fingerprint < list[j].Fingerprint
+	})
+	if int64(len(list)) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (r *ErrorRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	return r.delete(func(e *domain.ErrorEvent) bool {
+		return e.DomainID == domainID && e.Timestamp.Before(before)
+	}), nil
+}
+
+// find returns copies of the matching events in timestamp order.
+func (r *ErrorRepository) find(match func(*domain.ErrorEvent) bool) []*domain.ErrorEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []*domain.ErrorEvent{}
+	for _, e := range r.events {
+		if match(&e) {
+			events = append(events, &e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events
+}
+
+func (r *ErrorRepository) delete(match func(*domain.ErrorEvent) bool) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.events[:0]
+	for _, e := range r.events {
+		if !match(&e) {
+			kept = append(kept, e)
+		}
+	}
+	deleted := int64(len(r.events) - len(kept))
+	r.events = kept
+	return deleted
+}
@@ -0,0 +1,272 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventRepository struct {
+	mu     sync.Mutex
+	events []domain.Event
+}
+
+func NewEventRepository() *EventRepository {
+	return &EventRepository{}
+}
+
+var _ repository.EventStore = (*EventRepository)(nil)
+
+func (r *EventRepository) Create(ctx context.Context, event *domain.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if r.exists(event.ID) {
+		return duplicateKeyError()
+	}
+	r.insert(*event)
+	return nil
+}
+
+// CreateMany skips events whose id is already stored, like the unordered
+// bulk insert of the Mongo repository, and never fails.
+func (r *EventRepository) CreateMany(ctx context.Context, events []*domain.Event) (map[int]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range events {
+		if event.Timestamp.IsZero() {
+			event.Timestamp = time.Now()
+		}
+		if r.exists(event.ID) {
+			continue
+		}
+		r.insert(*event)
+	}
+	return nil, nil
+}
+
+func (r *EventRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.Event, error) {
+	events := r.find(func(e *domain.Event) bool {
+		return e.DomainID == domainID && e.VisitorID == visitorID
+	})
+	sortByTimestamp(events)
+	return events, nil
+}
+
+func (r *EventRepository) DeleteByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	return r.delete(func(e *domain.Event) bool {
+		return e.DomainID == domainID && e.VisitorID == visitorID
+	}), nil
+}
+
+func (r *EventRepository) CountTotal(ctx context.Context, domainID primitive.ObjectID) (int64, error) {
+	return int64(len(r.find(func(e *domain.Event) bool {
+		return e.DomainID == domainID
+	}))), nil
+}
+
+// AggregateDay builds the rollup for events in [start, end).
+func (r *EventRepository) AggregateDay(ctx context.Context, domainID primitive.ObjectID, start, end time.Time) (*domain.DailyRollup, error) {
+	events := r.find(inRange(domainID, start, end))
+
+	rollup := &domain.DailyRollup{
+		DomainID:  domainID,
+		Date:      start,
+		Pageviews: int64(len(events)),
+		Pages:     []domain.PageStats{},
+		Referrers: []domain.ReferrerStats{},
+		Countries: make(map[string]int),
+		Devices:   make(map[string]int),
+		Browsers:  make(map[string]int),
+	}
+
+	visitors := make(map[string]struct{})
+	pages := make(map[string]int)
+	referrers := make(map[string]int)
+	for _, e := range events {
+		visitors[e.VisitorID] = struct{}{}
+		pages[e.Path]++
+		if e.Referrer != "" {
+			referrers[e.Referrer]++
+		}
+		rollup.Countries[e.Country]++
+		rollup.Devices[e.Device]++
+		rollup.Browsers[e.Browser]++
+	}
+	rollup.Visitors = distinct(visitors)
+
+	for _, key := range topKeys(pages, 100) {
+		rollup.Pages = append(rollup.Pages, domain.PageStats{Path: key, Hits: pages[key]})
+	}
+	for _, key := range topKeys(referrers, 100) {
+		rollup.Referrers = append(rollup.Referrers, domain.ReferrerStats{Referrer: key, Hits: referrers[key]})
+	}
+	return rollup, nil
+}
+
+// OldestTimestamp returns the timestamp of the domain's oldest raw event, or
+// false if the domain has none.
+func (r *EventRepository) OldestTimestamp(ctx context.Context, domainID primitive.ObjectID) (time.Time, bool, error) {
+	events := r.find(func(e *domain.Event) bool {
+		return e.DomainID == domainID
+	})
+	if len(events) == 0 {
+		return time.Time{}, false, nil
+	}
+	sortByTimestamp(events)
+	return events[0].Timestamp, true, nil
+}
+
+func (r *EventRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	return r.delete(func(e *domain.Event) bool {
+		return e.DomainID == domainID && e.Timestamp.Before(before)
+	}), nil
+}
+
+// StreamRange calls fn for every event in [from, to) in timestamp order.
+func (r *EventRepository) StreamRange(ctx context.Context, domainID primitive.ObjectID, from, to time.Time, fn func(*domain.Event) error) error {
+	events := r.find(inRange(domainID, from, to))
+	sortByTimestamp(events)
+	for _, e := range events {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamBreakdown groups events in [from, to) by field and calls fn for each
+// group, busiest first. field is the stored (bson) name of an event field.
+func (r *EventRepository) StreamBreakdown(ctx context.Context, domainID primitive.ObjectID, field string, from, to time.Time, fn func(*domain.BreakdownRow) error) error {
+	hits := make(map[string]int)
+	visitors := make(map[string]map[string]struct{})
+	for _, e := range r.find(inRange(domainID, from, to)) {
+		key := eventField(e, field)
+		hits[key]++
+		if visitors[key] == nil {
+			visitors[key] = make(map[string]struct{})
+		}
+		visitors[key][e.VisitorID] = struct{}{}
+	}
+
+	for _, key := range topKeys(hits, 0) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		row := &domain.BreakdownRow{Key: key, Hits: int64(hits[key]), Visitors: distinct(visitors[key])}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *EventRepository) exists(id primitive.ObjectID) bool {
+	if id.IsZero() {
+		return false
+	}
+	for _, e := range r.events {
+		if e.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// insert stores a copy of event. As with the Mongo driver, an event without
+// an id is stored under a fresh one that the caller does not see.
+func (r *EventRepository) insert(event domain.Event) {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	r.events = append(r.events, event)
+}
+
+func (r *EventRepository) find(match func(*domain.Event) bool) []*domain.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []*domain.Event{}
+	for _, e := range r.events {
+		if match(&e) {
+			events = append(events, &e)
+		}
+	}
+	return events
+}
+
+func (r *EventRepository) delete(match func(*domain.Event) bool) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.events[:0]
+	for _, e := range r.events {
+		if !match(&e) {
+			kept = append(kept, e)
+		}
+	}
+	deleted := int64(len(r.events) - len(kept))
+	r.events = kept
+	return deleted
+}
+
+func inRange(domainID primitive.ObjectID, from, to time.Time) func(*domain.Event) bool {
+	return func(e *domain.Event) bool {
+		return e.DomainID == domainID && !e.Timestamp.Before(from) && e.Timestamp.Before(to)
+	}
+}
+
+func sortByTimestamp(events []*domain.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+}
+
+func eventField(e *domain.Event, field string) string {
+	switch field {
+	case "path":
+		return e.Path
+	case "referrer":
+		return e.Referrer
+	case "country":
+		return e.Country
+	case "device":
+		return e.Device
+	case "browser":
+		return e.Browser
+	case "visitor_id":
+		return e.VisitorID
+	}
+	return ""
+}
+
+// topKeys returns the keys of counts, highest count first and ties broken by
+// key, keeping at most limit of them when limit is positive.
+func topKeys(counts map[string]int, limit int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
@@ -0,0 +1,28 @@
+// Package memory implements the repository Store interfaces in process
+// memory, for tests. Each repository mirrors the behaviour of its Mongo
+// counterpart that callers rely on: unique indexes, upserts, sort orders and
+// the shape of aggregation results. Documents are copied on the way in and
+// out, but slices and maps inside them are shared.
+package memory
+
+import (
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// duplicateKeyError is what Mongo returns when a write breaks a unique index.
+func duplicateKeyError() error {
+	return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+		Code:    11000,
+		Message: "E11000 duplicate key error",
+	}}}
+}
+
+// distinct counts the distinct non-empty values, as the Mongo aggregations do
+// with $addToSet followed by removing "".
+func distinct(values map[string]struct{}) int64 {
+	n := int64(len(values))
+	if _, ok := values[""]; ok {
+		n--
+	}
+	return n
+}
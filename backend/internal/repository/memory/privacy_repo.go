@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PrivacyRequestRepository struct {
+	mu       sync.Mutex
+	requests []domain.PrivacyRequest
+}
+
+func NewPrivacyRequestRepository() *PrivacyRequestRepository {
+	return &PrivacyRequestRepository{}
+}
+
+var _ repository.PrivacyRequestStore = (*PrivacyRequestRepository)(nil)
+
+func (r *PrivacyRequestRepository) Create(ctx context.Context, req *domain.PrivacyRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req.CreatedAt = time.Now()
+	if req.ID.IsZero() {
+		req.ID = primitive.NewObjectID()
+	}
+	r.requests = append(r.requests, *req)
+	return nil
+}
+
+func (r *PrivacyRequestRepository) FindByDomainID(ctx context.Context, domainID primitive.ObjectID) ([]*domain.PrivacyRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requests := []*domain.PrivacyRequest{}
+	for _, req := range r.requests {
+		if req.DomainID == domainID {
+			requests = append(requests, &req)
+		}
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.After(requests[j].CreatedAt)
+	})
+	return requests, nil
+}
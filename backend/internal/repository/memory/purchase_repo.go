@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PurchaseRepository struct {
+	mu        sync.Mutex
+	purchases []domain.Purchase
+}
+
+func NewPurchaseRepository() *PurchaseRepository {
+	return &PurchaseRepository{}
+}
+
+var _ repository.PurchaseStore = (*PurchaseRepository)(nil)
+
+// Create records a purchase once per order; repeats are ignored.
+func (r *PurchaseRepository) Create(ctx context.Context, purchase *domain.Purchase) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if purchase.Timestamp.IsZero() {
+		purchase.Timestamp = time.Now()
+	}
+	for _, p := range r.purchases {
+		if p.DomainID == purchase.DomainID && p.OrderID == purchase.OrderID {
+			return nil
+		}
+	}
+
+	stored := *purchase
+	if stored.ID.IsZero() {
+		stored.ID = primitive.NewObjectID()
+	}
+	r.purchases = append(r.purchases, stored)
+	return nil
+}
+
+func (r *PurchaseRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.Purchase, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purchases := []*domain.Purchase{}
+	for _, p := range r.purchases {
+		if p.DomainID == domainID && p.VisitorID == visitorID {
+			purchases = append(purchases, &p)
+		}
+	}
+	sort.SliceStable(purchases, func(i, j int) bool {
+		return purchases[i].Timestamp.Before(purchases[j].Timestamp)
+	})
+	return purchases, nil
+}
+
+// DetachVisitor removes the visitor id from a visitor's orders and keeps the
+// orders.
+func (r *PurchaseRepository) DetachVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var modified int64
+	for i := range r.purchases {
+		p := &r.purchases[i]
+		if p.DomainID == domainID && p.VisitorID == visitorID && visitorID != "" {
+			p.VisitorID = ""
+			modified++
+		}
+	}
+	return modified, nil
+}
+
+func (r *PurchaseRepository) GetRevenueStats(ctx context.Context, domainID primitive.ObjectID, currency string, since time.Time) (*domain.RevenueStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := &domain.RevenueStats{Currency: currency}
+	bySource := make(map[string]*domain.RevenueBreakdown)
+	byCampaign := make(map[string]*domain.RevenueBreakdown)
+	byLandingPage := make(map[string]*domain.RevenueBreakdown)
+
+	add := func(groups map[string]*domain.RevenueBreakdown, key string, total float64) {
+		group, ok := groups[key]
+		if !ok {
+			group = &domain.RevenueBreakdown{Key: key}
+			groups[key] = group
+		}
+		group.Revenue += total
+		group.Orders++
+	}
+
+	for _, p := range r.purchases {
+		if p.DomainID != domainID || p.Currency != currency || p.Timestamp.Before(since) {
+			continue
+		}
+		stats.Revenue += p.Total
+		stats.Orders++
+		add(bySource, p.Source, p.Total)
+		add(byCampaign, p.Campaign, p.Total)
+		add(byLandingPage, p.LandingPage, p.Total)
+	}
+
+	if stats.Orders > 0 {
+		stats.AverageOrderValue = stats.Revenue / float64(stats.Orders)
+	}
+	stats.BySource = topRevenue(bySource)
+	stats.ByCampaign = topRevenue(byCampaign)
+	stats.ByLandingPage = topRevenue(byLandingPage)
+	return stats, nil
+}
+
+// topRevenue returns the 20 groups with the most revenue, highest first.
+func topRevenue(groups map[string]*domain.RevenueBreakdown) []domain.RevenueBreakdown {
+	list := make([]domain.RevenueBreakdown, 0, len(groups))
+	for _, group := range groups {
+		list = append(list, *group)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Revenue != list[j].Revenue {
+			return list[i].Revenue > list[j].Revenue
+		}
+		return list[i].Key < list[j].Key
+	})
+	if len(list) > 20 {
+		list = list[:20]
+	}
+	return list
+}
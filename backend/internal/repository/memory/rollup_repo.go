@@ -0,0 +1,173 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RollupRepository struct {
+	mu      sync.Mutex
+	rollups []domain.DailyRollup
+}
+
+func NewRollupRepository() *RollupRepository {
+	return &RollupRepository{}
+}
+
+var _ repository.RollupStore = (*RollupRepository)(nil)
+
+// Upsert replaces the rollup built from our own events for the rollup's
+// domain and date. Imported rollups for the same day are left alone.
+func (r *RollupRepository) Upsert(ctx context.Context, rollup *domain.DailyRollup) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rollup.UpdatedAt = time.Now()
+	rollup.Imported = false
+
+	stored := *rollup
+	if i := r.index(rollup.DomainID, rollup.Date, false); i >= 0 {
+		stored.ID = r.rollups[i].ID
+		r.rollups[i] = stored
+		return nil
+	}
+	if stored.ID.IsZero() {
+		stored.ID = primitive.NewObjectID()
+	}
+	r.rollups = append(r.rollups, stored)
+	return nil
+}
+
+// UpsertImported writes the given fields of an imported rollup. A new
+// imported rollup takes every field from rollup.
+func (r *RollupRepository) UpsertImported(ctx context.Context, rollup *domain.DailyRollup, fields []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(rollup.DomainID, rollup.Date, true)
+	if i < 0 {
+		stored := *rollup
+		stored.ID = primitive.NewObjectID()
+		stored.Imported = true
+		stored.UpdatedAt = time.Now()
+		r.rollups = append(r.rollups, stored)
+		return nil
+	}
+
+	existing := &r.rollups[i]
+	existing.ImportSource = rollup.ImportSource
+	existing.UpdatedAt = time.Now()
+	for _, field := range fields {
+		switch field {
+		case "pageviews":
+			existing.Pageviews = rollup.Pageviews
+		case "visitors":
+			existing.Visitors = rollup.Visitors
+		case "pages":
+			existing.Pages = rollup.Pages
+		case "referrers":
+			existing.Referrers = rollup.Referrers
+		case "countries":
+			existing.Countries = rollup.Countries
+		case "devices":
+			existing.Devices = rollup.Devices
+		case "browsers":
+			existing.Browsers = rollup.Browsers
+		}
+	}
+	return nil
+}
+
+// Exists reports whether a rollup built from our own events exists for date.
+func (r *RollupRepository) Exists(ctx context.Context, domainID primitive.ObjectID, date time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.index(domainID, date, false) >= 0, nil
+}
+
+// BuiltDates lists the dates in [from, to) that have a rollup built from our
+// own events.
+func (r *RollupRepository) BuiltDates(ctx context.Context, domainID primitive.ObjectID, from, to time.Time) ([]time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dates := []time.Time{}
+	for _, rollup := range r.rollups {
+		if rollup.DomainID == domainID && !rollup.Imported && !rollup.Date.Before(from) && rollup.Date.Before(to) {
+			dates = append(dates, rollup.Date)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+	return dates, nil
+}
+
+func (r *RollupRepository) FindRange(ctx context.Context, domainID primitive.ObjectID, from, to time.Time) ([]*domain.DailyRollup, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rollups := []*domain.DailyRollup{}
+	for _, rollup := range r.rollups {
+		if rollup.DomainID == domainID && !rollup.Date.Before(from) && rollup.Date.Before(to) {
+			rollups = append(rollups, &rollup)
+		}
+	}
+	sort.SliceStable(rollups, func(i, j int) bool {
+		return rollups[i].Date.Before(rollups[j].Date)
+	})
+	return rollups, nil
+}
+
+// SumPageviews totals the pageviews of all rollups dated before the given
+// day. A day with both an imported rollup and one built from our own events
+// is counted once, from our own events.
+func (r *RollupRepository) SumPageviews(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total int64
+	for _, rollup := range r.rollups {
+		if rollup.DomainID != domainID || !rollup.Date.Before(before) {
+			continue
+		}
+		if rollup.Imported && r.index(domainID, rollup.Date, false) >= 0 {
+			continue
+		}
+		total += rollup.Pageviews
+	}
+	return total, nil
+}
+
+// DeleteBefore removes rollups built from our own events dated before the
+// given day. Imported rollups are kept.
+func (r *RollupRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.rollups[:0]
+	for _, rollup := range r.rollups {
+		if rollup.DomainID != domainID || !rollup.Date.Before(before) || rollup.Imported {
+			kept = append(kept, rollup)
+		}
+	}
+	deleted := int64(len(r.rollups) - len(kept))
+	r.rollups = kept
+	return deleted, nil
+}
+
+// index finds the rollup of one kind for a domain and day. Callers hold mu.
+func (r *RollupRepository) index(domainID primitive.ObjectID, date time.Time, imported bool) int {
+	for i, rollup := range r.rollups {
+		if rollup.DomainID == domainID && rollup.Date.Equal(date) && rollup.Imported == imported {
+			return i
+		}
+	}
+	return -1
+}
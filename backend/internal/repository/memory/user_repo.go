@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UserRepository struct {
+	mu    sync.Mutex
+	users []domain.User
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{}
+}
+
+var _ repository.UserStore = (*UserRepository)(nil)
+
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Email == user.Email {
+			return repository.ErrEmailTaken
+		}
+	}
+
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	r.users = append(r.users, *user)
+	return nil
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.ID == id {
+			return &u, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user.UpdatedAt = time.Now()
+	for i, u := range r.users {
+		if u.ID == user.ID {
+			r.users[i] = *user
+		}
+	}
+	return nil
+}
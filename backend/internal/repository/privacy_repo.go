@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PrivacyRequestRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPrivacyRequestRepository(db *mongo.Database) *PrivacyRequestRepository {
+	return &PrivacyRequestRepository{
+		collection: db.Collection("privacy_requests"),
+	}
+}
+
+func (r *PrivacyRequestRepository) Create(ctx context.Context, req *domain.PrivacyRequest) error {
+	req.CreatedAt = time.Now()
+	result, err := r.collection.InsertOne(ctx, req)
+	if err != nil {
+		return err
+	}
+	req.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *PrivacyRequestRepository) FindByDomainID(ctx context.Context, domainID primitive.ObjectID) ([]*domain.PrivacyRequest, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{"domain_id": domainID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	requests := []*domain.PrivacyRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PurchaseRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPurchaseRepository(db *mongo.Database) *PurchaseRepository {
+	return &PurchaseRepository{
+		collection: db.Collection("purchases"),
+	}
+}
+
+// Create records a purchase once per order. Repeated submissions of the same
+// order id for a domain (page reloads on the thank-you page) are ignored.
+func (r *PurchaseRepository) Create(ctx context.Context, purchase *domain.Purchase) error {
+	if purchase.Timestamp.IsZero() {
+		purchase.Timestamp = time.Now()
+	}
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"domain_id": purchase.DomainID, "order_id": purchase.OrderID},
+		bson.M{"$setOnInsert": purchase},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *PurchaseRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.Purchase, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{"domain_id": domainID, "visitor_id": visitorID},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	purchases := []*domain.Purchase{}
+	if err := cursor.All(ctx, &purchases); err != nil {
+		return nil, err
+	}
+	return purchases, nil
+}
+
+// DetachVisitor removes the visitor id from a visitor's orders. The orders
+// themselves are kept so revenue totals stay correct after an erasure.
+func (r *PurchaseRepository) DetachVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	result, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"domain_id": domainID, "visitor_id": visitorID},
+		bson.M{"$set": bson.M{"visitor_id": ""}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *PurchaseRepository) GetRevenueStats(ctx context.Context, domainID primitive.ObjectID, currency string, since time.Time) (*domain.RevenueStats, error) {
+	breakdown := func(field string) bson.A {
+		return bson.A{
+			bson.M{"$group": bson.M{
+				"_id":     field,
+				"revenue": bson.M{"$sum": "$total"},
+				"orders":  bson.M{"$sum": 1},
+			}},
+			bson.M{"$sort": bson.D{{Key: "revenue", Value: -1}}},
+			bson.M{"$limit": 20},
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"domain_id": domainID,
+			"currency":  currency,
+			"timestamp": bson.M{"$gte": since},
+		}}},
+		{{Key: "$facet", Value: bson.M{
+			"summary": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":     nil,
+					"revenue": bson.M{"$sum": "$total"},
+					"orders":  bson.M{"$sum": 1},
+				}},
+			},
+			"by_source":       breakdown("$source"),
+			"by_campaign":     breakdown("$campaign"),
+			"by_landing_page": breakdown("$landing_page"),
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Summary       []domain.RevenueBreakdown `bson:"summary"`
+		BySource      []domain.RevenueBreakdown `bson:"by_source"`
+		ByCampaign    []domain.RevenueBreakdown `bson:"by_campaign"`
+		ByLandingPage []domain.RevenueBreakdown `bson:"by_landing_page"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, err
+	}
+
+	stats := &domain.RevenueStats{
+		Currency:      currency,
+		BySource:      []domain.RevenueBreakdown{},
+		ByCampaign:    []domain.RevenueBreakdown{},
+		ByLandingPage: []domain.RevenueBreakdown{},
+	}
+	if len(result) == 0 {
+		return stats, nil
+	}
+
+	facets := result[0]
+	if len(facets.Summary) > 0 {
+		stats.Revenue = facets.Summary[0].Revenue
+		stats.Orders = facets.Summary[0].Orders
+	}
+	if stats.Orders > 0 {
+		stats.AverageOrderValue = stats.Revenue / float64(stats.Orders)
+	}
+	if facets.BySource != nil {
+		stats.BySource = facets.BySource
+	}
+	if facets.ByCampaign != nil {
+		stats.ByCampaign = facets.ByCampaign
+	}
+	if facets.ByLandingPage != nil {
+		stats.ByLandingPage = facets.ByLandingPage
+	}
+	return stats, nil
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RollupRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRollupRepository(db *mongo.Database) *RollupRepository {
+	return &RollupRepository{
+		collection: db.Collection("daily_rollups"),
+	}
+}
+
+// Upsert replaces the rollup built from our own events for the rollup's
+// domain and date. Imported rollups for the same day are left alone.
+func (r *RollupRepository) Upsert(ctx context.Context, rollup *domain.DailyRollup) error {
+	rollup.UpdatedAt = time.Now()
+	rollup.Imported = false
+	_, err := r.collection.ReplaceOne(
+		ctx,
+		bson.M{"domain_id": rollup.DomainID, "date": rollup.Date, "imported": bson.M{"$ne": true}},
+		rollup,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// UpsertImported writes the given fields of an imported rollup, leaving
+// fields supplied by earlier imports of other files for that day untouched.
+func (r *RollupRepository) UpsertImported(ctx context.Context, rollup *domain.DailyRollup, fields []string) error {
+	values := map[string]interface{}{
+		"pageviews": rollup.Pageviews,
+		"visitors":  rollup.Visitors,
+		"pages":     rollup.Pages,
+		"referrers": rollup.Referrers,
+		"countries": rollup.Countries,
+		"devices":   rollup.Devices,
+		"browsers":  rollup.Browsers,
+	}
+
+	set := bson.M{
+		"import_source": rollup.ImportSource,
+		"updated_at":    time.Now(),
+	}
+	for _, field := range fields {
+		set[field] = values[field]
+		delete(values, field)
+	}
+
+	// Fields not covered by this import start out empty on a new rollup
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"domain_id": rollup.DomainID, "date": rollup.Date, "imported": true},
+		bson.M{"$set": set, "$setOnInsert": values},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Exists reports whether a rollup built from our own events exists for date.
+func (r *RollupRepository) Exists(ctx context.Context, domainID primitive.ObjectID, date time.Time) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"domain_id": domainID, "date": date, "imported": bson.M{"$ne": true}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BuiltDates lists the dates in [from, to) that have a rollup built from our
+// own events, reading only their dates.
+func (r *RollupRepository) BuiltDates(ctx context.Context, domainID primitive.ObjectID, from, to time.Time) ([]time.Time, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{
+			"domain_id": domainID,
+			"date":      bson.M{"$gte": from, "$lt": to},
+			"imported":  bson.M{"$ne": true},
+		},
+		options.Find().SetSort(bson.D{{Key: "date", Value: 1}}).SetProjection(bson.M{"date": 1, "_id": 0}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	dates := []time.Time{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			Date time.Time `bson:"date"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		dates = append(dates, doc.Date)
+	}
+	return dates, cursor.Err()
+}
+
+func (r *RollupRepository) FindRange(ctx context.Context, domainID primitive.ObjectID, from, to time.Time) ([]*domain.DailyRollup, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{
+			"domain_id": domainID,
+			"date":      bson.M{"$gte": from, "$lt": to},
+		},
+		options.Find().SetSort(bson.D{{Key: "date", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rollups := []*domain.DailyRollup{}
+	if err := cursor.All(ctx, &rollups); err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
+
+// SumPageviews totals the pageviews of all rollups dated before the given
+// day. A day with both an imported rollup and one built from our own events
+// is counted once, from our own events.
+func (r *RollupRepository) SumPageviews(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	native := bson.M{"$ne": bson.A{"$imported", true}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"domain_id": domainID,
+			"date":      bson.M{"$lt": before},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$date",
+			"native":   bson.M{"$sum": bson.M{"$cond": bson.A{native, "$pageviews", 0}}},
+			"imported": bson.M{"$sum": bson.M{"$cond": bson.A{native, 0, "$pageviews"}}},
+			"tracked":  bson.M{"$max": native},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"total": bson.M{"$sum": bson.M{"$cond": bson.A{"$tracked", "$native", "$imported"}}},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+
+	if len(result) > 0 {
+		return result[0].Total, nil
+	}
+	return 0, nil
+}
+
+// DeleteBefore removes rollups built from our own events dated before the
+// given day. Imported rollups are kept: they are all that is left of the
+// history from before tracking started.
+func (r *RollupRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{
+		"domain_id": domainID,
+		"date":      bson.M{"$lt": before},
+		"imported":  bson.M{"$ne": true},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,194 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const alertRuleColumns = "id, domain_id, user_id, type, threshold, minutes, webhook_url, secret, enabled, firing, last_value, last_checked_at, created_at, updated_at"
+
+type AlertRuleRepository struct {
+	db *sql.DB
+}
+
+func NewAlertRuleRepository(db *sql.DB) *AlertRuleRepository {
+	return &AlertRuleRepository{db: db}
+}
+
+var _ repository.AlertRuleStore = (*AlertRuleRepository)(nil)
+
+func (r *AlertRuleRepository) Create(ctx context.Context, rule *domain.AlertRule) error {
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = time.Now()
+	id := newID(rule.ID)
+
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO alert_rules ("+alertRuleColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id.Hex(), rule.DomainID.Hex(), rule.UserID.Hex(), rule.Type, rule.Threshold, rule.Minutes,
+		rule.WebhookURL, rule.Secret, rule.Enabled, rule.Firing, rule.LastValue, millis(rule.LastCheckedAt),
+		millis(rule.CreatedAt), millis(rule.UpdatedAt),
+	)
+	if err != nil {
+		return err
+	}
+	rule.ID = id
+	return nil
+}
+
+func (r *AlertRuleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*domain.AlertRule, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+alertRuleColumns+" FROM alert_rules WHERE id = ?", id.Hex())
+	return scanAlertRule(row)
+}
+
+func (r *AlertRuleRepository) FindByDomainID(ctx context.Context, domainID primitive.ObjectID) ([]*domain.AlertRule, error) {
+	return r.query(ctx, "SELECT "+alertRuleColumns+" FROM alert_rules WHERE domain_id = ? ORDER BY created_at", domainID.Hex())
+}
+
+func (r *AlertRuleRepository) FindEnabled(ctx context.Context) ([]*domain.AlertRule, error) {
+	return r.query(ctx, "SELECT "+alertRuleColumns+" FROM alert_rules WHERE enabled = 1 ORDER BY created_at")
+}
+
+func (r *AlertRuleRepository) Update(ctx context.Context, rule *domain.AlertRule) error {
+	rule.UpdatedAt = time.Now()
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE alert_rules SET domain_id = ?, user_id = ?, type = ?, threshold = ?, minutes = ?, webhook_url = ?,
+		secret = ?, enabled = ?, firing = ?, last_value = ?, last_checked_at = ?, created_at = ?, updated_at = ?
+		WHERE id = ?`,
+		rule.DomainID.Hex(), rule.UserID.Hex(), rule.Type, rule.Threshold, rule.Minutes, rule.WebhookURL,
+		rule.Secret, rule.Enabled, rule.Firing, rule.LastValue, millis(rule.LastCheckedAt),
+		millis(rule.CreatedAt), millis(rule.UpdatedAt), rule.ID.Hex(),
+	)
+	return err
+}
+
+func (r *AlertRuleRepository) UpdateState(ctx context.Context, id primitive.ObjectID, firing bool, value float64, checkedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE alert_rules SET firing = ?, last_value = ?, last_checked_at = ? WHERE id = ?",
+		firing, value, millis(checkedAt), id.Hex(),
+	)
+	return err
+}
+
+func (r *AlertRuleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM alert_rules WHERE id = ?", id.Hex())
+	return err
+}
+
+func (r *AlertRuleRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.AlertRule, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*domain.AlertRule{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func scanAlertRule(row rowScanner) (*domain.AlertRule, error) {
+	var (
+		rule                                domain.AlertRule
+		id, domainID, userID                string
+		lastCheckedAt, createdAt, updatedAt int64
+	)
+	err := row.Scan(&id, &domainID, &userID, &rule.Type, &rule.Threshold, &rule.Minutes,
+		&rule.WebhookURL, &rule.Secret, &rule.Enabled, &rule.Firing, &rule.LastValue, &lastCheckedAt,
+		&createdAt, &updatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if rule.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if rule.DomainID, err = primitive.ObjectIDFromHex(domainID); err != nil {
+		return nil, err
+	}
+	if rule.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	rule.LastCheckedAt = fromMillis(lastCheckedAt)
+	rule.CreatedAt = fromMillis(createdAt)
+	rule.UpdatedAt = fromMillis(updatedAt)
+	return &rule, nil
+}
+
+const alertDeliveryColumns = "id, rule_id, domain_id, event, url, payload, delivered, attempts, status_code, error, created_at"
+
+type AlertDeliveryRepository struct {
+	db *sql.DB
+}
+
+func NewAlertDeliveryRepository(db *sql.DB) *AlertDeliveryRepository {
+	return &AlertDeliveryRepository{db: db}
+}
+
+var _ repository.AlertDeliveryStore = (*AlertDeliveryRepository)(nil)
+
+func (r *AlertDeliveryRepository) Create(ctx context.Context, delivery *domain.AlertDelivery) error {
+	delivery.CreatedAt = time.Now()
+	id := newID(delivery.ID)
+
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO alert_deliveries ("+alertDeliveryColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id.Hex(), delivery.RuleID.Hex(), delivery.DomainID.Hex(), delivery.Event, delivery.URL, delivery.Payload,
+		delivery.Delivered, delivery.Attempts, delivery.StatusCode, delivery.Error, millis(delivery.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+	delivery.ID = id
+	return nil
+}
+
+func (r *AlertDeliveryRepository) FindByRuleID(ctx context.Context, ruleID primitive.ObjectID, limit int64) ([]*domain.AlertDelivery, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+alertDeliveryColumns+" FROM alert_deliveries WHERE rule_id = ? ORDER BY created_at DESC LIMIT ?",
+		ruleID.Hex(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*domain.AlertDelivery{}
+	for rows.Next() {
+		var (
+			delivery                     domain.AlertDelivery
+			id, deliveryRuleID, domainID string
+			createdAt                    int64
+		)
+		err := rows.Scan(&id, &deliveryRuleID, &domainID, &delivery.Event, &delivery.URL, &delivery.Payload,
+			&delivery.Delivered, &delivery.Attempts, &delivery.StatusCode, &delivery.Error, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		if delivery.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		if delivery.RuleID, err = primitive.ObjectIDFromHex(deliveryRuleID); err != nil {
+			return nil, err
+		}
+		if delivery.DomainID, err = primitive.ObjectIDFromHex(domainID); err != nil {
+			return nil, err
+		}
+		delivery.CreatedAt = fromMillis(createdAt)
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *AlertDeliveryRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	return rowsAffected(r.db.ExecContext(ctx, "DELETE FROM alert_deliveries WHERE created_at < ?", millis(before)))
+}
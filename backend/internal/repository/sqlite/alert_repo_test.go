@@ -0,0 +1,79 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository/sqlite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAlertRuleStateDoesNotUndoEdits(t *testing.T) {
+	rules := sqlite.NewAlertRuleRepository(newDB(t))
+	ctx := context.Background()
+	domainID := primitive.NewObjectID()
+
+	rule := &domain.AlertRule{DomainID: domainID, Type: "no_events", Minutes: 30, WebhookURL: "https://hooks.example.com/a", Enabled: true}
+	if err := rules.Create(ctx, rule); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	disabled := &domain.AlertRule{DomainID: domainID, Type: "errors_above", Threshold: 5, Minutes: 5, WebhookURL: "https://hooks.example.com/b"}
+	if err := rules.Create(ctx, disabled); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	enabled, err := rules.FindEnabled(ctx)
+	if err != nil || len(enabled) != 1 || enabled[0].ID != rule.ID {
+		t.Errorf("FindEnabled = %+v, %v, want only the enabled rule", enabled, err)
+	}
+
+	// An edit and a scheduler run touch different fields
+	rule.Minutes = 60
+	if err := rules.Update(ctx, rule); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	checkedAt := time.Now().UTC().Truncate(time.Millisecond)
+	if err := rules.UpdateState(ctx, rule.ID, true, 0, checkedAt); err != nil {
+		t.Fatalf("UpdateState: %v", err)
+	}
+	found, err := rules.FindByID(ctx, rule.ID)
+	if err != nil || found.Minutes != 60 || !found.Firing || !found.LastCheckedAt.Equal(checkedAt) {
+		t.Errorf("FindByID = %+v, %v, want the edit and the state", found, err)
+	}
+
+	if listed, err := rules.FindByDomainID(ctx, domainID); err != nil || len(listed) != 2 {
+		t.Errorf("FindByDomainID = %d rules, %v, want 2", len(listed), err)
+	}
+	if err := rules.Delete(ctx, rule.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := rules.FindByID(ctx, rule.ID); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindByID after Delete: error = %v, want mongo.ErrNoDocuments", err)
+	}
+}
+
+func TestAlertDeliveriesNewestFirst(t *testing.T) {
+	deliveries := sqlite.NewAlertDeliveryRepository(newDB(t))
+	ctx := context.Background()
+	ruleID := primitive.NewObjectID()
+
+	for _, event := range []string{"triggered", "resolved", "triggered"} {
+		if err := deliveries.Create(ctx, &domain.AlertDelivery{RuleID: ruleID, Event: event, Delivered: true, Attempts: 1, StatusCode: 200}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	latest, err := deliveries.FindByRuleID(ctx, ruleID, 2)
+	if err != nil || len(latest) != 2 || latest[0].Event != "triggered" || latest[1].Event != "resolved" {
+		t.Errorf("FindByRuleID = %+v, %v, want the latest two, newest first", latest, err)
+	}
+
+	if n, err := deliveries.DeleteBefore(ctx, time.Now().Add(time.Second)); err != nil || n != 3 {
+		t.Errorf("DeleteBefore = %d, %v, want 3", n, err)
+	}
+}
@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const apiKeyColumns = "id, user_id, key, domain_ids, revoked, created_at"
+
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+var _ repository.APIKeyStore = (*APIKeyRepository)(nil)
+
+func (r *APIKeyRepository) Create(ctx context.Context, apiKey *domain.APIKey) error {
+	apiKey.CreatedAt = time.Now()
+	id := newID(apiKey.ID)
+
+	domainIDs, err := toJSON(apiKey.DomainIDs)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO api_keys ("+apiKeyColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		id.Hex(), apiKey.UserID.Hex(), apiKey.Key, domainIDs, apiKey.Revoked, millis(apiKey.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+	apiKey.ID = id
+	return nil
+}
+
+func (r *APIKeyRepository) FindByKey(ctx context.Context, key string) (*domain.APIKey, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key = ? AND revoked = 0", key)
+	return scanAPIKey(row)
+}
+
+func (r *APIKeyRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]*domain.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? ORDER BY rowid", userID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*domain.APIKey
+	for rows.Next() {
+		apiKey, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, apiKey)
+	}
+	return keys, rows.Err()
+}
+
+func (r *APIKeyRepository) Revoke(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE api_keys SET revoked = 1 WHERE id = ?", id.Hex())
+	return err
+}
+
+func scanAPIKey(row rowScanner) (*domain.APIKey, error) {
+	var (
+		apiKey                domain.APIKey
+		id, userID, domainIDs string
+		createdAt             int64
+	)
+	if err := row.Scan(&id, &userID, &apiKey.Key, &domainIDs, &apiKey.Revoked, &createdAt); err != nil {
+		return nil, notFound(err)
+	}
+
+	var err error
+	if apiKey.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if apiKey.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	if err := fromJSON(domainIDs, &apiKey.DomainIDs); err != nil {
+		return nil, err
+	}
+	apiKey.CreatedAt = fromMillis(createdAt)
+	return &apiKey, nil
+}
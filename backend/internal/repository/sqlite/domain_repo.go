@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const domainColumns = "id, user_id, domain, verified, settings, created_at, updated_at"
+
+type DomainRepository struct {
+	db *sql.DB
+}
+
+func NewDomainRepository(db *sql.DB) *DomainRepository {
+	return &DomainRepository{db: db}
+}
+
+var _ repository.DomainStore = (*DomainRepository)(nil)
+
+func (r *DomainRepository) Create(ctx context.Context, d *domain.Domain) error {
+	d.CreatedAt = time.Now()
+	d.UpdatedAt = time.Now()
+	id := newID(d.ID)
+
+	settings, err := toJSON(d.Settings)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO domains ("+domainColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		id.Hex(), d.UserID.Hex(), d.Domain, d.Verified, settings, millis(d.CreatedAt), millis(d.UpdatedAt),
+	)
+	if err != nil {
+		return err
+	}
+	d.ID = id
+	return nil
+}
+
+func (r *DomainRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*domain.Domain, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+domainColumns+" FROM domains WHERE id = ?", id.Hex())
+	return scanDomain(row)
+}
+
+func (r *DomainRepository) FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]*domain.Domain, error) {
+	return r.query(ctx, "SELECT "+domainColumns+" FROM domains WHERE user_id = ? ORDER BY rowid", userID.Hex())
+}
+
+func (r *DomainRepository) FindAll(ctx context.Context) ([]*domain.Domain, error) {
+	return r.query(ctx, "SELECT "+domainColumns+" FROM domains ORDER BY rowid")
+}
+
+func (r *DomainRepository) Update(ctx context.Context, d *domain.Domain) error {
+	d.UpdatedAt = time.Now()
+
+	settings, err := toJSON(d.Settings)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`UPDATE domains SET user_id = ?, domain = ?, verified = ?, settings = ?, created_at = ?, updated_at = ?
+		WHERE id = ?`,
+		d.UserID.Hex(), d.Domain, d.Verified, settings, millis(d.CreatedAt), millis(d.UpdatedAt), d.ID.Hex(),
+	)
+	return err
+}
+
+func (r *DomainRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM domains WHERE id = ?", id.Hex())
+	return err
+}
+
+// query returns nil rather than an empty slice when nothing matches, as
+// cursor.All does.
+func (r *DomainRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.Domain, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []*domain.Domain
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+func scanDomain(row rowScanner) (*domain.Domain, error) {
+	var (
+		d                    domain.Domain
+		id, userID, settings string
+		createdAt, updatedAt int64
+	)
+	if err := row.Scan(&id, &userID, &d.Domain, &d.Verified, &settings, &createdAt, &updatedAt); err != nil {
+		return nil, notFound(err)
+	}
+
+	var err error
+	if d.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if d.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	if err := fromJSON(settings, &d.Settings); err != nil {
+		return nil, err
+	}
+	d.CreatedAt = fromMillis(createdAt)
+	d.UpdatedAt = fromMillis(updatedAt)
+	return &d, nil
+}
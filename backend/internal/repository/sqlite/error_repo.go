@@ -0,0 +1,123 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const errorColumns = "id, domain_id, timestamp, fingerprint, message, source, line_number, column_number, stack, path, browser, visitor_id"
+
+type ErrorRepository struct {
+	db *sql.DB
+}
+
+func NewErrorRepository(db *sql.DB) *ErrorRepository {
+	return &ErrorRepository{db: db}
+}
+
+var _ repository.ErrorStore = (*ErrorRepository)(nil)
+
+func (r *ErrorRepository) Create(ctx context.Context, event *domain.ErrorEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	_, err := r.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO error_events ("+errorColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		newID(event.ID).Hex(), event.DomainID.Hex(), millis(event.Timestamp), event.Fingerprint, event.Message, event.Source,
+		event.Line, event.Column, event.Stack, event.Path, event.Browser, event.VisitorID,
+	)
+	return err
+}
+
+func (r *ErrorRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.ErrorEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+errorColumns+" FROM error_events WHERE domain_id = ? AND visitor_id = ? ORDER BY timestamp",
+		domainID.Hex(), visitorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*domain.ErrorEvent{}
+	for rows.Next() {
+		var (
+			event        domain.ErrorEvent
+			id, domainID string
+			timestamp    int64
+		)
+		err := rows.Scan(&id, &domainID, &timestamp, &event.Fingerprint, &event.Message, &event.Source,
+			&event.Line, &event.Column, &event.Stack, &event.Path, &event.Browser, &event.VisitorID)
+		if err != nil {
+			return nil, err
+		}
+		if event.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		if event.DomainID, err = primitive.ObjectIDFromHex(domainID); err != nil {
+			return nil, err
+		}
+		event.Timestamp = fromMillis(timestamp)
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+func (r *ErrorRepository) DeleteByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	return rowsAffected(r.db.ExecContext(ctx, "DELETE FROM error_events WHERE domain_id = ? AND visitor_id = ?", domainID.Hex(), visitorID))
+}
+
+// ListIssues groups errors since the given time by fingerprint, most
+// recently seen first. Each issue shows the details of its latest
+// occurrence.
+func (r *ErrorRepository) ListIssues(ctx context.Context, domainID primitive.ObjectID, since time.Time, limit int64) ([]*domain.ErrorIssue, error) {
+	// With a single MAX() aggregate, SQLite takes the other columns from
+	// the row holding the maximum, which gives the latest occurrence
+	rows, err := r.db.QueryContext(ctx, `
+		WITH recent AS (
+			SELECT * FROM error_events WHERE domain_id = ? AND timestamp >= ?
+		),
+		stats AS (
+			SELECT fingerprint, COUNT(*) AS occurrences, COUNT(DISTINCT NULLIF(visitor_id, '')) AS visitors,
+				MIN(timestamp) AS first_seen, MAX(timestamp) AS last_seen
+			FROM recent GROUP BY fingerprint
+		),
+		latest AS (
+			SELECT fingerprint, message, source, line_number, column_number, MAX(timestamp)
+			FROM recent GROUP BY fingerprint
+		)
+		SELECT stats.fingerprint, message, source, line_number, column_number, occurrences, visitors, first_seen, last_seen
+		FROM stats JOIN latest ON latest.fingerprint = stats.fingerprint
+		ORDER BY last_seen DESC, stats.fingerprint
+		LIMIT ?`,
+		domainID.Hex(), millis(since), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	issues := []*domain.ErrorIssue{}
+	for rows.Next() {
+		var (
+			issue               domain.ErrorIssue
+			firstSeen, lastSeen int64
+		)
+		err := rows.Scan(&issue.Fingerprint, &issue.Message, &issue.Source, &issue.Line, &issue.Column,
+			&issue.Occurrences, &issue.AffectedVisitors, &firstSeen, &lastSeen)
+		if err != nil {
+			return nil, err
+		}
+		issue.FirstSeen = fromMillis(firstSeen)
+		issue.LastSeen = fromMillis(lastSeen)
+		issues = append(issues, &issue)
+	}
+	return issues, rows.Err()
+}
+
+func (r *ErrorRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	return rowsAffected(r.db.ExecContext(ctx, "DELETE FROM error_events WHERE domain_id = ? AND timestamp < ?", domainID.Hex(), millis(before)))
+}
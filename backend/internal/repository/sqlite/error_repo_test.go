@@ -0,0 +1,123 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository/sqlite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestErrorIssuesGroupByFingerprint(t *testing.T) {
+	errorEvents := sqlite.NewErrorRepository(newDB(t))
+	ctx := context.Background()
+	domainID := primitive.NewObjectID()
+
+	for _, event := range []*domain.ErrorEvent{
+		{DomainID: domainID, Fingerprint: "a", Message: "old message", Line: 1, VisitorID: "v1"},
+		{DomainID: domainID, Fingerprint: "a", Message: "new message", Line: 2, VisitorID: "v2"},
+		{DomainID: domainID, Fingerprint: "a", Message: "new message", Line: 2, VisitorID: "v2"},
+		{DomainID: domainID, Fingerprint: "b", Message: "other", VisitorID: "v1"},
+		{DomainID: primitive.NewObjectID(), Fingerprint: "a", Message: "elsewhere"},
+	} {
+		if err := errorEvents.Create(ctx, event); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		// Timestamps are set on insert; keep them apart
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	issues, err := errorEvents.ListIssues(ctx, domainID, time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatalf("ListIssues: %v", err)
+	}
+	if len(issues) != 2 || issues[0].Fingerprint != "b" {
+		t.Fatalf("issues = %+v, want b (seen last) then a", issues)
+	}
+	a := issues[1]
+	if a.Occurrences != 3 || a.AffectedVisitors != 2 || a.Message != "new message" || a.Line != 2 {
+		t.Errorf("issue a = %+v, want 3 occurrences by 2 visitors showing the latest message", a)
+	}
+	if !a.FirstSeen.Before(a.LastSeen) {
+		t.Errorf("issue a first seen %v, last seen %v", a.FirstSeen, a.LastSeen)
+	}
+	if limited, err := errorEvents.ListIssues(ctx, domainID, time.Now().Add(-time.Hour), 1); err != nil || len(limited) != 1 {
+		t.Errorf("ListIssues limited to 1 = %d issues, %v", len(limited), err)
+	}
+
+	if n, err := errorEvents.DeleteByVisitor(ctx, domainID, "v1"); err != nil || n != 2 {
+		t.Errorf("DeleteByVisitor = %d, %v, want 2", n, err)
+	}
+	if n, err := errorEvents.DeleteBefore(ctx, domainID, time.Now().Add(time.Second)); err != nil || n != 2 {
+		t.Errorf("DeleteBefore = %d, %v, want the 2 left", n, err)
+	}
+}
+
+func TestErrorEventsSkipRedeliveredIDs(t *testing.T) {
+	errorEvents := sqlite.NewErrorRepository(newDB(t))
+	ctx := context.Background()
+	domainID := primitive.NewObjectID()
+	at := time.Now().UTC().Truncate(time.Millisecond).Add(-time.Minute)
+
+	event := &domain.ErrorEvent{ID: primitive.NewObjectID(), DomainID: domainID, Timestamp: at, Fingerprint: "a", Message: "boom", VisitorID: "v1"}
+	for i := 0; i < 2; i++ {
+		redelivered := *event
+		if err := errorEvents.Create(ctx, &redelivered); err != nil {
+			t.Fatalf("Create %d: %v", i+1, err)
+		}
+	}
+
+	found, err := errorEvents.FindByVisitor(ctx, domainID, "v1")
+	if err != nil || len(found) != 1 {
+		t.Fatalf("FindByVisitor = %d events, %v, want 1", len(found), err)
+	}
+	if !found[0].Timestamp.Equal(at) {
+		t.Errorf("timestamp = %v, want the one it was published with, %v", found[0].Timestamp, at)
+	}
+}
+
+func TestPurchasesAreCountedOncePerOrder(t *testing.T) {
+	purchases := sqlite.NewPurchaseRepository(newDB(t))
+	ctx := context.Background()
+	domainID := primitive.NewObjectID()
+	// When the order was tracked, not when the worker stored it
+	placed := time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+
+	for _, purchase := range []*domain.Purchase{
+		{DomainID: domainID, OrderID: "1", Currency: "EUR", Total: 30, Items: []domain.LineItem{}, VisitorID: "v1", Source: "google", Campaign: "(none)", LandingPage: "/"},
+		{DomainID: domainID, OrderID: "1", Currency: "EUR", Total: 30, Items: []domain.LineItem{}, VisitorID: "v1", Source: "google", Campaign: "(none)", LandingPage: "/"},
+		{DomainID: domainID, OrderID: "2", Currency: "EUR", Total: 10, Items: []domain.LineItem{}, VisitorID: "v2", Source: "(direct)", Campaign: "(none)", LandingPage: "/", Timestamp: placed},
+		{DomainID: domainID, OrderID: "3", Currency: "USD", Total: 99, Items: []domain.LineItem{}, Source: "(direct)", Campaign: "(none)", LandingPage: "/"},
+	} {
+		if err := purchases.Create(ctx, purchase); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	stats, err := purchases.GetRevenueStats(ctx, domainID, "EUR", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetRevenueStats: %v", err)
+	}
+	if stats.Revenue != 40 || stats.Orders != 2 || stats.AverageOrderValue != 20 {
+		t.Errorf("stats = %+v, want 40 EUR over 2 orders", stats)
+	}
+	if len(stats.BySource) != 2 || stats.BySource[0].Key != "google" || stats.BySource[0].Revenue != 30 {
+		t.Errorf("by source = %+v, want google first", stats.BySource)
+	}
+
+	if found, err := purchases.FindByVisitor(ctx, domainID, "v2"); err != nil || len(found) != 1 || !found[0].Timestamp.Equal(placed) {
+		t.Errorf("FindByVisitor(v2) = %+v, %v, want the order at %v", found, err, placed)
+	}
+
+	if n, err := purchases.DetachVisitor(ctx, domainID, "v1"); err != nil || n != 1 {
+		t.Errorf("DetachVisitor = %d, %v, want 1", n, err)
+	}
+	if found, err := purchases.FindByVisitor(ctx, domainID, "v1"); err != nil || len(found) != 0 {
+		t.Errorf("FindByVisitor after DetachVisitor = %d orders, %v, want none", len(found), err)
+	}
+	if stats, err := purchases.GetRevenueStats(ctx, domainID, "EUR", time.Now().Add(-time.Hour)); err != nil || stats.Revenue != 40 {
+		t.Errorf("revenue after DetachVisitor = %+v, %v, want it kept", stats, err)
+	}
+}
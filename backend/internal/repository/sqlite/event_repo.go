@@ -0,0 +1,274 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const eventColumns = "id, domain_id, timestamp, ip_hash, user_agent, path, referrer, country, device, browser, visitor_id"
+
+// eventFields are the event columns a breakdown may group by.
+var eventFields = map[string]bool{
+	"path":       true,
+	"referrer":   true,
+	"country":    true,
+	"device":     true,
+	"browser":    true,
+	"visitor_id": true,
+}
+
+type EventRepository struct {
+	db *sql.DB
+}
+
+func NewEventRepository(db *sql.DB) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+var _ repository.EventStore = (*EventRepository)(nil)
+
+// Create stores an event. The timestamp is only filled in when the caller
+// left it unset, so backdated events keep their original time.
+func (r *EventRepository) Create(ctx context.Context, event *domain.Event) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	_, err := r.db.ExecContext(ctx, "INSERT INTO events ("+eventColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", eventArgs(event)...)
+	return err
+}
+
+// CreateMany inserts events in one transaction. Events whose id already
+// exists are skipped, so a redelivered batch is safe to write again; any
+// other failure fails the whole batch.
+func (r *EventRepository) CreateMany(ctx context.Context, events []*domain.Event) (map[int]error, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT OR IGNORE INTO events ("+eventColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		if event.Timestamp.IsZero() {
+			event.Timestamp = time.Now()
+		}
+		if _, err := stmt.ExecContext(ctx, eventArgs(event)...); err != nil {
+			return nil, err
+		}
+	}
+	return nil, tx.Commit()
+}
+
+func (r *EventRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.Event, error) {
+	events := []*domain.Event{}
+	err := r.query(ctx, func(event *domain.Event) error {
+		events = append(events, event)
+		return nil
+	}, "SELECT "+eventColumns+" FROM events WHERE domain_id = ? AND visitor_id = ? ORDER BY timestamp",
+		domainID.Hex(), visitorID)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *EventRepository) DeleteByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	return rowsAffected(r.db.ExecContext(ctx, "DELETE FROM events WHERE domain_id = ? AND visitor_id = ?", domainID.Hex(), visitorID))
+}
+
+func (r *EventRepository) CountTotal(ctx context.Context, domainID primitive.ObjectID) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM events WHERE domain_id = ?", domainID.Hex()).Scan(&count)
+	return count, err
+}
+
+// AggregateDay builds the rollup for events in [start, end).
+func (r *EventRepository) AggregateDay(ctx context.Context, domainID primitive.ObjectID, start, end time.Time) (*domain.DailyRollup, error) {
+	args := []interface{}{domainID.Hex(), millis(start), millis(end)}
+	const where = "domain_id = ? AND timestamp >= ? AND timestamp < ?"
+
+	rollup := &domain.DailyRollup{
+		DomainID:  domainID,
+		Date:      start,
+		Pages:     []domain.PageStats{},
+		Referrers: []domain.ReferrerStats{},
+		Countries: make(map[string]int),
+		Devices:   make(map[string]int),
+		Browsers:  make(map[string]int),
+	}
+
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*), COUNT(DISTINCT NULLIF(visitor_id, '')) FROM events WHERE "+where, args...,
+	).Scan(&rollup.Pageviews, &rollup.Visitors)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.countBy(ctx, "path", where, args, 100, func(key string, count int) {
+		rollup.Pages = append(rollup.Pages, domain.PageStats{Path: key, Hits: count})
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = r.countBy(ctx, "referrer", where+" AND referrer != ''", args, 100, func(key string, count int) {
+		rollup.Referrers = append(rollup.Referrers, domain.ReferrerStats{Referrer: key, Hits: count})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for field, counts := range map[string]map[string]int{
+		"country": rollup.Countries,
+		"device":  rollup.Devices,
+		"browser": rollup.Browsers,
+	} {
+		err := r.countBy(ctx, field, where, args, 0, func(key string, count int) {
+			counts[key] = count
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rollup, nil
+}
+
+// OldestTimestamp returns the timestamp of the domain's oldest raw event, or
+// false if the domain has none.
+func (r *EventRepository) OldestTimestamp(ctx context.Context, domainID primitive.ObjectID) (time.Time, bool, error) {
+	var oldest sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "SELECT MIN(timestamp) FROM events WHERE domain_id = ?", domainID.Hex()).Scan(&oldest)
+	if err != nil || !oldest.Valid {
+		return time.Time{}, false, err
+	}
+	return fromMillis(oldest.Int64), true, nil
+}
+
+func (r *EventRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	return rowsAffected(r.db.ExecContext(ctx, "DELETE FROM events WHERE domain_id = ? AND timestamp < ?", domainID.Hex(), millis(before)))
+}
+
+// StreamRange calls fn for every event in [from, to) in timestamp order,
+// reading one row at a time so large ranges never sit in memory.
+func (r *EventRepository) StreamRange(ctx context.Context, domainID primitive.ObjectID, from, to time.Time, fn func(*domain.Event) error) error {
+	return r.query(ctx, fn,
+		"SELECT "+eventColumns+" FROM events WHERE domain_id = ? AND timestamp >= ? AND timestamp < ? ORDER BY timestamp",
+		domainID.Hex(), millis(from), millis(to))
+}
+
+// StreamBreakdown groups events in [from, to) by field and calls fn for each
+// group, busiest first.
+func (r *EventRepository) StreamBreakdown(ctx context.Context, domainID primitive.ObjectID, field string, from, to time.Time, fn func(*domain.BreakdownRow) error) error {
+	// Column names cannot be bound, so only known ones are used
+	if !eventFields[field] {
+		return fmt.Errorf("unknown event field %q", field)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+field+", COUNT(*) AS hits, COUNT(DISTINCT NULLIF(visitor_id, '')) FROM events "+
+			"WHERE domain_id = ? AND timestamp >= ? AND timestamp < ? GROUP BY "+field+" ORDER BY hits DESC",
+		domainID.Hex(), millis(from), millis(to))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row domain.BreakdownRow
+		if err := rows.Scan(&row.Key, &row.Hits, &row.Visitors); err != nil {
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *EventRepository) query(ctx context.Context, fn func(*domain.Event) error, query string, args ...interface{}) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// countBy counts events matching where by field, busiest first, keeping at
+// most limit groups when limit is positive.
+func (r *EventRepository) countBy(ctx context.Context, field, where string, args []interface{}, limit int, fn func(key string, count int)) error {
+	query := "SELECT " + field + ", COUNT(*) AS n FROM events WHERE " + where + " GROUP BY " + field + " ORDER BY n DESC, " + field
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key   string
+			count int
+		)
+		if err := rows.Scan(&key, &count); err != nil {
+			return err
+		}
+		fn(key, count)
+	}
+	return rows.Err()
+}
+
+func eventArgs(event *domain.Event) []interface{} {
+	// As with the Mongo driver, an event without an id is stored under a
+	// fresh one that the caller does not see
+	return []interface{}{
+		newID(event.ID).Hex(), event.DomainID.Hex(), millis(event.Timestamp),
+		event.IPHash, event.UserAgent, event.Path, event.Referrer,
+		event.Country, event.Device, event.Browser, event.VisitorID,
+	}
+}
+
+func scanEvent(row rowScanner) (*domain.Event, error) {
+	var (
+		event        domain.Event
+		id, domainID string
+		timestamp    int64
+	)
+	err := row.Scan(&id, &domainID, &timestamp, &event.IPHash, &event.UserAgent, &event.Path, &event.Referrer,
+		&event.Country, &event.Device, &event.Browser, &event.VisitorID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if event.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if event.DomainID, err = primitive.ObjectIDFromHex(domainID); err != nil {
+		return nil, err
+	}
+	event.Timestamp = fromMillis(timestamp)
+	return &event, nil
+}
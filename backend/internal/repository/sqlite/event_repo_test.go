@@ -0,0 +1,115 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository/sqlite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testEvents(domainID primitive.ObjectID, at time.Time) []*domain.Event {
+	return []*domain.Event{
+		{ID: primitive.NewObjectID(), DomainID: domainID, Timestamp: at, Path: "/", Referrer: "https://news.example.org/", Country: "DE", Device: "desktop", Browser: "Firefox", VisitorID: "v1"},
+		{ID: primitive.NewObjectID(), DomainID: domainID, Timestamp: at.Add(time.Minute), Path: "/pricing", Country: "DE", Device: "desktop", Browser: "Firefox", VisitorID: "v1"},
+		{ID: primitive.NewObjectID(), DomainID: domainID, Timestamp: at.Add(2 * time.Minute), Path: "/", Country: "FR", Device: "mobile", Browser: "Safari", VisitorID: "v2"},
+	}
+}
+
+func TestEventsSkipRedeliveredIDs(t *testing.T) {
+	events := sqlite.NewEventRepository(newDB(t))
+	ctx := context.Background()
+	domainID := primitive.NewObjectID()
+	at := time.Now().UTC().Truncate(time.Millisecond).Add(-time.Hour)
+
+	batch := testEvents(domainID, at)
+	if _, err := events.CreateMany(ctx, batch); err != nil {
+		t.Fatalf("CreateMany: %v", err)
+	}
+	// A redelivered batch with one new event
+	redelivered := append(batch[1:], &domain.Event{DomainID: domainID, Timestamp: at, Path: "/about"})
+	if failed, err := events.CreateMany(ctx, redelivered); err != nil || len(failed) != 0 {
+		t.Fatalf("CreateMany of a redelivered batch = %v, %v, want no failures", failed, err)
+	}
+
+	if n, err := events.CountTotal(ctx, domainID); err != nil || n != 4 {
+		t.Errorf("CountTotal = %d, %v, want 4", n, err)
+	}
+	found, err := events.FindByVisitor(ctx, domainID, "v1")
+	if err != nil || len(found) != 2 {
+		t.Fatalf("FindByVisitor = %d events, %v, want 2", len(found), err)
+	}
+	if got := found[0]; got.ID != batch[0].ID || !got.Timestamp.Equal(at) || got.Referrer != batch[0].Referrer {
+		t.Errorf("first event = %+v, want %+v", got, batch[0])
+	}
+}
+
+func TestEventsAggregateAndDelete(t *testing.T) {
+	events := sqlite.NewEventRepository(newDB(t))
+	ctx := context.Background()
+	domainID := primitive.NewObjectID()
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -2)
+
+	batch := testEvents(domainID, day.Add(10*time.Hour))
+	batch = append(batch, &domain.Event{ID: primitive.NewObjectID(), DomainID: domainID, Timestamp: day.AddDate(0, 0, 1).Add(time.Hour), Path: "/", VisitorID: "v3"})
+	if _, err := events.CreateMany(ctx, batch); err != nil {
+		t.Fatalf("CreateMany: %v", err)
+	}
+
+	rollup, err := events.AggregateDay(ctx, domainID, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("AggregateDay: %v", err)
+	}
+	if rollup.Pageviews != 3 || rollup.Visitors != 2 {
+		t.Errorf("rollup = %d pageviews, %d visitors, want 3 and 2", rollup.Pageviews, rollup.Visitors)
+	}
+	if len(rollup.Pages) != 2 || rollup.Pages[0] != (domain.PageStats{Path: "/", Hits: 2}) {
+		t.Errorf("pages = %+v, want / with 2 hits first", rollup.Pages)
+	}
+	if len(rollup.Referrers) != 1 || rollup.Referrers[0].Hits != 1 {
+		t.Errorf("referrers = %+v, want one referrer", rollup.Referrers)
+	}
+	if rollup.Countries["DE"] != 2 || rollup.Devices["mobile"] != 1 || rollup.Browsers["Safari"] != 1 {
+		t.Errorf("breakdowns = %v %v %v", rollup.Countries, rollup.Devices, rollup.Browsers)
+	}
+
+	var rows []*domain.BreakdownRow
+	err = events.StreamBreakdown(ctx, domainID, "path", day, day.AddDate(0, 0, 2), func(row *domain.BreakdownRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamBreakdown: %v", err)
+	}
+	if len(rows) != 2 || *rows[0] != (domain.BreakdownRow{Key: "/", Hits: 3, Visitors: 3}) {
+		t.Errorf("path breakdown = %+v, want / with 3 hits from 3 visitors first", rows)
+	}
+	if err := events.StreamBreakdown(ctx, domainID, "ip_hash", day, day, nil); err == nil {
+		t.Error("StreamBreakdown grouped by a field it does not allow")
+	}
+
+	oldest, ok, err := events.OldestTimestamp(ctx, domainID)
+	if err != nil || !ok || !oldest.Equal(batch[0].Timestamp) {
+		t.Errorf("OldestTimestamp = %v, %v, %v, want %v", oldest, ok, err, batch[0].Timestamp)
+	}
+	if _, ok, err := events.OldestTimestamp(ctx, primitive.NewObjectID()); err != nil || ok {
+		t.Errorf("OldestTimestamp of a domain without events = %v, %v, want none", ok, err)
+	}
+
+	if n, err := events.DeleteByVisitor(ctx, domainID, "v1"); err != nil || n != 2 {
+		t.Errorf("DeleteByVisitor = %d, %v, want 2", n, err)
+	}
+	if n, err := events.DeleteBefore(ctx, domainID, day.AddDate(0, 0, 1)); err != nil || n != 1 {
+		t.Errorf("DeleteBefore = %d, %v, want 1", n, err)
+	}
+	var left int
+	err = events.StreamRange(ctx, domainID, day, day.AddDate(0, 0, 2), func(*domain.Event) error {
+		left++
+		return nil
+	})
+	if err != nil || left != 1 {
+		t.Errorf("StreamRange = %d events, %v, want only v3's", left, err)
+	}
+}
@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const privacyRequestColumns = "id, domain_id, user_id, visitor_id, type, events_affected, errors_affected, orders_affected, created_at"
+
+type PrivacyRequestRepository struct {
+	db *sql.DB
+}
+
+func NewPrivacyRequestRepository(db *sql.DB) *PrivacyRequestRepository {
+	return &PrivacyRequestRepository{db: db}
+}
+
+var _ repository.PrivacyRequestStore = (*PrivacyRequestRepository)(nil)
+
+func (r *PrivacyRequestRepository) Create(ctx context.Context, req *domain.PrivacyRequest) error {
+	req.CreatedAt = time.Now()
+	id := newID(req.ID)
+
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO privacy_requests ("+privacyRequestColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id.Hex(), req.DomainID.Hex(), req.UserID.Hex(), req.VisitorID, req.Type,
+		req.EventsAffected, req.ErrorsAffected, req.OrdersAffected, millis(req.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+	req.ID = id
+	return nil
+}
+
+func (r *PrivacyRequestRepository) FindByDomainID(ctx context.Context, domainID primitive.ObjectID) ([]*domain.PrivacyRequest, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+privacyRequestColumns+" FROM privacy_requests WHERE domain_id = ? ORDER BY created_at DESC",
+		domainID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []*domain.PrivacyRequest{}
+	for rows.Next() {
+		var (
+			req                     domain.PrivacyRequest
+			id, reqDomainID, userID string
+			createdAt               int64
+		)
+		err := rows.Scan(&id, &reqDomainID, &userID, &req.VisitorID, &req.Type,
+			&req.EventsAffected, &req.ErrorsAffected, &req.OrdersAffected, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		if req.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		if req.DomainID, err = primitive.ObjectIDFromHex(reqDomainID); err != nil {
+			return nil, err
+		}
+		if req.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+			return nil, err
+		}
+		req.CreatedAt = fromMillis(createdAt)
+		requests = append(requests, &req)
+	}
+	return requests, rows.Err()
+}
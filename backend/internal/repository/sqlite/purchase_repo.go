@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const purchaseColumns = "id, domain_id, order_id, currency, total, items, visitor_id, source, campaign, landing_page, timestamp"
+
+type PurchaseRepository struct {
+	db *sql.DB
+}
+
+func NewPurchaseRepository(db *sql.DB) *PurchaseRepository {
+	return &PurchaseRepository{db: db}
+}
+
+var _ repository.PurchaseStore = (*PurchaseRepository)(nil)
+
+// Create records a purchase once per order. Repeated submissions of the same
+// order id for a domain (page reloads on the thank-you page) are ignored.
+func (r *PurchaseRepository) Create(ctx context.Context, purchase *domain.Purchase) error {
+	if purchase.Timestamp.IsZero() {
+		purchase.Timestamp = time.Now()
+	}
+
+	items, err := toJSON(purchase.Items)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO purchases ("+purchaseColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) "+
+			"ON CONFLICT (domain_id, order_id) DO NOTHING",
+		newID(purchase.ID).Hex(), purchase.DomainID.Hex(), purchase.OrderID, purchase.Currency, purchase.Total, items,
+		purchase.VisitorID, purchase.Source, purchase.Campaign, purchase.LandingPage, millis(purchase.Timestamp),
+	)
+	return err
+}
+
+func (r *PurchaseRepository) FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.Purchase, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+purchaseColumns+" FROM purchases WHERE domain_id = ? AND visitor_id = ? ORDER BY timestamp",
+		domainID.Hex(), visitorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purchases := []*domain.Purchase{}
+	for rows.Next() {
+		var (
+			purchase            domain.Purchase
+			id, domainID, items string
+			timestamp           int64
+		)
+		err := rows.Scan(&id, &domainID, &purchase.OrderID, &purchase.Currency, &purchase.Total, &items,
+			&purchase.VisitorID, &purchase.Source, &purchase.Campaign, &purchase.LandingPage, &timestamp)
+		if err != nil {
+			return nil, err
+		}
+		if purchase.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		if purchase.DomainID, err = primitive.ObjectIDFromHex(domainID); err != nil {
+			return nil, err
+		}
+		if err := fromJSON(items, &purchase.Items); err != nil {
+			return nil, err
+		}
+		purchase.Timestamp = fromMillis(timestamp)
+		purchases = append(purchases, &purchase)
+	}
+	return purchases, rows.Err()
+}
+
+// DetachVisitor removes the visitor id from a visitor's orders. The orders
+// themselves are kept so revenue totals stay correct after an erasure.
+func (r *PurchaseRepository) DetachVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error) {
+	// Orders already without a visitor are not counted as modified, as
+	// with Mongo's ModifiedCount
+	return rowsAffected(r.db.ExecContext(ctx,
+		"UPDATE purchases SET visitor_id = '' WHERE domain_id = ? AND visitor_id = ? AND visitor_id != ''",
+		domainID.Hex(), visitorID))
+}
+
+func (r *PurchaseRepository) GetRevenueStats(ctx context.Context, domainID primitive.ObjectID, currency string, since time.Time) (*domain.RevenueStats, error) {
+	args := []interface{}{domainID.Hex(), currency, millis(since)}
+	const where = "domain_id = ? AND currency = ? AND timestamp >= ?"
+
+	stats := &domain.RevenueStats{Currency: currency}
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(total), 0), COUNT(*) FROM purchases WHERE "+where, args...,
+	).Scan(&stats.Revenue, &stats.Orders)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Orders > 0 {
+		stats.AverageOrderValue = stats.Revenue / float64(stats.Orders)
+	}
+
+	breakdown := func(field string) ([]domain.RevenueBreakdown, error) {
+		rows, err := r.db.QueryContext(ctx,
+			"SELECT "+field+", SUM(total) AS revenue, COUNT(*) FROM purchases WHERE "+where+
+				" GROUP BY "+field+" ORDER BY revenue DESC, "+field+" LIMIT 20",
+			args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		groups := []domain.RevenueBreakdown{}
+		for rows.Next() {
+			var group domain.RevenueBreakdown
+			if err := rows.Scan(&group.Key, &group.Revenue, &group.Orders); err != nil {
+				return nil, err
+			}
+			groups = append(groups, group)
+		}
+		return groups, rows.Err()
+	}
+
+	if stats.BySource, err = breakdown("source"); err != nil {
+		return nil, err
+	}
+	if stats.ByCampaign, err = breakdown("campaign"); err != nil {
+		return nil, err
+	}
+	if stats.ByLandingPage, err = breakdown("landing_page"); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
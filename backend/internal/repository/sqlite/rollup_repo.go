@@ -0,0 +1,207 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const rollupColumns = "id, domain_id, date, imported, pageviews, visitors, pages, referrers, countries, devices, browsers, import_source, updated_at, visitor_sketch"
+
+// rollupFields are the fields UpsertImported may write.
+var rollupFields = map[string]bool{
+	"pageviews": true,
+	"visitors":  true,
+	"pages":     true,
+	"referrers": true,
+	"countries": true,
+	"devices":   true,
+	"browsers":  true,
+}
+
+type RollupRepository struct {
+	db *sql.DB
+}
+
+func NewRollupRepository(db *sql.DB) *RollupRepository {
+	return &RollupRepository{db: db}
+}
+
+var _ repository.RollupStore = (*RollupRepository)(nil)
+
+// Upsert replaces the rollup built from our own events for the rollup's
+// domain and date. Imported rollups for the same day are left alone.
+func (r *RollupRepository) Upsert(ctx context.Context, rollup *domain.DailyRollup) error {
+	rollup.UpdatedAt = time.Now()
+	rollup.Imported = false
+
+	args, err := rollupArgs(rollup)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO daily_rollups ("+rollupColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) "+
+			"ON CONFLICT (domain_id, date, imported) DO UPDATE SET "+
+			"pageviews = excluded.pageviews, visitors = excluded.visitors, pages = excluded.pages, "+
+			"referrers = excluded.referrers, countries = excluded.countries, devices = excluded.devices, "+
+			"browsers = excluded.browsers, import_source = excluded.import_source, updated_at = excluded.updated_at, "+
+			"visitor_sketch = excluded.visitor_sketch",
+		args...)
+	return err
+}
+
+// UpsertImported writes the given fields of an imported rollup, leaving
+// fields supplied by earlier imports of other files for that day untouched.
+func (r *RollupRepository) UpsertImported(ctx context.Context, rollup *domain.DailyRollup, fields []string) error {
+	stored := *rollup
+	stored.Imported = true
+	stored.UpdatedAt = time.Now()
+
+	args, err := rollupArgs(&stored)
+	if err != nil {
+		return err
+	}
+
+	// Fields not covered by this import start out as given on a new rollup
+	update := "import_source = excluded.import_source, updated_at = excluded.updated_at"
+	for _, field := range fields {
+		if rollupFields[field] {
+			update += ", " + field + " = excluded." + field
+		}
+	}
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO daily_rollups ("+rollupColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) "+
+			"ON CONFLICT (domain_id, date, imported) DO UPDATE SET "+update,
+		args...)
+	return err
+}
+
+// Exists reports whether a rollup built from our own events exists for date.
+func (r *RollupRepository) Exists(ctx context.Context, domainID primitive.ObjectID, date time.Time) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM daily_rollups WHERE domain_id = ? AND date = ? AND imported = 0)",
+		domainID.Hex(), millis(date),
+	).Scan(&exists)
+	return exists, err
+}
+
+// BuiltDates lists the dates in [from, to) that have a rollup built from our
+// own events.
+func (r *RollupRepository) BuiltDates(ctx context.Context, domainID primitive.ObjectID, from, to time.Time) ([]time.Time, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT date FROM daily_rollups WHERE domain_id = ? AND date >= ? AND date < ? AND imported = 0 ORDER BY date",
+		domainID.Hex(), millis(from), millis(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := []time.Time{}
+	for rows.Next() {
+		var date int64
+		if err := rows.Scan(&date); err != nil {
+			return nil, err
+		}
+		dates = append(dates, fromMillis(date))
+	}
+	return dates, rows.Err()
+}
+
+func (r *RollupRepository) FindRange(ctx context.Context, domainID primitive.ObjectID, from, to time.Time) ([]*domain.DailyRollup, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+rollupColumns+" FROM daily_rollups WHERE domain_id = ? AND date >= ? AND date < ? ORDER BY date",
+		domainID.Hex(), millis(from), millis(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollups := []*domain.DailyRollup{}
+	for rows.Next() {
+		rollup, err := scanRollup(rows)
+		if err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, rollup)
+	}
+	return rollups, rows.Err()
+}
+
+// SumPageviews totals the pageviews of all rollups dated before the given
+// day. A day with both an imported rollup and one built from our own events
+// is counted once, from our own events.
+func (r *RollupRepository) SumPageviews(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	var total int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(pageviews), 0) FROM daily_rollups r WHERE domain_id = ? AND date < ?
+		AND (imported = 0 OR NOT EXISTS (
+			SELECT 1 FROM daily_rollups n WHERE n.domain_id = r.domain_id AND n.date = r.date AND n.imported = 0))`,
+		domainID.Hex(), millis(before),
+	).Scan(&total)
+	return total, err
+}
+
+// DeleteBefore removes rollups built from our own events dated before the
+// given day. Imported rollups are kept.
+func (r *RollupRepository) DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error) {
+	return rowsAffected(r.db.ExecContext(ctx,
+		"DELETE FROM daily_rollups WHERE domain_id = ? AND date < ? AND imported = 0", domainID.Hex(), millis(before)))
+}
+
+func rollupArgs(rollup *domain.DailyRollup) ([]interface{}, error) {
+	args := []interface{}{
+		newID(rollup.ID).Hex(), rollup.DomainID.Hex(), millis(rollup.Date), rollup.Imported,
+		rollup.Pageviews, rollup.Visitors,
+	}
+	for _, v := range []interface{}{rollup.Pages, rollup.Referrers, rollup.Countries, rollup.Devices, rollup.Browsers} {
+		data, err := toJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, data)
+	}
+	return append(args, rollup.ImportSource, millis(rollup.UpdatedAt), rollup.VisitorSketch), nil
+}
+
+func scanRollup(row rowScanner) (*domain.DailyRollup, error) {
+	var (
+		rollup                                         domain.DailyRollup
+		id, domainID                                   string
+		pages, referrers, countries, devices, browsers string
+		date, updatedAt                                int64
+	)
+	err := row.Scan(&id, &domainID, &date, &rollup.Imported, &rollup.Pageviews, &rollup.Visitors,
+		&pages, &referrers, &countries, &devices, &browsers, &rollup.ImportSource, &updatedAt, &rollup.VisitorSketch)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if rollup.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if rollup.DomainID, err = primitive.ObjectIDFromHex(domainID); err != nil {
+		return nil, err
+	}
+	for _, field := range []struct {
+		data string
+		v    interface{}
+	}{
+		{pages, &rollup.Pages},
+		{referrers, &rollup.Referrers},
+		{countries, &rollup.Countries},
+		{devices, &rollup.Devices},
+		{browsers, &rollup.Browsers},
+	} {
+		if err := fromJSON(field.data, field.v); err != nil {
+			return nil, err
+		}
+	}
+	rollup.Date = fromMillis(date)
+	rollup.UpdatedAt = fromMillis(updatedAt)
+	return &rollup, nil
+}
@@ -0,0 +1,76 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository/sqlite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRollupsKeepImportedAlongsideTracked(t *testing.T) {
+	rollups := sqlite.NewRollupRepository(newDB(t))
+	ctx := context.Background()
+	domainID := primitive.NewObjectID()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	old, recent := today.AddDate(-2, 0, 0), today.AddDate(0, 0, -10)
+
+	tracked := &domain.DailyRollup{DomainID: domainID, Date: recent, Pageviews: 100, Countries: map[string]int{"DE": 100}, VisitorSketch: []byte("sketch")}
+	if err := rollups.Upsert(ctx, tracked); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	// Rebuilding the day replaces it
+	tracked.Pageviews = 110
+	if err := rollups.Upsert(ctx, tracked); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	// Two files of one import fill in different fields of the same day
+	if err := rollups.UpsertImported(ctx, &domain.DailyRollup{DomainID: domainID, Date: recent, Pageviews: 120}, []string{"pageviews"}); err != nil {
+		t.Fatalf("UpsertImported: %v", err)
+	}
+	if err := rollups.UpsertImported(ctx, &domain.DailyRollup{DomainID: domainID, Date: recent, Visitors: 40}, []string{"visitors"}); err != nil {
+		t.Fatalf("UpsertImported: %v", err)
+	}
+	if err := rollups.UpsertImported(ctx, &domain.DailyRollup{DomainID: domainID, Date: old, Pageviews: 50}, []string{"pageviews"}); err != nil {
+		t.Fatalf("UpsertImported: %v", err)
+	}
+
+	found, err := rollups.FindRange(ctx, domainID, recent, recent.AddDate(0, 0, 1))
+	if err != nil || len(found) != 2 {
+		t.Fatalf("FindRange = %d rollups, %v, want the tracked and the imported one", len(found), err)
+	}
+	for _, rollup := range found {
+		switch {
+		case rollup.Imported && (rollup.Pageviews != 120 || rollup.Visitors != 40):
+			t.Errorf("imported rollup = %+v, want 120 pageviews and 40 visitors", rollup)
+		case !rollup.Imported && (rollup.Pageviews != 110 || rollup.Countries["DE"] != 100 || string(rollup.VisitorSketch) != "sketch"):
+			t.Errorf("tracked rollup = %+v, want the rebuilt one", rollup)
+		}
+	}
+
+	if ok, err := rollups.Exists(ctx, domainID, recent); err != nil || !ok {
+		t.Errorf("Exists(recent) = %v, %v, want true", ok, err)
+	}
+	if ok, err := rollups.Exists(ctx, domainID, old); err != nil || ok {
+		t.Errorf("Exists(old) = %v, %v, want false for an imported-only day", ok, err)
+	}
+
+	if dates, err := rollups.BuiltDates(ctx, domainID, old, today); err != nil || len(dates) != 1 || !dates[0].Equal(recent) {
+		t.Errorf("BuiltDates = %v, %v, want only the recent day", dates, err)
+	}
+
+	// The recent day counts its tracked rollup only
+	if total, err := rollups.SumPageviews(ctx, domainID, today); err != nil || total != 160 {
+		t.Errorf("SumPageviews = %d, %v, want 50 imported + 110 tracked", total, err)
+	}
+
+	if n, err := rollups.DeleteBefore(ctx, domainID, today); err != nil || n != 1 {
+		t.Errorf("DeleteBefore = %d, %v, want only the tracked rollup removed", n, err)
+	}
+	if total, err := rollups.SumPageviews(ctx, domainID, today); err != nil || total != 170 {
+		t.Errorf("SumPageviews after DeleteBefore = %d, %v, want the imported 50 + 120", total, err)
+	}
+}
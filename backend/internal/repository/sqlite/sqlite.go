@@ -0,0 +1,268 @@
+// Package sqlite implements the repository Store interfaces on a single
+// SQLite file, for lite mode. Each repository mirrors its Mongo counterpart:
+// unique indexes, upserts, sort orders, the shape of aggregation results and
+// mongo.ErrNoDocuments for a missing document. Ids stay ObjectIDs (stored as
+// hex) so API responses look the same in both modes, times are stored as
+// Unix milliseconds as Mongo does, and nested values are stored as JSON.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// schema holds one entry per version, applied in order. The database's
+// user_version records how many have been applied; append new versions and
+// never edit old ones.
+var schema = []string{
+	// 1: initial tables and the indexes the Mongo migrations create
+	`CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		email TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		plan TEXT NOT NULL,
+		api_keys TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE domains (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		domain TEXT NOT NULL,
+		verified INTEGER NOT NULL,
+		settings TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX domains_user_id ON domains (user_id);
+
+	CREATE TABLE api_keys (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		key TEXT NOT NULL UNIQUE,
+		domain_ids TEXT NOT NULL,
+		revoked INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX api_keys_user_id ON api_keys (user_id);
+
+	CREATE TABLE events (
+		id TEXT PRIMARY KEY,
+		domain_id TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		ip_hash TEXT NOT NULL,
+		user_agent TEXT NOT NULL,
+		path TEXT NOT NULL,
+		referrer TEXT NOT NULL,
+		country TEXT NOT NULL,
+		device TEXT NOT NULL,
+		browser TEXT NOT NULL,
+		visitor_id TEXT NOT NULL
+	);
+	CREATE INDEX events_domain_timestamp ON events (domain_id, timestamp);
+	CREATE INDEX events_domain_visitor ON events (domain_id, visitor_id, timestamp);
+
+	CREATE TABLE error_events (
+		id TEXT PRIMARY KEY,
+		domain_id TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		fingerprint TEXT NOT NULL,
+		message TEXT NOT NULL,
+		source TEXT NOT NULL,
+		line_number INTEGER NOT NULL,
+		column_number INTEGER NOT NULL,
+		stack TEXT NOT NULL,
+		path TEXT NOT NULL,
+		browser TEXT NOT NULL,
+		visitor_id TEXT NOT NULL
+	);
+	CREATE INDEX error_events_domain_timestamp ON error_events (domain_id, timestamp);
+	CREATE INDEX error_events_domain_visitor ON error_events (domain_id, visitor_id, timestamp);
+
+	CREATE TABLE purchases (
+		id TEXT PRIMARY KEY,
+		domain_id TEXT NOT NULL,
+		order_id TEXT NOT NULL,
+		currency TEXT NOT NULL,
+		total REAL NOT NULL,
+		items TEXT NOT NULL,
+		visitor_id TEXT NOT NULL,
+		source TEXT NOT NULL,
+		campaign TEXT NOT NULL,
+		landing_page TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		UNIQUE (domain_id, order_id)
+	);
+	CREATE INDEX purchases_domain_timestamp ON purchases (domain_id, timestamp);
+	CREATE INDEX purchases_domain_visitor ON purchases (domain_id, visitor_id, timestamp);
+
+	CREATE TABLE daily_rollups (
+		id TEXT PRIMARY KEY,
+		domain_id TEXT NOT NULL,
+		date INTEGER NOT NULL,
+		imported INTEGER NOT NULL,
+		pageviews INTEGER NOT NULL,
+		visitors INTEGER NOT NULL,
+		pages TEXT NOT NULL,
+		referrers TEXT NOT NULL,
+		countries TEXT NOT NULL,
+		devices TEXT NOT NULL,
+		browsers TEXT NOT NULL,
+		import_source TEXT NOT NULL,
+		updated_at INTEGER NOT NULL,
+		UNIQUE (domain_id, date, imported)
+	);
+
+	CREATE TABLE privacy_requests (
+		id TEXT PRIMARY KEY,
+		domain_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		visitor_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		events_affected INTEGER NOT NULL,
+		errors_affected INTEGER NOT NULL,
+		orders_affected INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX privacy_requests_domain_created ON privacy_requests (domain_id, created_at);`,
+
+	// 2: unique visitor sketches saved with rollups
+	`ALTER TABLE daily_rollups ADD COLUMN visitor_sketch BLOB;`,
+
+	// 3: alert rules and their webhook delivery log
+	`CREATE TABLE alert_rules (
+		id TEXT PRIMARY KEY,
+		domain_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		threshold REAL NOT NULL,
+		minutes INTEGER NOT NULL,
+		webhook_url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		enabled INTEGER NOT NULL,
+		firing INTEGER NOT NULL,
+		last_value REAL NOT NULL,
+		last_checked_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX alert_rules_domain_id ON alert_rules (domain_id);
+	CREATE INDEX alert_rules_enabled ON alert_rules (enabled);
+
+	CREATE TABLE alert_deliveries (
+		id TEXT PRIMARY KEY,
+		rule_id TEXT NOT NULL,
+		domain_id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		url TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		delivered INTEGER NOT NULL,
+		attempts INTEGER NOT NULL,
+		status_code INTEGER NOT NULL,
+		error TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX alert_deliveries_rule_created ON alert_deliveries (rule_id, created_at);
+	CREATE INDEX alert_deliveries_created ON alert_deliveries (created_at);`,
+}
+
+// SchemaVersion returns the database's schema version and the latest one
+// Migrate would bring it to.
+func SchemaVersion(ctx context.Context, db *sql.DB) (current, latest int, err error) {
+	err = db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&current)
+	return current, len(schema), err
+}
+
+// Migrate brings the schema up to date and returns its version. Each version
+// is applied in its own transaction together with the version bump.
+func Migrate(ctx context.Context, db *sql.DB) (int, error) {
+	version, _, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	for ; version < len(schema); version++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return version, err
+		}
+		if _, err := tx.ExecContext(ctx, schema[version]); err != nil {
+			tx.Rollback()
+			return version, fmt.Errorf("applying schema version %d: %w", version+1, err)
+		}
+		// PRAGMA takes no parameters; version is our own integer
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return version, err
+		}
+		if err := tx.Commit(); err != nil {
+			return version, err
+		}
+	}
+	return version, nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+// fromMillis returns the time in UTC, as the Mongo driver decodes dates.
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
+
+// newID fills in an id the way the Mongo driver does for an insert without
+// one.
+func newID(id primitive.ObjectID) primitive.ObjectID {
+	if id.IsZero() {
+		return primitive.NewObjectID()
+	}
+	return id
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func fromJSON(data string, v interface{}) error {
+	return json.Unmarshal([]byte(data), v)
+}
+
+// notFound turns an empty single-row result into the error the Mongo
+// repositories return.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return mongo.ErrNoDocuments
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err broke a UNIQUE or PRIMARY KEY
+// constraint. The driver's error type only exists in cgo builds, so the
+// message is matched instead.
+func isUniqueViolation(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "UNIQUE constraint failed") ||
+		strings.Contains(err.Error(), "PRIMARY KEY constraint failed"))
+}
+
+func rowsAffected(result sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,168 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"github.com/nesohq/backend/internal/repository/sqlite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// newDB opens a migrated in-memory database private to the test. The cache
+// is shared so every pooled connection sees the same database.
+func newDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file:"+url.PathEscape(t.Name())+"?mode=memory&cache=shared&_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := sqlite.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	db := newDB(t)
+
+	version, err := sqlite.Migrate(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Migrate again: %v", err)
+	}
+	current, latest, err := sqlite.SchemaVersion(context.Background(), db)
+	if err != nil || current != latest || version != latest {
+		t.Errorf("schema version = %d (migrated to %d), latest %d, %v", current, version, latest, err)
+	}
+}
+
+func TestUsersHaveUniqueEmails(t *testing.T) {
+	users := sqlite.NewUserRepository(newDB(t))
+	ctx := context.Background()
+
+	user := &domain.User{Email: "owner@example.com", PasswordHash: "hash", Plan: domain.PlanFree}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if user.ID.IsZero() {
+		t.Error("Create did not fill in the id")
+	}
+	if err := users.Create(ctx, &domain.User{Email: "owner@example.com"}); !errors.Is(err, repository.ErrEmailTaken) {
+		t.Errorf("second Create with the same email: error = %v, want ErrEmailTaken", err)
+	}
+
+	user.Plan = domain.PlanPro
+	if err := users.Update(ctx, user); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	found, err := users.FindByEmail(ctx, "owner@example.com")
+	if err != nil || found.ID != user.ID || found.Plan != domain.PlanPro {
+		t.Errorf("FindByEmail = %+v, %v, want the updated user", found, err)
+	}
+	if _, err := users.FindByID(ctx, primitive.NewObjectID()); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindByID of a missing user: error = %v, want mongo.ErrNoDocuments", err)
+	}
+}
+
+func TestDomainsRoundTripSettings(t *testing.T) {
+	domains := sqlite.NewDomainRepository(newDB(t))
+	ctx := context.Background()
+	owner := primitive.NewObjectID()
+
+	d := &domain.Domain{UserID: owner, Domain: "example.com", Settings: domain.DomainSettings{
+		RateLimit:           1000,
+		Cookieless:          true,
+		PrivacySignalPolicy: domain.PrivacyPolicyDrop,
+		RetentionDays:       30,
+	}}
+	if err := domains.Create(ctx, d); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := domains.Create(ctx, &domain.Domain{UserID: primitive.NewObjectID(), Domain: "other.example"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	found, err := domains.FindByID(ctx, d.ID)
+	if err != nil || found.Settings != d.Settings || found.UserID != owner {
+		t.Errorf("FindByID = %+v, %v, want %+v", found, err, d)
+	}
+	owned, err := domains.FindByUserID(ctx, owner)
+	if err != nil || len(owned) != 1 || owned[0].ID != d.ID {
+		t.Errorf("FindByUserID = %+v, %v, want the owner's domain", owned, err)
+	}
+	if none, err := domains.FindByUserID(ctx, primitive.NewObjectID()); err != nil || none != nil {
+		t.Errorf("FindByUserID of a user without domains = %v, %v, want nil as from Mongo", none, err)
+	}
+	if all, err := domains.FindAll(ctx); err != nil || len(all) != 2 {
+		t.Errorf("FindAll = %d domains, %v, want 2", len(all), err)
+	}
+
+	d.Settings.Cookieless = false
+	if err := domains.Update(ctx, d); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if found, err := domains.FindByID(ctx, d.ID); err != nil || found.Settings.Cookieless {
+		t.Errorf("FindByID after Update = %+v, %v, want cookieless off", found, err)
+	}
+
+	if err := domains.Delete(ctx, d.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := domains.FindByID(ctx, d.ID); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindByID after Delete: error = %v, want mongo.ErrNoDocuments", err)
+	}
+}
+
+func TestAPIKeysStopMatchingOnceRevoked(t *testing.T) {
+	keys := sqlite.NewAPIKeyRepository(newDB(t))
+	ctx := context.Background()
+	owner, domainID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	key := &domain.APIKey{UserID: owner, Key: "key-1", DomainIDs: []primitive.ObjectID{domainID}}
+	if err := keys.Create(ctx, key); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	found, err := keys.FindByKey(ctx, "key-1")
+	if err != nil || found.ID != key.ID || len(found.DomainIDs) != 1 || found.DomainIDs[0] != domainID {
+		t.Errorf("FindByKey = %+v, %v, want %+v", found, err, key)
+	}
+
+	if err := keys.Revoke(ctx, key.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := keys.FindByKey(ctx, "key-1"); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindByKey of a revoked key: error = %v, want mongo.ErrNoDocuments", err)
+	}
+	listed, err := keys.FindByUserID(ctx, owner)
+	if err != nil || len(listed) != 1 || !listed[0].Revoked {
+		t.Errorf("FindByUserID = %+v, %v, want the revoked key", listed, err)
+	}
+}
+
+func TestPrivacyRequestsAreListedPerDomain(t *testing.T) {
+	requests := sqlite.NewPrivacyRequestRepository(newDB(t))
+	ctx := context.Background()
+	domainID := primitive.NewObjectID()
+
+	for _, req := range []*domain.PrivacyRequest{
+		{DomainID: domainID, VisitorID: "v1", Type: domain.PrivacyRequestErase, EventsAffected: 3},
+		{DomainID: primitive.NewObjectID(), VisitorID: "v2", Type: domain.PrivacyRequestErase},
+	} {
+		if err := requests.Create(ctx, req); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	listed, err := requests.FindByDomainID(ctx, domainID)
+	if err != nil || len(listed) != 1 || listed[0].VisitorID != "v1" || listed[0].EventsAffected != 3 {
+		t.Errorf("FindByDomainID = %+v, %v, want v1's request", listed, err)
+	}
+}
@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const userColumns = "id, email, password_hash, plan, api_keys, created_at, updated_at"
+
+type UserRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+var _ repository.UserStore = (*UserRepository)(nil)
+
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	id := newID(user.ID)
+
+	apiKeys, err := toJSON(user.APIKeys)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		id.Hex(), user.Email, user.PasswordHash, user.Plan, apiKeys, millis(user.CreatedAt), millis(user.UpdatedAt),
+	)
+	if isUniqueViolation(err) {
+		return repository.ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	return nil
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email)
+	return scanUser(row)
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id.Hex())
+	return scanUser(row)
+}
+
+func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
+	user.UpdatedAt = time.Now()
+
+	apiKeys, err := toJSON(user.APIKeys)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`UPDATE users SET email = ?, password_hash = ?, plan = ?, api_keys = ?, created_at = ?, updated_at = ?
+		WHERE id = ?`,
+		user.Email, user.PasswordHash, user.Plan, apiKeys, millis(user.CreatedAt), millis(user.UpdatedAt), user.ID.Hex(),
+	)
+	return err
+}
+
+func scanUser(row rowScanner) (*domain.User, error) {
+	var (
+		user                 domain.User
+		id, apiKeys          string
+		createdAt, updatedAt int64
+	)
+	if err := row.Scan(&id, &user.Email, &user.PasswordHash, &user.Plan, &apiKeys, &createdAt, &updatedAt); err != nil {
+		return nil, notFound(err)
+	}
+
+	var err error
+	if user.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if err := fromJSON(apiKeys, &user.APIKeys); err != nil {
+		return nil, err
+	}
+	user.CreatedAt = fromMillis(createdAt)
+	user.UpdatedAt = fromMillis(updatedAt)
+	return &user, nil
+}
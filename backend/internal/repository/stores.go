@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The Store interfaces are what services depend on. The Mongo repositories in
+// this package implement them for production, package sqlite for lite mode
+// and package memory for tests. Lookups of a single missing document return
+// mongo.ErrNoDocuments in all of them.
+
+type UserStore interface {
+	Create(ctx context.Context, user *domain.User) error
+	FindByEmail(ctx context.Context, email string) (*domain.User, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error)
+	Update(ctx context.Context, user *domain.User) error
+}
+
+type DomainStore interface {
+	Create(ctx context.Context, d *domain.Domain) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*domain.Domain, error)
+	FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]*domain.Domain, error)
+	FindAll(ctx context.Context) ([]*domain.Domain, error)
+	Update(ctx context.Context, d *domain.Domain) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type APIKeyStore interface {
+	Create(ctx context.Context, apiKey *domain.APIKey) error
+	FindByKey(ctx context.Context, key string) (*domain.APIKey, error)
+	FindByUserID(ctx context.Context, userID primitive.ObjectID) ([]*domain.APIKey, error)
+	Revoke(ctx context.Context, id primitive.ObjectID) error
+}
+
+type EventStore interface {
+	Create(ctx context.Context, event *domain.Event) error
+	CreateMany(ctx context.Context, events []*domain.Event) (map[int]error, error)
+	FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.Event, error)
+	DeleteByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error)
+	CountTotal(ctx context.Context, domainID primitive.ObjectID) (int64, error)
+	AggregateDay(ctx context.Context, domainID primitive.ObjectID, start, end time.Time) (*domain.DailyRollup, error)
+	OldestTimestamp(ctx context.Context, domainID primitive.ObjectID) (time.Time, bool, error)
+	DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error)
+	StreamRange(ctx context.Context, domainID primitive.ObjectID, from, to time.Time, fn func(*domain.Event) error) error
+	StreamBreakdown(ctx context.Context, domainID primitive.ObjectID, field string, from, to time.Time, fn func(*domain.BreakdownRow) error) error
+}
+
+type ErrorStore interface {
+	Create(ctx context.Context, event *domain.ErrorEvent) error
+	FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.ErrorEvent, error)
+	DeleteByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error)
+	ListIssues(ctx context.Context, domainID primitive.ObjectID, since time.Time, limit int64) ([]*domain.ErrorIssue, error)
+	DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error)
+}
+
+type PurchaseStore interface {
+	Create(ctx context.Context, purchase *domain.Purchase) error
+	FindByVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) ([]*domain.Purchase, error)
+	DetachVisitor(ctx context.Context, domainID primitive.ObjectID, visitorID string) (int64, error)
+	GetRevenueStats(ctx context.Context, domainID primitive.ObjectID, currency string, since time.Time) (*domain.RevenueStats, error)
+}
+
+type RollupStore interface {
+	Upsert(ctx context.Context, rollup *domain.DailyRollup) error
+	UpsertImported(ctx context.Context, rollup *domain.DailyRollup, fields []string) error
+	Exists(ctx context.Context, domainID primitive.ObjectID, date time.Time) (bool, error)
+	// BuiltDates lists the dates in [from, to) that have a rollup built from
+	// tracked events, in order.
+	BuiltDates(ctx context.Context, domainID primitive.ObjectID, from, to time.Time) ([]time.Time, error)
+	FindRange(ctx context.Context, domainID primitive.ObjectID, from, to time.Time) ([]*domain.DailyRollup, error)
+	// SumPageviews totals pageviews per day, counting imported rollups only
+	// for days without one built from tracked events.
+	SumPageviews(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error)
+	// DeleteBefore removes rollups built from tracked events; imported
+	// rollups are the only record of their days and are kept.
+	DeleteBefore(ctx context.Context, domainID primitive.ObjectID, before time.Time) (int64, error)
+}
+
+type PrivacyRequestStore interface {
+	Create(ctx context.Context, req *domain.PrivacyRequest) error
+	FindByDomainID(ctx context.Context, domainID primitive.ObjectID) ([]*domain.PrivacyRequest, error)
+}
+
+var (
+	_ UserStore           = (*UserRepository)(nil)
+	_ DomainStore         = (*DomainRepository)(nil)
+	_ APIKeyStore         = (*APIKeyRepository)(nil)
+	_ EventStore          = (*EventRepository)(nil)
+	_ ErrorStore          = (*ErrorRepository)(nil)
+	_ PurchaseStore       = (*PurchaseRepository)(nil)
+	_ RollupStore         = (*RollupRepository)(nil)
+	_ PrivacyRequestStore = (*PrivacyRequestRepository)(nil)
+)
+
+type AlertRuleStore interface {
+	Create(ctx context.Context, rule *domain.AlertRule) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*domain.AlertRule, error)
+	FindByDomainID(ctx context.Context, domainID primitive.ObjectID) ([]*domain.AlertRule, error)
+	FindEnabled(ctx context.Context) ([]*domain.AlertRule, error)
+	Update(ctx context.Context, rule *domain.AlertRule) error
+	// UpdateState saves only the fields the scheduler owns, so it cannot
+	// undo a concurrent edit of the rule.
+	UpdateState(ctx context.Context, id primitive.ObjectID, firing bool, value float64, checkedAt time.Time) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type AlertDeliveryStore interface {
+	Create(ctx context.Context, delivery *domain.AlertDelivery) error
+	FindByRuleID(ctx context.Context, ruleID primitive.ObjectID, limit int64) ([]*domain.AlertDelivery, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
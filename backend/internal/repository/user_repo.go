@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/nesohq/backend/internal/domain"
@@ -10,6 +11,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// ErrEmailTaken is returned by Create when another user already has the
+// email address.
+var ErrEmailTaken = errors.New("email already registered")
+
 type UserRepository struct {
 	collection *mongo.Collection
 }
@@ -24,6 +29,9 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 	result, err := r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailTaken
+	}
 	if err != nil {
 		return err
 	}
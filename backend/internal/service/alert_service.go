@@ -0,0 +1,597 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/metrics"
+	"github.com/nesohq/backend/internal/repository"
+	"github.com/nesohq/backend/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrAlertRuleNotFound is returned when an alert rule does not exist or
+// belongs to another user.
+var ErrAlertRuleNotFound = errors.New("alert rule not found")
+
+// ErrInvalidAlertRule is returned when a rule's settings do not fit its type.
+var ErrInvalidAlertRule = errors.New("invalid alert rule")
+
+// errWebhookAddressBlocked is returned when a webhook host resolves to an
+// address on the server's own networks.
+var errWebhookAddressBlocked = errors.New("webhook address is not publicly routable")
+
+const (
+	// alertDeliveryLimit caps how much of a rule's delivery log is listed
+	alertDeliveryLimit = 50
+	// alertDeliveryRetention is how long the delivery log is kept
+	alertDeliveryRetention = 30 * 24 * time.Hour
+	// alertBaselineDays is how many previous days a pageview drop is
+	// measured against, at the same time of day
+	alertBaselineDays = 7
+	// alertMinBaseline is the fewest pageviews an hour must usually see for
+	// a drop in it to be reported; quieter hours vary too much
+	alertMinBaseline = 20
+	// alertMaxMinutes is the longest window the per-minute counters cover
+	alertMaxMinutes = realtimeMinutes
+
+	webhookTimeout = 10 * time.Second
+)
+
+// webhookBackoff is how long to wait before each retry of a failed delivery.
+var webhookBackoff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// AlertService manages alert rules and evaluates them against the per-minute
+// counters Track keeps in Redis and, for pageview drops, its hourly counters.
+type AlertService struct {
+	ruleRepo     repository.AlertRuleStore
+	deliveryRepo repository.AlertDeliveryStore
+	domainRepo   repository.DomainStore
+	stats        *StatsService
+	cache        cache.Cache
+	client       *http.Client
+	logger       *slog.Logger
+
+	// allowPrivateWebhooks lets webhooks reach loopback, private and
+	// link-local addresses, for receivers on the same network
+	allowPrivateWebhooks bool
+}
+
+func NewAlertService(
+	ruleRepo repository.AlertRuleStore,
+	deliveryRepo repository.AlertDeliveryStore,
+	domainRepo repository.DomainStore,
+	stats *StatsService,
+	cache cache.Cache,
+	logger *slog.Logger,
+	allowPrivateWebhooks bool,
+) *AlertService {
+	return &AlertService{
+		ruleRepo:             ruleRepo,
+		deliveryRepo:         deliveryRepo,
+		domainRepo:           domainRepo,
+		stats:                stats,
+		cache:                cache,
+		client:               newWebhookClient(allowPrivateWebhooks),
+		logger:               logger,
+		allowPrivateWebhooks: allowPrivateWebhooks,
+	}
+}
+
+// newWebhookClient returns the client webhooks are posted with. Unless
+// allowPrivate is set, it refuses to connect to addresses that are not
+// publicly routable. The check runs on the address actually dialled, after
+// DNS resolution, so a host that resolves to a public address when the rule
+// is saved and to an internal one later is still refused. Redirects are
+// never followed, and proxies from the environment are not used, as either
+// would connect somewhere the check did not see.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addr.Addr()) {
+				return errWebhookAddressBlocked
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// cgnatPrefix is the carrier-grade NAT range, which netip does not count as
+// private but is not reachable from the internet either.
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether addr may be the target of a webhook.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!cgnatPrefix.Contains(addr) &&
+		!(addr.Is4() && addr.As4()[0] == 0)
+}
+
+func (s *AlertService) List(ctx context.Context, userID, domainID primitive.ObjectID) ([]*domain.AlertRule, error) {
+	if err := ensureDomainOwner(ctx, s.domainRepo, userID, domainID); err != nil {
+		return nil, err
+	}
+	return s.ruleRepo.FindByDomainID(ctx, domainID)
+}
+
+// Create adds a rule with a fresh signing secret. Rules are enabled unless
+// the request says otherwise.
+func (s *AlertService) Create(ctx context.Context, userID primitive.ObjectID, req *domain.CreateAlertRuleRequest) (*domain.AlertRule, error) {
+	domainID, _ := primitive.ObjectIDFromHex(req.DomainID)
+	if err := ensureDomainOwner(ctx, s.domainRepo, userID, domainID); err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &domain.AlertRule{
+		DomainID: domainID,
+		UserID:   userID,
+		Secret:   secret,
+		Enabled:  true,
+	}
+	if err := applyAlertRule(rule, &req.UpdateAlertRuleRequest, s.allowPrivateWebhooks); err != nil {
+		return nil, err
+	}
+
+	if err := s.ruleRepo.Create(ctx, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// Update replaces a rule's settings. A rule whose condition changed, or that
+// was disabled, starts over as not firing.
+func (s *AlertService) Update(ctx context.Context, userID, id primitive.ObjectID, req *domain.UpdateAlertRuleRequest) (*domain.AlertRule, error) {
+	rule, err := s.getOwned(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *rule
+	if err := applyAlertRule(rule, req, s.allowPrivateWebhooks); err != nil {
+		return nil, err
+	}
+	if rule.Type != before.Type || rule.Threshold != before.Threshold || rule.Minutes != before.Minutes || !rule.Enabled {
+		rule.Firing = false
+	}
+
+	if err := s.ruleRepo.Update(ctx, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *AlertService) Delete(ctx context.Context, userID, id primitive.ObjectID) error {
+	if _, err := s.getOwned(ctx, userID, id); err != nil {
+		return err
+	}
+	return s.ruleRepo.Delete(ctx, id)
+}
+
+// ListDeliveries returns the rule's latest notifications, newest first.
+func (s *AlertService) ListDeliveries(ctx context.Context, userID, id primitive.ObjectID) ([]*domain.AlertDelivery, error) {
+	if _, err := s.getOwned(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	return s.deliveryRepo.FindByRuleID(ctx, id, alertDeliveryLimit)
+}
+
+func (s *AlertService) getOwned(ctx context.Context, userID, id primitive.ObjectID) (*domain.AlertRule, error) {
+	rule, err := s.ruleRepo.FindByID(ctx, id)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && rule.UserID != userID) {
+		return nil, ErrAlertRuleNotFound
+	}
+	return rule, err
+}
+
+// applyAlertRule validates req and copies it onto rule. Settings the rule's
+// type does not use are cleared. Webhook hosts that are internal addresses
+// are refused here unless allowPrivate is set; hostnames are only checked
+// when the webhook is posted, as what they resolve to can change.
+func applyAlertRule(rule *domain.AlertRule, req *domain.UpdateAlertRuleRequest, allowPrivate bool) error {
+	u, err := url.Parse(req.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: webhook_url must be an http or https URL", ErrInvalidAlertRule)
+	}
+	if !allowPrivate {
+		if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !publicAddr(addr) {
+			return fmt.Errorf("%w: webhook_url must not point at an internal address", ErrInvalidAlertRule)
+		}
+	}
+
+	threshold, minutes := req.Threshold, req.Minutes
+	switch req.Type {
+	case domain.AlertActiveVisitorsAbove:
+		minutes = 0
+	case domain.AlertPageviewsDrop:
+		if threshold <= 0 || threshold > 100 {
+			return fmt.Errorf("%w: threshold must be a percentage between 0 and 100", ErrInvalidAlertRule)
+		}
+		minutes = 0
+	case domain.AlertNoEvents, domain.AlertErrorsAbove:
+		if minutes < 1 || minutes > alertMaxMinutes {
+			return fmt.Errorf("%w: minutes must be between 1 and %d", ErrInvalidAlertRule, alertMaxMinutes)
+		}
+		if req.Type == domain.AlertNoEvents {
+			threshold = 0
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidAlertRule, req.Type)
+	}
+
+	rule.Type = req.Type
+	rule.Threshold = threshold
+	rule.Minutes = minutes
+	rule.WebhookURL = req.WebhookURL
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// Run evaluates the rules unless another worker already has this minute;
+// the counters only change once a minute, and running twice would notify
+// twice.
+func (s *AlertService) Run(ctx context.Context) error {
+	lockKey := fmt.Sprintf("alert_run:%s", time.Now().UTC().Format("200601021504"))
+	acquired, err := s.cache.SetNX(ctx, lockKey, 1, 2*time.Minute)
+	if err != nil || !acquired {
+		return err
+	}
+	return s.Evaluate(ctx)
+}
+
+// Evaluate checks every enabled rule and notifies the webhooks of rules that
+// started or stopped firing, then prunes the delivery log. A failure on one
+// rule does not stop the others. It returns once every notification has
+// been delivered or has run out of retries.
+func (s *AlertService) Evaluate(ctx context.Context) error {
+	rules, err := s.ruleRepo.FindEnabled(ctx)
+	if err != nil {
+		return err
+	}
+
+	var notifications sync.WaitGroup
+	defer notifications.Wait()
+
+	now := time.Now()
+	for _, rule := range rules {
+		if err := s.check(ctx, rule, now, &notifications); err != nil {
+			s.logger.ErrorContext(ctx, "alert check failed", "rule_id", rule.ID.Hex(), "domain_id", rule.DomainID.Hex(), "error", err)
+		}
+	}
+
+	_, err = s.deliveryRepo.DeleteBefore(ctx, now.Add(-alertDeliveryRetention))
+	return err
+}
+
+// check measures the rule and, if it started or stopped firing, sends the
+// notification in the background. The change is only saved once the webhook
+// has it, so a notification that failed is sent again on the next run.
+func (s *AlertService) check(ctx context.Context, rule *domain.AlertRule, now time.Time, notifications *sync.WaitGroup) error {
+	d, err := s.domainRepo.FindByID(ctx, rule.DomainID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// The domain was deleted; its rules stay quiet
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	value, baseline, firing, err := s.measure(ctx, rule, now)
+	if err != nil {
+		return err
+	}
+	if firing == rule.Firing {
+		return s.ruleRepo.UpdateState(ctx, rule.ID, firing, value, now)
+	}
+
+	event := domain.AlertResolved
+	if firing {
+		event = domain.AlertTriggered
+	}
+	notifications.Add(1)
+	go func() {
+		defer notifications.Done()
+		state := rule.Firing
+		if s.notify(ctx, rule, d, event, value, baseline, now) {
+			state = firing
+		}
+		if err := s.ruleRepo.UpdateState(ctx, rule.ID, state, value, now); err != nil {
+			s.logger.ErrorContext(ctx, "failed to save alert state", "rule_id", rule.ID.Hex(), "error", err)
+		}
+	}()
+	return nil
+}
+
+// measure returns the rule's current value, the baseline it is compared
+// against for pageview drops, and whether the rule's condition holds.
+func (s *AlertService) measure(ctx context.Context, rule *domain.AlertRule, now time.Time) (value, baseline float64, firing bool, err error) {
+	current := now.Truncate(time.Minute)
+
+	switch rule.Type {
+	case domain.AlertActiveVisitorsAbove:
+		count, err := s.stats.GetActiveVisitorCount(ctx, rule.DomainID)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		return float64(count), 0, float64(count) > rule.Threshold, nil
+
+	case domain.AlertPageviewsDrop:
+		// The last 60 whole minutes
+		hits, err := s.sumCounters(ctx, realtimeHitsKey, rule.DomainID, current.Add(-time.Minute), realtimeMinutes)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		baseline, err := s.hourlyBaseline(ctx, rule.DomainID, current.Add(-realtimeMinutes*time.Minute))
+		if err != nil || baseline < alertMinBaseline {
+			// Too little traffic at this time of day to tell a drop from
+			// the usual variation
+			return float64(hits), baseline, false, err
+		}
+		return float64(hits), baseline, float64(hits) <= baseline*(1-rule.Threshold/100), nil
+
+	case domain.AlertNoEvents:
+		// The current minute and the rule's whole minutes before it, so
+		// silence is reported after at least Minutes minutes
+		hits, err := s.sumCounters(ctx, realtimeHitsKey, rule.DomainID, current, rule.Minutes+1)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		return float64(hits), 0, hits == 0, nil
+
+	case domain.AlertErrorsAbove:
+		errorEvents, err := s.sumCounters(ctx, realtimeErrorsKey, rule.DomainID, current, rule.Minutes)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		return float64(errorEvents), 0, float64(errorEvents) > rule.Threshold, nil
+	}
+	return 0, 0, false, fmt.Errorf("unknown alert type %q", rule.Type)
+}
+
+// sumCounters adds up the per-minute counters named by key for the n minutes
+// ending with the one starting at last.
+func (s *AlertService) sumCounters(ctx context.Context, key func(primitive.ObjectID, time.Time) string, domainID primitive.ObjectID, last time.Time, n int) (int64, error) {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = key(domainID, last.Add(-time.Duration(i)*time.Minute))
+	}
+	counts, err := s.counters(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total, nil
+}
+
+// hourlyBaseline is the average number of pageviews in the hour starting at
+// start on each of the last alertBaselineDays days. The hourly counters the
+// hour straddles are weighted by how much of them it covers; days without
+// counters count as no pageviews.
+func (s *AlertService) hourlyBaseline(ctx context.Context, domainID primitive.ObjectID, start time.Time) (float64, error) {
+	hour := start.Truncate(time.Hour)
+	share := 1 - float64(start.Sub(hour))/float64(time.Hour)
+
+	keys := make([]string, 0, 2*alertBaselineDays)
+	for day := 1; day <= alertBaselineDays; day++ {
+		earlier := hour.Add(-time.Duration(day) * 24 * time.Hour)
+		keys = append(keys, hourlyHitsKey(domainID, earlier), hourlyHitsKey(domainID, earlier.Add(time.Hour)))
+	}
+	counts, err := s.counters(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	var pageviews float64
+	for i := 0; i < len(counts); i += 2 {
+		pageviews += share*float64(counts[i]) + (1-share)*float64(counts[i+1])
+	}
+	return pageviews / alertBaselineDays, nil
+}
+
+// counters reads the counters named by keys, with 0 for those not set.
+func (s *AlertService) counters(ctx context.Context, keys []string) ([]int64, error) {
+	values, err := s.cache.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int64, len(keys))
+	for i, value := range values {
+		if value, ok := value.(string); ok {
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid counter %s: %w", keys[i], err)
+			}
+			counts[i] = count
+		}
+	}
+	return counts, nil
+}
+
+// notify posts the notification to the rule's webhook, retrying with
+// webhookBackoff, and records the outcome in the delivery log. It reports
+// whether the webhook accepted it.
+func (s *AlertService) notify(ctx context.Context, rule *domain.AlertRule, d *domain.Domain, event string, value, baseline float64, now time.Time) bool {
+	delivery := &domain.AlertDelivery{
+		ID:       primitive.NewObjectID(),
+		RuleID:   rule.ID,
+		DomainID: rule.DomainID,
+		Event:    event,
+		URL:      rule.WebhookURL,
+	}
+
+	body, err := json.Marshal(domain.AlertNotification{
+		DeliveryID: delivery.ID,
+		Event:      event,
+		RuleID:     rule.ID,
+		RuleType:   rule.Type,
+		DomainID:   rule.DomainID,
+		Domain:     d.Domain,
+		Threshold:  rule.Threshold,
+		Minutes:    rule.Minutes,
+		Value:      value,
+		Baseline:   baseline,
+		Message:    alertMessage(rule, d.Domain, event, value, baseline),
+		Timestamp:  now,
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to encode alert notification", "rule_id", rule.ID.Hex(), "error", err)
+		return false
+	}
+	delivery.Payload = string(body)
+
+	for attempt := 1; ; attempt++ {
+		delivery.Attempts = attempt
+		status, err := s.post(ctx, rule, delivery, body)
+		delivery.StatusCode = status
+		if err == nil {
+			delivery.Delivered = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+
+		// Client errors other than rate limiting, and refused addresses, will
+		// not go away by retrying
+		retryable := (status == 0 && !errors.Is(err, errWebhookAddressBlocked)) ||
+			status == http.StatusTooManyRequests || status >= 500
+		if !retryable || attempt > len(webhookBackoff) {
+			break
+		}
+		select {
+		case <-time.After(webhookBackoff[attempt-1]):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	outcome := "delivered"
+	if !delivery.Delivered {
+		outcome = "failed"
+		s.logger.WarnContext(ctx, "alert webhook failed",
+			"rule_id", rule.ID.Hex(), "event", event, "attempts", delivery.Attempts, "error", delivery.Error)
+	}
+	metrics.WebhookDeliveries.WithLabelValues(event, outcome).Inc()
+
+	if err := s.deliveryRepo.Create(ctx, delivery); err != nil {
+		s.logger.ErrorContext(ctx, "failed to save alert delivery", "rule_id", rule.ID.Hex(), "error", err)
+	}
+	return delivery.Delivered
+}
+
+// post sends one delivery attempt. It returns the response status, or 0 if
+// there was no response.
+func (s *AlertService) post(ctx context.Context, rule *domain.AlertRule, delivery *domain.AlertDelivery, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Krakens-Event", delivery.Event)
+	req.Header.Set("X-Krakens-Delivery", delivery.ID.Hex())
+	req.Header.Set("X-Krakens-Signature", utils.SignWebhook(rule.Secret, time.Now(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func alertMessage(rule *domain.AlertRule, host, event string, value, baseline float64) string {
+	triggered := event == domain.AlertTriggered
+
+	switch rule.Type {
+	case domain.AlertActiveVisitorsAbove:
+		if triggered {
+			return fmt.Sprintf("%s: %g active visitors, above the threshold of %g", host, value, rule.Threshold)
+		}
+		return fmt.Sprintf("%s: active visitors back to %g, at or below %g", host, value, rule.Threshold)
+	case domain.AlertPageviewsDrop:
+		if triggered {
+			return fmt.Sprintf("%s: %g pageviews in the last hour, %.0f%% below the usual %.0f for this time of day",
+				host, value, 100*(1-value/baseline), baseline)
+		}
+		return fmt.Sprintf("%s: pageviews recovered to %g in the last hour", host, value)
+	case domain.AlertNoEvents:
+		if triggered {
+			return fmt.Sprintf("%s: no events in the last %s", host, pluralMinutes(rule.Minutes))
+		}
+		return fmt.Sprintf("%s: events are arriving again", host)
+	case domain.AlertErrorsAbove:
+		if triggered {
+			return fmt.Sprintf("%s: %g error events in the last %s, above the threshold of %g",
+				host, value, pluralMinutes(rule.Minutes), rule.Threshold)
+		}
+		return fmt.Sprintf("%s: error events back to %g in the last %s", host, value, pluralMinutes(rule.Minutes))
+	}
+	return fmt.Sprintf("%s: alert %s", host, event)
+}
+
+func pluralMinutes(n int) string {
+	if n == 1 {
+		return "minute"
+	}
+	return fmt.Sprintf("%d minutes", n)
+}
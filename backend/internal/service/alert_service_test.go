@@ -0,0 +1,478 @@
+package service_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type alertFixture struct {
+	*trackingFixture
+	alerts     *service.AlertService
+	stats      *service.StatsService
+	rollups    *memory.RollupRepository
+	deliveries *memory.AlertDeliveryRepository
+	domainID   primitive.ObjectID
+	userID     primitive.ObjectID
+	webhook    *webhookRecorder
+}
+
+func newAlertFixture(t *testing.T) *alertFixture {
+	t.Helper()
+	f := &alertFixture{
+		trackingFixture: newTrackingFixture(t),
+		rollups:         memory.NewRollupRepository(),
+		deliveries:      memory.NewAlertDeliveryRepository(),
+		webhook:         &webhookRecorder{},
+	}
+	f.domainID = f.addDomain(t, domain.DomainSettings{})
+	f.userID = f.owner(t, f.domainID)
+
+	f.stats = service.NewStatsService(memory.NewEventRepository(), f.rollups, f.domains,
+		service.NewUniqueVisitorService(f.cache, f.rollups), f.cache, discardLogger(), 5*time.Minute)
+	// The test webhook listens on loopback
+	f.alerts = f.newAlertService(true)
+
+	server := httptest.NewServer(f.webhook)
+	t.Cleanup(server.Close)
+	f.webhook.url = server.URL
+	return f
+}
+
+func (f *alertFixture) newAlertService(allowPrivateWebhooks bool) *service.AlertService {
+	return service.NewAlertService(memory.NewAlertRuleRepository(), f.deliveries, f.domains,
+		f.stats, f.cache, discardLogger(), allowPrivateWebhooks)
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func (f *alertFixture) createRule(t *testing.T, req domain.UpdateAlertRuleRequest) *domain.AlertRule {
+	t.Helper()
+	if req.WebhookURL == "" {
+		req.WebhookURL = f.webhook.url
+	}
+	rule, err := f.alerts.Create(context.Background(), f.userID, &domain.CreateAlertRuleRequest{
+		DomainID:               f.domainID.Hex(),
+		UpdateAlertRuleRequest: req,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return rule
+}
+
+func (f *alertFixture) evaluate(t *testing.T) {
+	t.Helper()
+	if err := f.alerts.Evaluate(context.Background()); err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+}
+
+// webhookRecorder answers with the queued statuses, then 200, and keeps
+// every request it received.
+type webhookRecorder struct {
+	url string
+
+	mu       sync.Mutex
+	statuses []int
+	requests []recordedWebhook
+}
+
+type recordedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func (w *webhookRecorder) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.requests = append(w.requests, recordedWebhook{header: r.Header.Clone(), body: body})
+	status := http.StatusOK
+	if len(w.statuses) > 0 {
+		status, w.statuses = w.statuses[0], w.statuses[1:]
+	}
+	rw.WriteHeader(status)
+}
+
+func (w *webhookRecorder) received() []recordedWebhook {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]recordedWebhook(nil), w.requests...)
+}
+
+func (w *webhookRecorder) respondWith(statuses ...int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.statuses = statuses
+}
+
+func notification(t *testing.T, req recordedWebhook) domain.AlertNotification {
+	t.Helper()
+	var n domain.AlertNotification
+	if err := json.Unmarshal(req.body, &n); err != nil {
+		t.Fatalf("decoding notification: %v", err)
+	}
+	return n
+}
+
+func TestAlertRuleValidation(t *testing.T) {
+	f := newAlertFixture(t)
+	ctx := context.Background()
+
+	invalid := []domain.UpdateAlertRuleRequest{
+		{Type: domain.AlertNoEvents, Minutes: 0, WebhookURL: f.webhook.url},
+		{Type: domain.AlertErrorsAbove, Minutes: 61, WebhookURL: f.webhook.url},
+		{Type: domain.AlertPageviewsDrop, Threshold: 150, WebhookURL: f.webhook.url},
+		{Type: domain.AlertActiveVisitorsAbove, Threshold: 10, WebhookURL: "ftp://hooks.example.com/"},
+		{Type: "sometimes", WebhookURL: f.webhook.url},
+	}
+	for _, req := range invalid {
+		_, err := f.alerts.Create(ctx, f.userID, &domain.CreateAlertRuleRequest{DomainID: f.domainID.Hex(), UpdateAlertRuleRequest: req})
+		if !errors.Is(err, service.ErrInvalidAlertRule) {
+			t.Errorf("Create(%+v) error = %v, want ErrInvalidAlertRule", req, err)
+		}
+	}
+
+	req := &domain.CreateAlertRuleRequest{
+		DomainID:               f.domainID.Hex(),
+		UpdateAlertRuleRequest: domain.UpdateAlertRuleRequest{Type: domain.AlertNoEvents, Minutes: 30, WebhookURL: f.webhook.url},
+	}
+	if _, err := f.alerts.Create(ctx, primitive.NewObjectID(), req); !errors.Is(err, service.ErrDomainNotFound) {
+		t.Errorf("Create for another user's domain error = %v, want ErrDomainNotFound", err)
+	}
+
+	rule, err := f.alerts.Create(ctx, f.userID, req)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !rule.Enabled || !strings.HasPrefix(rule.Secret, "whsec_") {
+		t.Errorf("rule = %+v, want enabled with a signing secret", rule)
+	}
+	if _, err := f.alerts.ListDeliveries(ctx, primitive.NewObjectID(), rule.ID); !errors.Is(err, service.ErrAlertRuleNotFound) {
+		t.Errorf("ListDeliveries by another user error = %v, want ErrAlertRuleNotFound", err)
+	}
+}
+
+func TestNoEventsAlertTriggersAndResolves(t *testing.T) {
+	f := newAlertFixture(t)
+	ctx := context.Background()
+	rule := f.createRule(t, domain.UpdateAlertRuleRequest{Type: domain.AlertNoEvents, Minutes: 10})
+
+	f.evaluate(t)
+	// Still silent: no second notification
+	f.evaluate(t)
+
+	received := f.webhook.received()
+	if len(received) != 1 {
+		t.Fatalf("got %d webhooks, want 1", len(received))
+	}
+	got := notification(t, received[0])
+	if got.Event != domain.AlertTriggered || got.RuleID != rule.ID || got.Domain != "example.com" {
+		t.Errorf("notification = %+v, want no_events triggered for example.com", got)
+	}
+	if received[0].header.Get("X-Krakens-Event") != domain.AlertTriggered ||
+		received[0].header.Get("X-Krakens-Delivery") != got.DeliveryID.Hex() {
+		t.Errorf("headers = %v", received[0].header)
+	}
+
+	// The signature covers the timestamp and the body
+	var ts, sig string
+	fmt.Sscanf(strings.ReplaceAll(received[0].header.Get("X-Krakens-Signature"), ",", " "), "t=%s v1=%s", &ts, &sig)
+	mac := hmac.New(sha256.New, []byte(rule.Secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(received[0].body)
+	if want := hex.EncodeToString(mac.Sum(nil)); sig != want {
+		t.Errorf("signature = %q, want %q", sig, want)
+	}
+
+	if err := f.service.Track(ctx, f.domainID, &domain.TrackRequest{Path: "/"}, testIP, testUserAgent); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	f.evaluate(t)
+
+	received = f.webhook.received()
+	if len(received) != 2 || notification(t, received[1]).Event != domain.AlertResolved {
+		t.Fatalf("got %d webhooks, want the second to resolve the alert", len(received))
+	}
+
+	deliveries, err := f.alerts.ListDeliveries(ctx, f.userID, rule.ID)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("got %d deliveries, want 2", len(deliveries))
+	}
+	for _, delivery := range deliveries {
+		if !delivery.Delivered || delivery.Attempts != 1 || delivery.StatusCode != http.StatusOK {
+			t.Errorf("delivery = %+v, want delivered at the first attempt", delivery)
+		}
+	}
+}
+
+func TestErrorsAboveAlert(t *testing.T) {
+	f := newAlertFixture(t)
+	ctx := context.Background()
+	f.createRule(t, domain.UpdateAlertRuleRequest{Type: domain.AlertErrorsAbove, Threshold: 2, Minutes: 5})
+
+	for i := 0; i < 2; i++ {
+		if err := f.service.TrackError(ctx, f.domainID, &domain.TrackErrorRequest{Message: "boom"}, testIP, testUserAgent); err != nil {
+			t.Fatalf("TrackError: %v", err)
+		}
+	}
+	f.evaluate(t)
+	if n := len(f.webhook.received()); n != 0 {
+		t.Fatalf("got %d webhooks at the threshold, want 0", n)
+	}
+
+	if err := f.service.TrackError(ctx, f.domainID, &domain.TrackErrorRequest{Message: "boom"}, testIP, testUserAgent); err != nil {
+		t.Fatalf("TrackError: %v", err)
+	}
+	f.evaluate(t)
+	received := f.webhook.received()
+	if len(received) != 1 {
+		t.Fatalf("got %d webhooks, want 1", len(received))
+	}
+	if got := notification(t, received[0]); got.Event != domain.AlertTriggered || got.Value != 3 {
+		t.Errorf("notification = %+v, want triggered with 3 errors", got)
+	}
+}
+
+func TestActiveVisitorsAlert(t *testing.T) {
+	f := newAlertFixture(t)
+	ctx := context.Background()
+	f.createRule(t, domain.UpdateAlertRuleRequest{Type: domain.AlertActiveVisitorsAbove, Threshold: 1})
+
+	for _, id := range []string{"v1", "v2"} {
+		if err := f.service.Track(ctx, f.domainID, &domain.TrackRequest{Path: "/", VisitorID: id}, testIP, testUserAgent); err != nil {
+			t.Fatalf("Track: %v", err)
+		}
+	}
+	f.evaluate(t)
+
+	received := f.webhook.received()
+	if len(received) != 1 {
+		t.Fatalf("got %d webhooks, want 1", len(received))
+	}
+	if got := notification(t, received[0]); got.Value != 2 {
+		t.Errorf("value = %g, want 2 active visitors", got.Value)
+	}
+}
+
+func TestPageviewsDropAlertNeedsBaseline(t *testing.T) {
+	f := newAlertFixture(t)
+	ctx := context.Background()
+	f.createRule(t, domain.UpdateAlertRuleRequest{Type: domain.AlertPageviewsDrop, Threshold: 50})
+
+	// Busy days do not make a quiet night look like a drop
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for days := 1; days <= 7; days++ {
+		rollup := &domain.DailyRollup{DomainID: f.domainID, Date: today.AddDate(0, 0, -days), Pageviews: 2400}
+		if err := f.rollups.Upsert(ctx, rollup); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+	}
+	f.evaluate(t)
+	if n := len(f.webhook.received()); n != 0 {
+		t.Fatalf("got %d webhooks without hourly counts, want 0", n)
+	}
+
+	// The hours around the last one on previous days, with room for the
+	// clock to move on while the test runs
+	setHourlyHits := func(days int, hits string) {
+		t.Helper()
+		hour := time.Now().UTC().Add(-time.Hour).Truncate(time.Hour)
+		for day := 1; day <= days; day++ {
+			for offset := -1; offset <= 1; offset++ {
+				at := hour.Add(time.Duration(offset)*time.Hour - time.Duration(day)*24*time.Hour)
+				key := fmt.Sprintf("hourly_hits:%s:%s", f.domainID.Hex(), at.Format("2006010215"))
+				if err := f.cache.Set(ctx, key, hits, time.Hour); err != nil {
+					t.Fatalf("Set: %v", err)
+				}
+			}
+		}
+	}
+
+	// 10 pageviews at this time of day is too few to call a drop
+	setHourlyHits(7, "10")
+	f.evaluate(t)
+	if n := len(f.webhook.received()); n != 0 {
+		t.Fatalf("got %d webhooks for a quiet hour, want 0", n)
+	}
+
+	// 52 on five of the seven days and 10 on the other two averages 40
+	setHourlyHits(5, "52")
+	f.evaluate(t)
+
+	received := f.webhook.received()
+	if len(received) != 1 {
+		t.Fatalf("got %d webhooks, want 1", len(received))
+	}
+	if got := notification(t, received[0]); math.Abs(got.Baseline-40) > 1e-9 || got.Value != 0 {
+		t.Errorf("notification = %+v, want 0 pageviews against a baseline of 40", got)
+	}
+}
+
+func TestAlertWebhookRetries(t *testing.T) {
+	f := newAlertFixture(t)
+	ctx := context.Background()
+
+	retried := f.createRule(t, domain.UpdateAlertRuleRequest{Type: domain.AlertNoEvents, Minutes: 10})
+	f.webhook.respondWith(http.StatusServiceUnavailable)
+	f.evaluate(t)
+
+	deliveries, err := f.alerts.ListDeliveries(ctx, f.userID, retried.ID)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 || !deliveries[0].Delivered || deliveries[0].Attempts != 2 {
+		t.Fatalf("deliveries = %+v, want one delivered at the second attempt", deliveries)
+	}
+
+	rejected := f.createRule(t, domain.UpdateAlertRuleRequest{Type: domain.AlertNoEvents, Minutes: 10})
+	f.webhook.respondWith(http.StatusGone)
+	f.evaluate(t)
+
+	deliveries, err = f.alerts.ListDeliveries(ctx, f.userID, rejected.ID)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Delivered || deliveries[0].Attempts != 1 ||
+		deliveries[0].StatusCode != http.StatusGone || deliveries[0].Error == "" {
+		t.Fatalf("deliveries = %+v, want one failed attempt without retries", deliveries)
+	}
+}
+
+func TestFailedAlertNotificationsAreSentAgain(t *testing.T) {
+	f := newAlertFixture(t)
+	ctx := context.Background()
+	rule := f.createRule(t, domain.UpdateAlertRuleRequest{Type: domain.AlertNoEvents, Minutes: 10})
+
+	firing := func() bool {
+		t.Helper()
+		rules, err := f.alerts.List(ctx, f.userID, f.domainID)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		return len(rules) == 1 && rules[0].Firing
+	}
+
+	f.webhook.respondWith(http.StatusGone)
+	f.evaluate(t)
+	if firing() {
+		t.Fatal("rule firing after its notification failed, want it left as it was")
+	}
+
+	f.evaluate(t)
+	if !firing() {
+		t.Fatal("rule not firing after its notification was delivered")
+	}
+	// Delivered: no third notification
+	f.evaluate(t)
+
+	received := f.webhook.received()
+	if len(received) != 2 {
+		t.Fatalf("got %d webhooks, want the failed one and its retry", len(received))
+	}
+	if n := notification(t, received[1]); n.Event != domain.AlertTriggered {
+		t.Errorf("retried notification = %+v, want triggered", n)
+	}
+	deliveries, err := f.alerts.ListDeliveries(ctx, f.userID, rule.ID)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Errorf("got %d deliveries, want 2", len(deliveries))
+	}
+}
+
+func TestAlertWebhooksRefuseInternalAddresses(t *testing.T) {
+	f := newAlertFixture(t)
+	ctx := context.Background()
+	alerts := f.newAlertService(false)
+
+	for _, webhookURL := range []string{
+		"http://127.0.0.1:8222/varz",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5:9000/",
+		"http://[::1]:6379/",
+		"http://[::ffff:192.168.1.1]/",
+	} {
+		_, err := alerts.Create(ctx, f.userID, &domain.CreateAlertRuleRequest{
+			DomainID:               f.domainID.Hex(),
+			UpdateAlertRuleRequest: domain.UpdateAlertRuleRequest{Type: domain.AlertNoEvents, Minutes: 10, WebhookURL: webhookURL},
+		})
+		if !errors.Is(err, service.ErrInvalidAlertRule) {
+			t.Errorf("Create with webhook %s error = %v, want ErrInvalidAlertRule", webhookURL, err)
+		}
+	}
+
+	// A hostname is only resolved when posting, so it is refused at dial time
+	webhookURL := strings.Replace(f.webhook.url, "127.0.0.1", "localhost", 1)
+	rule, err := alerts.Create(ctx, f.userID, &domain.CreateAlertRuleRequest{
+		DomainID:               f.domainID.Hex(),
+		UpdateAlertRuleRequest: domain.UpdateAlertRuleRequest{Type: domain.AlertNoEvents, Minutes: 10, WebhookURL: webhookURL},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := alerts.Evaluate(ctx); err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+
+	if n := len(f.webhook.received()); n != 0 {
+		t.Fatalf("got %d webhooks on loopback, want 0", n)
+	}
+	deliveries, err := alerts.ListDeliveries(ctx, f.userID, rule.ID)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	// Refused addresses are not retried
+	if len(deliveries) != 1 || deliveries[0].Delivered || deliveries[0].Attempts != 1 ||
+		!strings.Contains(deliveries[0].Error, "not publicly routable") {
+		t.Fatalf("deliveries = %+v, want one refused attempt", deliveries)
+	}
+}
+
+func TestAlertWebhooksDoNotFollowRedirects(t *testing.T) {
+	f := newAlertFixture(t)
+	ctx := context.Background()
+
+	redirect := httptest.NewServer(http.RedirectHandler(f.webhook.url, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+	rule := f.createRule(t, domain.UpdateAlertRuleRequest{Type: domain.AlertNoEvents, Minutes: 10, WebhookURL: redirect.URL})
+	f.evaluate(t)
+
+	if n := len(f.webhook.received()); n != 0 {
+		t.Fatalf("redirect was followed: got %d webhooks, want 0", n)
+	}
+	deliveries, err := f.alerts.ListDeliveries(ctx, f.userID, rule.ID)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Delivered || deliveries[0].Attempts != 1 ||
+		deliveries[0].StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("deliveries = %+v, want one failed attempt answered with the redirect", deliveries)
+	}
+}
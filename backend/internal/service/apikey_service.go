@@ -10,10 +10,10 @@ import (
 )
 
 type APIKeyService struct {
-	apiKeyRepo *repository.APIKeyRepository
+	apiKeyRepo repository.APIKeyStore
 }
 
-func NewAPIKeyService(apiKeyRepo *repository.APIKeyRepository) *APIKeyService {
+func NewAPIKeyService(apiKeyRepo repository.APIKeyStore) *APIKeyService {
 	return &APIKeyService{
 		apiKeyRepo: apiKeyRepo,
 	}
@@ -0,0 +1,70 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	keys := service.NewAPIKeyService(memory.NewAPIKeyRepository())
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	domainID := primitive.NewObjectID()
+
+	created, err := keys.Create(ctx, userID, &domain.CreateAPIKeyRequest{DomainIDs: []string{domainID.Hex()}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, "hrd_") || created.UserID != userID || created.Revoked {
+		t.Errorf("created = %+v", created)
+	}
+	if len(created.DomainIDs) != 1 || created.DomainIDs[0] != domainID {
+		t.Errorf("DomainIDs = %v, want [%s]", created.DomainIDs, domainID.Hex())
+	}
+
+	validated, err := keys.Validate(ctx, created.Key)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if validated.ID != created.ID {
+		t.Errorf("Validate returned key %s, want %s", validated.ID.Hex(), created.ID.Hex())
+	}
+	if _, err := keys.Validate(ctx, "hrd_unknown"); err == nil {
+		t.Error("Validate accepted an unknown key")
+	}
+
+	second, err := keys.Create(ctx, userID, &domain.CreateAPIKeyRequest{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if second.Key == created.Key {
+		t.Error("two keys share the same value")
+	}
+	if _, err := keys.Create(ctx, primitive.NewObjectID(), &domain.CreateAPIKeyRequest{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	list, err := keys.List(ctx, userID)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("List returned %d keys, want the user's 2", len(list))
+	}
+
+	if err := keys.Revoke(ctx, created.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := keys.Validate(ctx, created.Key); err == nil {
+		t.Error("Validate accepted a revoked key")
+	}
+	if _, err := keys.Validate(ctx, second.Key); err != nil {
+		t.Errorf("revoking one key broke another: %v", err)
+	}
+}
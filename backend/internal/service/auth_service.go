@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/nesohq/backend/internal/domain"
 	"github.com/nesohq/backend/internal/repository"
@@ -10,14 +11,18 @@ import (
 )
 
 type AuthService struct {
-	userRepo  *repository.UserRepository
-	jwtSecret string
+	userRepo        repository.UserStore
+	jwtSecret       string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
 }
 
-func NewAuthService(userRepo *repository.UserRepository, jwtSecret string) *AuthService {
+func NewAuthService(userRepo repository.UserStore, jwtSecret string, accessTokenTTL, refreshTokenTTL time.Duration) *AuthService {
 	return &AuthService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
+		userRepo:        userRepo,
+		jwtSecret:       jwtSecret,
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
 	}
 }
 
@@ -38,21 +43,25 @@ func (s *AuthService) Register(ctx context.Context, req *domain.RegisterRequest)
 	user := &domain.User{
 		Email:        req.Email,
 		PasswordHash: hash,
-		Plan:         "free",
+		Plan:         domain.PlanFree,
 		APIKeys:      []string{},
 	}
 
 	if err := s.userRepo.Create(ctx, user); err != nil {
+		// The unique email index catches sign-ups racing the check above
+		if errors.Is(err, repository.ErrEmailTaken) {
+			return nil, errors.New("user already exists")
+		}
 		return nil, err
 	}
 
 	// Generate tokens
-	token, err := utils.GenerateToken(user.ID, user.Email, s.jwtSecret)
+	token, err := utils.GenerateToken(user.ID, user.Email, s.jwtSecret, s.accessTokenTTL)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email, s.jwtSecret)
+	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email, s.jwtSecret, s.refreshTokenTTL)
 	if err != nil {
 		return nil, err
 	}
@@ -77,12 +86,12 @@ func (s *AuthService) Login(ctx context.Context, req *domain.LoginRequest) (*dom
 	}
 
 	// Generate tokens
-	token, err := utils.GenerateToken(user.ID, user.Email, s.jwtSecret)
+	token, err := utils.GenerateToken(user.ID, user.Email, s.jwtSecret, s.accessTokenTTL)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email, s.jwtSecret)
+	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email, s.jwtSecret, s.refreshTokenTTL)
 	if err != nil {
 		return nil, err
 	}
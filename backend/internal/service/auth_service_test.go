@@ -0,0 +1,101 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"github.com/nesohq/backend/internal/utils"
+)
+
+const testSecret = "test-secret-that-is-long-enough-for-hs256"
+
+func newAuthService() (*service.AuthService, *memory.UserRepository) {
+	users := memory.NewUserRepository()
+	return service.NewAuthService(users, testSecret, 15*time.Minute, 48*time.Hour), users
+}
+
+// checkToken validates token and checks it belongs to the user and expires
+// after roughly ttl.
+func checkToken(t *testing.T, token string, user *domain.User, ttl time.Duration) {
+	t.Helper()
+	claims, err := utils.ValidateToken(token, testSecret)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != user.ID.Hex() || claims.Email != user.Email {
+		t.Errorf("claims = %s/%s, want %s/%s", claims.UserID, claims.Email, user.ID.Hex(), user.Email)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != ttl {
+		t.Errorf("token lifetime = %v, want %v", lifetime, ttl)
+	}
+}
+
+func TestAuthRegisterAndLogin(t *testing.T) {
+	auth, users := newAuthService()
+	ctx := context.Background()
+
+	resp, err := auth.Register(ctx, &domain.RegisterRequest{Email: "ada@example.com", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if resp.User.ID.IsZero() || resp.User.Plan != domain.PlanFree {
+		t.Errorf("user = %+v, want a stored free user", resp.User)
+	}
+	checkToken(t, resp.Token, resp.User, 15*time.Minute)
+	checkToken(t, resp.RefreshToken, resp.User, 48*time.Hour)
+
+	stored, err := users.FindByEmail(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatalf("user was not stored: %v", err)
+	}
+	if stored.PasswordHash == "correct horse" || !utils.CheckPasswordHash("correct horse", stored.PasswordHash) {
+		t.Error("password is not stored as a hash of the password")
+	}
+
+	login, err := auth.Login(ctx, &domain.LoginRequest{Email: "ada@example.com", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if login.User.ID != resp.User.ID {
+		t.Errorf("logged in as %s, want %s", login.User.ID.Hex(), resp.User.ID.Hex())
+	}
+	checkToken(t, login.Token, login.User, 15*time.Minute)
+
+	if _, err := auth.Register(ctx, &domain.RegisterRequest{Email: "ada@example.com", Password: "another one"}); err == nil {
+		t.Error("registering the same email twice succeeded")
+	}
+}
+
+func TestAuthLoginRejectsBadCredentials(t *testing.T) {
+	auth, users := newAuthService()
+	ctx := context.Background()
+
+	hash, err := utils.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Create(ctx, &domain.User{Email: "ada@example.com", PasswordHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{name: "wrong password", email: "ada@example.com", password: "battery staple"},
+		{name: "unknown email", email: "bob@example.com", password: "correct horse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.Login(ctx, &domain.LoginRequest{Email: tt.email, Password: tt.password})
+			if err == nil || err.Error() != "invalid credentials" {
+				t.Errorf("Login error = %v, want invalid credentials", err)
+			}
+		})
+	}
+}
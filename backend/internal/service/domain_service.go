@@ -2,19 +2,35 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
 	"github.com/nesohq/backend/internal/repository"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// ErrDomainNotFound is returned when a domain does not exist or belongs to
+// another user.
+var ErrDomainNotFound = errors.New("domain not found")
+
+// ErrRetentionExceedsPlan is returned when a domain asks to keep raw events
+// longer than its owner's plan allows.
+var ErrRetentionExceedsPlan = errors.New("retention exceeds plan limit")
+
 type DomainService struct {
-	domainRepo *repository.DomainRepository
+	domainRepo repository.DomainStore
+	userRepo   repository.UserStore
+	cache      cache.Cache
 }
 
-func NewDomainService(domainRepo *repository.DomainRepository) *DomainService {
+func NewDomainService(domainRepo repository.DomainStore, userRepo repository.UserStore, cache cache.Cache) *DomainService {
 	return &DomainService{
 		domainRepo: domainRepo,
+		userRepo:   userRepo,
+		cache:      cache,
 	}
 }
 
@@ -24,11 +40,12 @@ func (s *DomainService) Create(ctx context.Context, userID primitive.ObjectID, r
 		Domain:   req.Domain,
 		Verified: false,
 		Settings: domain.DomainSettings{
-			AnonymizeIP:      true,
-			RateLimit:        1000,
-			TrackQueryParams: false,
-			SessionTimeout:   1800,
-			Timezone:         "UTC",
+			AnonymizeIP:         true,
+			RateLimit:           1000,
+			TrackQueryParams:    false,
+			SessionTimeout:      1800,
+			Timezone:            "UTC",
+			PrivacySignalPolicy: domain.PrivacyPolicyAnonymous,
 		},
 	}
 
@@ -53,15 +70,48 @@ func (s *DomainService) Update(ctx context.Context, id primitive.ObjectID, req *
 		return nil, err
 	}
 
+	user, err := s.userRepo.FindByID(ctx, d.UserID)
+	if err != nil {
+		return nil, err
+	}
+	limits := domain.LimitsForPlan(user.Plan)
+	if req.Settings.RetentionDays > limits.MaxRetentionDays {
+		return nil, fmt.Errorf("%w: %s plan keeps raw events for at most %d days", ErrRetentionExceedsPlan, user.Plan, limits.MaxRetentionDays)
+	}
+
 	d.Settings = req.Settings
 
 	if err := s.domainRepo.Update(ctx, d); err != nil {
 		return nil, err
 	}
 
+	// Tracking picks up the new settings on the next hit
+	if err := s.cache.Del(ctx, domainSettingsKey(id)); err != nil {
+		return nil, err
+	}
+
 	return d, nil
 }
 
 func (s *DomainService) Delete(ctx context.Context, id primitive.ObjectID) error {
-	return s.domainRepo.Delete(ctx, id)
+	if err := s.domainRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.cache.Del(ctx, domainSettingsKey(id))
+}
+
+// ensureDomainOwner returns ErrDomainNotFound unless the domain exists and
+// belongs to the user. Store failures are returned as they are.
+func ensureDomainOwner(ctx context.Context, domainRepo repository.DomainStore, userID, domainID primitive.ObjectID) error {
+	d, err := domainRepo.FindByID(ctx, domainID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrDomainNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if d.UserID != userID {
+		return ErrDomainNotFound
+	}
+	return nil
 }
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ErrorService struct {
+	domainRepo repository.DomainStore
+	errorRepo  repository.ErrorStore
+}
+
+func NewErrorService(domainRepo repository.DomainStore, errorRepo repository.ErrorStore) *ErrorService {
+	return &ErrorService{
+		domainRepo: domainRepo,
+		errorRepo:  errorRepo,
+	}
+}
+
+func (s *ErrorService) ListIssues(ctx context.Context, userID, domainID primitive.ObjectID, days int) ([]*domain.ErrorIssue, error) {
+	if err := ensureDomainOwner(ctx, s.domainRepo, userID, domainID); err != nil {
+		return nil, err
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	return s.errorRepo.ListIssues(ctx, domainID, since, 100)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// breakdownFields maps report names to the event field they group by.
+var breakdownFields = map[string]string{
+	"pages":     "path",
+	"referrers": "referrer",
+	"countries": "country",
+	"devices":   "device",
+	"browsers":  "browser",
+}
+
+type ExportService struct {
+	domainRepo repository.DomainStore
+	eventRepo  repository.EventStore
+}
+
+func NewExportService(domainRepo repository.DomainStore, eventRepo repository.EventStore) *ExportService {
+	return &ExportService{
+		domainRepo: domainRepo,
+		eventRepo:  eventRepo,
+	}
+}
+
+// CheckAccess must be called before any output is written, since export
+// errors cannot change the response status once streaming has started.
+func (s *ExportService) CheckAccess(ctx context.Context, userID, domainID primitive.ObjectID, report string) error {
+	if report != "" {
+		if _, ok := breakdownFields[report]; !ok {
+			return fmt.Errorf("unknown report %q", report)
+		}
+	}
+	return ensureDomainOwner(ctx, s.domainRepo, userID, domainID)
+}
+
+func (s *ExportService) StreamEvents(ctx context.Context, domainID primitive.ObjectID, from, to time.Time, fn func(*domain.Event) error) error {
+	return s.eventRepo.StreamRange(ctx, domainID, from, to, fn)
+}
+
+func (s *ExportService) StreamReport(ctx context.Context, domainID primitive.ObjectID, report string, from, to time.Time, fn func(*domain.BreakdownRow) error) error {
+	field, ok := breakdownFields[report]
+	if !ok {
+		return fmt.Errorf("unknown report %q", report)
+	}
+	return s.eventRepo.StreamBreakdown(ctx, domainID, field, from, to, fn)
+}
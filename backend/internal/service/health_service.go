@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/version"
+)
+
+// healthCheckTimeout bounds each dependency ping so a hung connection marks
+// the component down instead of hanging the probe.
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck pings one dependency the process cannot work without.
+type HealthCheck struct {
+	Name string
+	Ping func(ctx context.Context) error
+}
+
+type HealthService struct {
+	checks   []HealthCheck
+	queueLag func(ctx context.Context) (map[string]domain.QueueLag, error)
+}
+
+// NewHealthService builds a readiness checker for the given dependencies.
+// queueLag is optional and only reported, never failing readiness.
+func NewHealthService(checks []HealthCheck, queueLag func(ctx context.Context) (map[string]domain.QueueLag, error)) *HealthService {
+	return &HealthService{
+		checks:   checks,
+		queueLag: queueLag,
+	}
+}
+
+// Check pings every dependency concurrently and reports whether all of them
+// are up.
+func (s *HealthService) Check(ctx context.Context) (*domain.HealthReport, bool) {
+	report := &domain.HealthReport{
+		Status:     "ok",
+		Version:    version.String(),
+		Components: make(map[string]domain.ComponentHealth, len(s.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ready := true
+	for _, check := range s.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			pingCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Ping(pingCtx)
+			component := domain.ComponentHealth{
+				Status:    domain.HealthStatusUp,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				component.Status = domain.HealthStatusDown
+				component.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[check.Name] = component
+			if err != nil {
+				ready = false
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	if s.queueLag != nil {
+		lagCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		if lag, err := s.queueLag(lagCtx); err == nil {
+			report.QueueLag = lag
+		}
+		cancel()
+	}
+
+	if !ready {
+		report.Status = "unavailable"
+	}
+	return report, ready
+}
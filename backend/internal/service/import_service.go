@@ -0,0 +1,358 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImportFile is one uploaded export file. Zip archives (as produced by
+// Plausible) are expanded and every CSV inside is imported.
+type ImportFile struct {
+	Name string
+	Data []byte
+}
+
+// Column aliases used by Universal Analytics, GA4 and Plausible exports.
+var (
+	dateColumns      = []string{"date", "day index", "day", "ga:date"}
+	pageviewColumns  = []string{"pageviews", "views", "screenpageviews", "ga:pageviews"}
+	visitorColumns   = []string{"visitors", "users", "total users", "active users", "ga:users"}
+	dimensionColumns = []struct {
+		field   string
+		aliases []string
+	}{
+		{"pages", []string{"page", "page path", "pagepath", "page path and screen class", "ga:pagepath"}},
+		{"referrers", []string{"source", "session source", "referrer", "ga:source"}},
+		{"countries", []string{"country", "ga:country"}},
+		{"devices", []string{"device", "device category", "devicecategory", "ga:devicecategory"}},
+		{"browsers", []string{"browser", "ga:browser"}},
+	}
+	metricValue = regexp.MustCompile(`^[\d.,:%\s]*$`)
+	dateLayouts = []string{"2006-01-02", "20060102", "1/2/06", "01/02/2006", "Jan 2, 2006"}
+)
+
+type ImportService struct {
+	domainRepo repository.DomainStore
+	rollupRepo repository.RollupStore
+}
+
+func NewImportService(domainRepo repository.DomainStore, rollupRepo repository.RollupStore) *ImportService {
+	return &ImportService{
+		domainRepo: domainRepo,
+		rollupRepo: rollupRepo,
+	}
+}
+
+// ImportForUser checks that the user owns the domain before importing.
+func (s *ImportService) ImportForUser(ctx context.Context, userID, domainID primitive.ObjectID, source string, files []ImportFile) (*domain.ImportResult, error) {
+	if err := ensureDomainOwner(ctx, s.domainRepo, userID, domainID); err != nil {
+		return nil, err
+	}
+	return s.Import(ctx, domainID, source, files)
+}
+
+// Import parses GA or Plausible CSV exports and stores them as imported daily
+// rollups. Each file is either a daily totals report or a daily breakdown by
+// one dimension; re-importing a file replaces what it previously supplied.
+func (s *ImportService) Import(ctx context.Context, domainID primitive.ObjectID, source string, files []ImportFile) (*domain.ImportResult, error) {
+	if source != domain.ImportSourceGoogleAnalytics && source != domain.ImportSourcePlausible {
+		return nil, fmt.Errorf("unknown import source %q", source)
+	}
+
+	csvFiles, err := expandImportFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	if len(csvFiles) == 0 {
+		return nil, errors.New("no CSV files to import")
+	}
+
+	rollups := make(map[time.Time]*domain.DailyRollup)
+	fields := make(map[time.Time]map[string]bool)
+	result := &domain.ImportResult{Source: source, Files: []string{}}
+
+	for _, file := range csvFiles {
+		imported, err := parseImportCSV(file, domainID, source, rollups, fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		if imported {
+			result.Files = append(result.Files, file.Name)
+		}
+	}
+	if len(rollups) == 0 {
+		return nil, errors.New("no recognisable rows found")
+	}
+
+	days := make([]time.Time, 0, len(rollups))
+	for day := range rollups {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	for _, day := range days {
+		rollup := rollups[day]
+		dayFields := fields[day]
+
+		// Breakdown-only imports still need a total to count towards
+		if !dayFields["pageviews"] && dayFields["pages"] {
+			for _, page := range rollup.Pages {
+				rollup.Pageviews += int64(page.Hits)
+			}
+			dayFields["pageviews"] = true
+		}
+
+		names := make([]string, 0, len(dayFields))
+		for name := range dayFields {
+			names = append(names, name)
+		}
+		if err := s.rollupRepo.UpsertImported(ctx, rollup, names); err != nil {
+			return nil, err
+		}
+		result.Pageviews += rollup.Pageviews
+	}
+
+	result.Days = len(days)
+	result.FirstDay = days[0].Format("2006-01-02")
+	result.LastDay = days[len(days)-1].Format("2006-01-02")
+	return result, nil
+}
+
+const (
+	// importMaxEntrySize bounds one CSV expanded from a zip archive.
+	importMaxEntrySize = 64 << 20
+	// importMaxExpandedSize bounds every CSV expanded from an upload's zip
+	// archives together. The upload itself is bounded by its compressed
+	// size, which says nothing about what it expands to.
+	importMaxExpandedSize = 128 << 20
+)
+
+// expandImportFiles replaces zip archives with the CSVs inside them. Entries
+// that claim to be too large are refused before they are decompressed, and
+// reads are capped too, in case the sizes in the archive lie.
+func expandImportFiles(files []ImportFile) ([]ImportFile, error) {
+	var out []ImportFile
+	budget := int64(importMaxExpandedSize)
+	for _, file := range files {
+		if !strings.EqualFold(filepath.Ext(file.Name), ".zip") {
+			out = append(out, file)
+			continue
+		}
+
+		archive, err := zip.NewReader(bytes.NewReader(file.Data), int64(len(file.Data)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+		for _, entry := range archive.File {
+			if entry.FileInfo().IsDir() || !strings.EqualFold(filepath.Ext(entry.Name), ".csv") {
+				continue
+			}
+			if entry.UncompressedSize64 > importMaxEntrySize {
+				return nil, fmt.Errorf("%s: larger than %d MiB uncompressed", entry.Name, importMaxEntrySize>>20)
+			}
+			if entry.UncompressedSize64 > uint64(budget) {
+				return nil, fmt.Errorf("%s: archives expand to more than %d MiB", file.Name, importMaxExpandedSize>>20)
+			}
+
+			rc, err := entry.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", entry.Name, err)
+			}
+			limit := min(int64(importMaxEntrySize), budget)
+			data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", entry.Name, err)
+			}
+			if int64(len(data)) > limit {
+				return nil, fmt.Errorf("%s: expands to more than %d MiB", entry.Name, limit>>20)
+			}
+			budget -= int64(len(data))
+			out = append(out, ImportFile{Name: entry.Name, Data: data})
+		}
+	}
+	return out, nil
+}
+
+// parseImportCSV merges one CSV into rollups. It reports false for files
+// without a date column, which Plausible archives include (e.g. goals).
+func parseImportCSV(file ImportFile, domainID primitive.ObjectID, source string, rollups map[time.Time]*domain.DailyRollup, fields map[time.Time]map[string]bool) (bool, error) {
+	// GA4 prefixes exports with "#" comment lines
+	var body bytes.Buffer
+	for _, line := range strings.Split(string(file.Data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+
+	reader := csv.NewReader(&body)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	dateCol := findColumn(header, dateColumns)
+	if dateCol < 0 {
+		return false, nil
+	}
+	pageviewCol := findColumn(header, pageviewColumns)
+	visitorCol := findColumn(header, visitorColumns)
+
+	dimension, dimensionCol := "", -1
+	for _, dim := range dimensionColumns {
+		if col := findColumn(header, dim.aliases); col >= 0 {
+			dimension, dimensionCol = dim.field, col
+			break
+		}
+	}
+	if dimensionCol < 0 && pageviewCol < 0 && visitorCol < 0 {
+		return false, nil
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return false, err
+	}
+
+	// A file broken down by a dimension we don't store (entry pages, operating
+	// systems, ...) must not be mistaken for daily totals
+	if dimensionCol < 0 && !onlyMetrics(records, dateCol) {
+		return false, nil
+	}
+
+	for _, record := range records {
+		if dateCol >= len(record) {
+			continue
+		}
+
+		day, err := parseImportDate(record[dateCol])
+		if err != nil {
+			// Totals rows at the bottom of GA reports have no date
+			continue
+		}
+		pageviews := parseImportNumber(record, pageviewCol)
+		visitors := parseImportNumber(record, visitorCol)
+
+		rollup, ok := rollups[day]
+		if !ok {
+			rollup = &domain.DailyRollup{
+				DomainID:     domainID,
+				Date:         day,
+				Pages:        []domain.PageStats{},
+				Referrers:    []domain.ReferrerStats{},
+				Countries:    make(map[string]int),
+				Devices:      make(map[string]int),
+				Browsers:     make(map[string]int),
+				Imported:     true,
+				ImportSource: source,
+			}
+			rollups[day] = rollup
+			fields[day] = make(map[string]bool)
+		}
+
+		if dimensionCol < 0 {
+			rollup.Pageviews += pageviews
+			rollup.Visitors += visitors
+			if pageviewCol >= 0 {
+				fields[day]["pageviews"] = true
+			}
+			if visitorCol >= 0 {
+				fields[day]["visitors"] = true
+			}
+			continue
+		}
+
+		if dimensionCol >= len(record) {
+			continue
+		}
+		key := strings.TrimSpace(record[dimensionCol])
+		fields[day][dimension] = true
+		switch dimension {
+		case "pages":
+			hits := pageviews
+			if pageviewCol < 0 {
+				hits = visitors
+			}
+			rollup.Pages = append(rollup.Pages, domain.PageStats{Path: key, Hits: int(hits)})
+		case "referrers":
+			if key == "" || key == "(direct)" || strings.EqualFold(key, "direct / none") {
+				continue
+			}
+			rollup.Referrers = append(rollup.Referrers, domain.ReferrerStats{Referrer: key, Hits: int(visitors)})
+		case "countries":
+			rollup.Countries[key] += int(visitors)
+		case "devices":
+			rollup.Devices[key] += int(visitors)
+		case "browsers":
+			rollup.Browsers[key] += int(visitors)
+		}
+	}
+	return true, nil
+}
+
+func onlyMetrics(records [][]string, dateCol int) bool {
+	for _, record := range records {
+		for i, value := range record {
+			if i != dateCol && !metricValue.MatchString(value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func findColumn(header []string, aliases []string) int {
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for _, alias := range aliases {
+			if name == alias {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseImportDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+}
+
+func parseImportNumber(record []string, col int) int64 {
+	if col < 0 || col >= len(record) {
+		return 0
+	}
+	value := strings.ReplaceAll(strings.TrimSpace(record[col]), ",", "")
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(n)
+}
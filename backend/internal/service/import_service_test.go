@@ -0,0 +1,168 @@
+package service_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type zipEntry struct {
+	name string
+	// size is how many bytes of padding follow the CSV
+	size int64
+	// claimed, when set, is the uncompressed size recorded in the archive
+	// instead of the real one
+	claimed uint64
+}
+
+const importCSV = "date,pageviews,visitors\n2024-01-01,120,40\n"
+
+// buildZip archives a small Plausible-style CSV under each entry's name,
+// padded with size bytes of blank lines.
+func buildZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		if entry.claimed > 0 {
+			header := &zip.FileHeader{Name: entry.name, Method: zip.Store, UncompressedSize64: entry.claimed}
+			if _, err := w.CreateRaw(header); err != nil {
+				t.Fatalf("CreateRaw: %v", err)
+			}
+			continue
+		}
+		f, err := w.Create(entry.name)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		io.WriteString(f, importCSV)
+		if _, err := io.Copy(f, io.LimitReader(newlines{}, entry.size)); err != nil {
+			t.Fatalf("writing %s: %v", entry.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+type newlines struct{}
+
+func (newlines) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = '\n'
+	}
+	return len(p), nil
+}
+
+func TestImportExpandsZipArchives(t *testing.T) {
+	imports := service.NewImportService(memory.NewDomainRepository(), memory.NewRollupRepository())
+	files := []service.ImportFile{{Name: "export.zip", Data: buildZip(t, zipEntry{name: "visitors.csv", size: 1 << 10})}}
+
+	result, err := imports.Import(context.Background(), primitive.NewObjectID(), "plausible", files)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Pageviews != 120 || len(result.Files) != 1 {
+		t.Errorf("result = %+v, want 120 pageviews from visitors.csv", result)
+	}
+}
+
+func TestImportRefusesZipBombs(t *testing.T) {
+	imports := service.NewImportService(memory.NewDomainRepository(), memory.NewRollupRepository())
+
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		want    string
+	}{
+		{
+			name:    "entry too large",
+			entries: []zipEntry{{name: "visitors.csv", claimed: 1 << 40}},
+			want:    "larger than 64 MiB",
+		},
+		{
+			name: "archives too large together",
+			entries: []zipEntry{
+				{name: "a.csv", size: 60 << 20},
+				{name: "b.csv", size: 60 << 20},
+				{name: "c.csv", claimed: 20 << 20},
+			},
+			want: "expand to more than 128 MiB",
+		},
+	}
+	for _, tt := range tests {
+		files := []service.ImportFile{{Name: "export.zip", Data: buildZip(t, tt.entries...)}}
+		_, err := imports.Import(context.Background(), primitive.NewObjectID(), "plausible", files)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRetentionKeepsImportedRollups(t *testing.T) {
+	ctx := context.Background()
+	domains := memory.NewDomainRepository()
+	rollups := memory.NewRollupRepository()
+	events := memory.NewEventRepository()
+	uniques := service.NewUniqueVisitorService(cache.NewMemoryCache(), rollups)
+	retention := service.NewRetentionService(domains, memory.NewUserRepository(), events, memory.NewErrorRepository(),
+		rollups, service.NewRollupService(events, rollups, uniques), cache.NewMemoryCache(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	d := &domain.Domain{UserID: primitive.NewObjectID(), Domain: "example.com"}
+	if err := domains.Create(ctx, d); err != nil {
+		t.Fatalf("creating domain: %v", err)
+	}
+
+	// Beyond the free plan's rollup retention, and recent enough to keep
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	old, recent := today.AddDate(-2, 0, 0), today.AddDate(0, 0, -10)
+	for _, rollup := range []*domain.DailyRollup{
+		{DomainID: d.ID, Date: old, Pageviews: 70},
+		{DomainID: d.ID, Date: recent, Pageviews: 100},
+	} {
+		if err := rollups.Upsert(ctx, rollup); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+	}
+	for _, rollup := range []*domain.DailyRollup{
+		{DomainID: d.ID, Date: old, Pageviews: 50},
+		{DomainID: d.ID, Date: recent, Pageviews: 120},
+	} {
+		if err := rollups.UpsertImported(ctx, rollup, []string{"pageviews"}); err != nil {
+			t.Fatalf("UpsertImported: %v", err)
+		}
+	}
+
+	if err := retention.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	kept, err := rollups.FindRange(ctx, d.ID, old, old.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("FindRange: %v", err)
+	}
+	if len(kept) != 1 || !kept[0].Imported {
+		t.Fatalf("rollups on the expired day = %+v, want only the imported one", kept)
+	}
+
+	// The recent day counts its own events' rollup, not both
+	total, err := rollups.SumPageviews(ctx, d.ID, today)
+	if err != nil {
+		t.Fatalf("SumPageviews: %v", err)
+	}
+	if total != 150 {
+		t.Errorf("SumPageviews = %d, want 50 imported + 100 tracked", total)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PrivacyService struct {
+	domainRepo   repository.DomainStore
+	eventRepo    repository.EventStore
+	errorRepo    repository.ErrorStore
+	purchaseRepo repository.PurchaseStore
+	requestRepo  repository.PrivacyRequestStore
+	rollups      *RollupService
+	cache        cache.Cache
+}
+
+func NewPrivacyService(
+	domainRepo repository.DomainStore,
+	eventRepo repository.EventStore,
+	errorRepo repository.ErrorStore,
+	purchaseRepo repository.PurchaseStore,
+	requestRepo repository.PrivacyRequestStore,
+	rollups *RollupService,
+	cache cache.Cache,
+) *PrivacyService {
+	return &PrivacyService{
+		domainRepo:   domainRepo,
+		eventRepo:    eventRepo,
+		errorRepo:    errorRepo,
+		purchaseRepo: purchaseRepo,
+		requestRepo:  requestRepo,
+		rollups:      rollups,
+		cache:        cache,
+	}
+}
+
+func (s *PrivacyService) ExportVisitor(ctx context.Context, userID, domainID primitive.ObjectID, visitorID string) (*domain.VisitorExport, error) {
+	if err := s.checkOwner(ctx, userID, domainID); err != nil {
+		return nil, err
+	}
+
+	events, err := s.eventRepo.FindByVisitor(ctx, domainID, visitorID)
+	if err != nil {
+		return nil, err
+	}
+	errorEvents, err := s.errorRepo.FindByVisitor(ctx, domainID, visitorID)
+	if err != nil {
+		return nil, err
+	}
+	purchases, err := s.purchaseRepo.FindByVisitor(ctx, domainID, visitorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.requestRepo.Create(ctx, &domain.PrivacyRequest{
+		DomainID:       domainID,
+		UserID:         userID,
+		VisitorID:      visitorID,
+		Type:           domain.PrivacyRequestExport,
+		EventsAffected: int64(len(events)),
+		ErrorsAffected: int64(len(errorEvents)),
+		OrdersAffected: int64(len(purchases)),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &domain.VisitorExport{
+		DomainID:   domainID,
+		VisitorID:  visitorID,
+		ExportedAt: time.Now(),
+		Events:     events,
+		Errors:     errorEvents,
+		Purchases:  purchases,
+	}, nil
+}
+
+// EraseVisitor permanently deletes a visitor's events and error reports,
+// removes them from the realtime active set and live view, unlinks their
+// orders and rebuilds the unique visitor sketches and any daily rollups their
+// events had been counted in. Rollups for days whose raw events were already
+// purged hold only anonymous totals.
+func (s *PrivacyService) EraseVisitor(ctx context.Context, userID, domainID primitive.ObjectID, visitorID string) (*domain.PrivacyRequest, error) {
+	if err := s.checkOwner(ctx, userID, domainID); err != nil {
+		return nil, err
+	}
+
+	activeKey := fmt.Sprintf("active_visitors:%s", domainID.Hex())
+	if err := s.cache.ZRem(ctx, activeKey, visitorID); err != nil {
+		return nil, err
+	}
+	if err := s.cache.Del(ctx, liveVisitorKey(domainID, visitorID)); err != nil {
+		return nil, err
+	}
+
+	visitorEvents, err := s.eventRepo.FindByVisitor(ctx, domainID, visitorID)
+	if err != nil {
+		return nil, err
+	}
+	days := make([]time.Time, len(visitorEvents))
+	for i, event := range visitorEvents {
+		days[i] = event.Timestamp
+	}
+
+	events, err := s.eventRepo.DeleteByVisitor(ctx, domainID, visitorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rollups.RebuildDays(ctx, domainID, days); err != nil {
+		return nil, err
+	}
+	errorEvents, err := s.errorRepo.DeleteByVisitor(ctx, domainID, visitorID)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := s.purchaseRepo.DetachVisitor(ctx, domainID, visitorID)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &domain.PrivacyRequest{
+		DomainID:       domainID,
+		UserID:         userID,
+		VisitorID:      visitorID,
+		Type:           domain.PrivacyRequestErase,
+		EventsAffected: events,
+		ErrorsAffected: errorEvents,
+		OrdersAffected: orders,
+	}
+	if err := s.requestRepo.Create(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *PrivacyService) ListRequests(ctx context.Context, userID, domainID primitive.ObjectID) ([]*domain.PrivacyRequest, error) {
+	if err := s.checkOwner(ctx, userID, domainID); err != nil {
+		return nil, err
+	}
+	return s.requestRepo.FindByDomainID(ctx, domainID)
+}
+
+func (s *PrivacyService) checkOwner(ctx context.Context, userID, domainID primitive.ObjectID) error {
+	return ensureDomainOwner(ctx, s.domainRepo, userID, domainID)
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PurchaseService struct {
+	domainRepo   repository.DomainStore
+	purchaseRepo repository.PurchaseStore
+}
+
+func NewPurchaseService(domainRepo repository.DomainStore, purchaseRepo repository.PurchaseStore) *PurchaseService {
+	return &PurchaseService{
+		domainRepo:   domainRepo,
+		purchaseRepo: purchaseRepo,
+	}
+}
+
+func (s *PurchaseService) GetRevenueStats(ctx context.Context, userID, domainID primitive.ObjectID, currency string, days int) (*domain.RevenueStats, error) {
+	if err := ensureDomainOwner(ctx, s.domainRepo, userID, domainID); err != nil {
+		return nil, err
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	return s.purchaseRepo.GetRevenueStats(ctx, domainID, strings.ToUpper(currency), since)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/repository"
+)
+
+type RetentionService struct {
+	domainRepo    repository.DomainStore
+	userRepo      repository.UserStore
+	eventRepo     repository.EventStore
+	errorRepo     repository.ErrorStore
+	rollupRepo    repository.RollupStore
+	rollupService *RollupService
+	cache         cache.Cache
+	logger        *slog.Logger
+}
+
+func NewRetentionService(
+	domainRepo repository.DomainStore,
+	userRepo repository.UserStore,
+	eventRepo repository.EventStore,
+	errorRepo repository.ErrorStore,
+	rollupRepo repository.RollupStore,
+	rollupService *RollupService,
+	cache cache.Cache,
+	logger *slog.Logger,
+) *RetentionService {
+	return &RetentionService{
+		domainRepo:    domainRepo,
+		userRepo:      userRepo,
+		eventRepo:     eventRepo,
+		errorRepo:     errorRepo,
+		rollupRepo:    rollupRepo,
+		rollupService: rollupService,
+		cache:         cache,
+		logger:        logger,
+	}
+}
+
+// Run rolls up completed days and purges expired raw events and rollups for
+// every domain. A failure on one domain does not stop the others. Only one
+// worker runs it per hour; the others skip theirs.
+func (s *RetentionService) Run(ctx context.Context) error {
+	lockKey := fmt.Sprintf("retention_run:%s", time.Now().UTC().Format("2006010215"))
+	acquired, err := s.cache.SetNX(ctx, lockKey, 1, 2*time.Hour)
+	if err != nil || !acquired {
+		return err
+	}
+
+	domains, err := s.domainRepo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range domains {
+		if err := s.enforce(ctx, d); err != nil {
+			s.logger.ErrorContext(ctx, "retention failed", "domain_id", d.ID.Hex(), "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *RetentionService) enforce(ctx context.Context, d *domain.Domain) error {
+	plan := domain.PlanFree
+	if user, err := s.userRepo.FindByID(ctx, d.UserID); err == nil {
+		plan = user.Plan
+	}
+	limits := domain.LimitsForPlan(plan)
+
+	retentionDays := d.Settings.RetentionDays
+	if retentionDays <= 0 || retentionDays > limits.MaxRetentionDays {
+		retentionDays = limits.MaxRetentionDays
+	}
+
+	today := startOfDay(time.Now())
+	cutoff := today.AddDate(0, 0, -retentionDays)
+
+	// Every completed day must be rolled up before its raw events can go.
+	// Yesterday is always rebuilt to pick up late-arriving events.
+	oldest, ok, err := s.eventRepo.OldestTimestamp(ctx, d.ID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		built, err := s.rollupRepo.BuiltDates(ctx, d.ID, startOfDay(oldest), today)
+		if err != nil {
+			return err
+		}
+		rolledUp := make(map[int64]bool, len(built))
+		for _, date := range built {
+			rolledUp[date.Unix()] = true
+		}
+
+		yesterday := today.AddDate(0, 0, -1)
+		for day := startOfDay(oldest); day.Before(today); day = day.AddDate(0, 0, 1) {
+			if rolledUp[day.Unix()] && !day.Equal(yesterday) {
+				continue
+			}
+			if err := s.rollupService.BuildDay(ctx, d.ID, day); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := s.eventRepo.DeleteBefore(ctx, d.ID, cutoff); err != nil {
+		return err
+	}
+	if _, err := s.errorRepo.DeleteBefore(ctx, d.ID, cutoff); err != nil {
+		return err
+	}
+
+	// Imported rollups are kept past the plan's rollup retention
+	rollupCutoff := today.AddDate(0, 0, -limits.RollupRetentionDays)
+	_, err = s.rollupRepo.DeleteBefore(ctx, d.ID, rollupCutoff)
+	return err
+}
@@ -0,0 +1,112 @@
+package service_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRetentionRunsOncePerHourAcrossWorkers(t *testing.T) {
+	ctx := context.Background()
+	domains := memory.NewDomainRepository()
+	rollups := memory.NewRollupRepository()
+	events := memory.NewEventRepository()
+	shared := cache.NewMemoryCache()
+	newWorker := func() *service.RetentionService {
+		uniques := service.NewUniqueVisitorService(shared, rollups)
+		return service.NewRetentionService(domains, memory.NewUserRepository(), events, memory.NewErrorRepository(),
+			rollups, service.NewRollupService(events, rollups, uniques), shared, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+	first, second := newWorker(), newWorker()
+
+	d := &domain.Domain{UserID: primitive.NewObjectID(), Domain: "example.com"}
+	if err := domains.Create(ctx, d); err != nil {
+		t.Fatalf("creating domain: %v", err)
+	}
+	expired := func() *domain.Event {
+		return &domain.Event{ID: primitive.NewObjectID(), DomainID: d.ID, Timestamp: time.Now().AddDate(-2, 0, 0), Path: "/"}
+	}
+
+	if _, err := events.CreateMany(ctx, []*domain.Event{expired()}); err != nil {
+		t.Fatalf("CreateMany: %v", err)
+	}
+	if err := first.Run(ctx); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+	if n, err := events.CountTotal(ctx, d.ID); err != nil || n != 0 {
+		t.Fatalf("CountTotal after the first run = %d, %v, want the expired event purged", n, err)
+	}
+
+	// Another worker in the same hour leaves the run to the first
+	if _, err := events.CreateMany(ctx, []*domain.Event{expired()}); err != nil {
+		t.Fatalf("CreateMany: %v", err)
+	}
+	if err := second.Run(ctx); err != nil {
+		t.Fatalf("second Run: %v", err)
+	}
+	if n, err := events.CountTotal(ctx, d.ID); err != nil || n != 1 {
+		t.Errorf("CountTotal after the second run = %d, %v, want the event left alone", n, err)
+	}
+}
+
+func TestRetentionRollsUpMissingDaysAndYesterday(t *testing.T) {
+	ctx := context.Background()
+	domains := memory.NewDomainRepository()
+	rollups := memory.NewRollupRepository()
+	events := memory.NewEventRepository()
+	memoryCache := cache.NewMemoryCache()
+	uniques := service.NewUniqueVisitorService(memoryCache, rollups)
+	retention := service.NewRetentionService(domains, memory.NewUserRepository(), events, memory.NewErrorRepository(),
+		rollups, service.NewRollupService(events, rollups, uniques), memoryCache, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	d := &domain.Domain{UserID: primitive.NewObjectID(), Domain: "example.com"}
+	if err := domains.Create(ctx, d); err != nil {
+		t.Fatalf("creating domain: %v", err)
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	rolledUp, imported, missing, yesterday := today.AddDate(0, 0, -5), today.AddDate(0, 0, -4), today.AddDate(0, 0, -3), today.AddDate(0, 0, -1)
+	for _, day := range []time.Time{rolledUp, imported, missing, yesterday} {
+		event := &domain.Event{ID: primitive.NewObjectID(), DomainID: d.ID, Timestamp: day.Add(time.Hour), Path: "/"}
+		if err := events.Create(ctx, event); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	// Stale counts only a rebuild would replace
+	for _, day := range []time.Time{rolledUp, yesterday} {
+		if err := rollups.Upsert(ctx, &domain.DailyRollup{DomainID: d.ID, Date: day, Pageviews: 99}); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+	}
+	if err := rollups.UpsertImported(ctx, &domain.DailyRollup{DomainID: d.ID, Date: imported, Pageviews: 99}, []string{"pageviews"}); err != nil {
+		t.Fatalf("UpsertImported: %v", err)
+	}
+
+	if err := retention.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	found, err := rollups.FindRange(ctx, d.ID, rolledUp, today)
+	if err != nil {
+		t.Fatalf("FindRange: %v", err)
+	}
+	pageviews := make(map[time.Time]int64)
+	for _, rollup := range found {
+		if !rollup.Imported {
+			pageviews[rollup.Date] = rollup.Pageviews
+		}
+	}
+	want := map[time.Time]int64{rolledUp: 99, imported: 1, missing: 1, yesterday: 1}
+	for day, n := range want {
+		if pageviews[day] != n {
+			t.Errorf("pageviews on %s = %d, want %d", day.Format("2006-01-02"), pageviews[day], n)
+		}
+	}
+}
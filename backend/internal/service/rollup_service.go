@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RollupService struct {
+	eventRepo  repository.EventStore
+	rollupRepo repository.RollupStore
+	uniques    *UniqueVisitorService
+}
+
+func NewRollupService(eventRepo repository.EventStore, rollupRepo repository.RollupStore, uniques *UniqueVisitorService) *RollupService {
+	return &RollupService{
+		eventRepo:  eventRepo,
+		rollupRepo: rollupRepo,
+		uniques:    uniques,
+	}
+}
+
+// BuildDay (re)computes the rollup for the UTC day containing day from the
+// raw events still stored for it, and saves the day's unique visitor sketch
+// with it. Once the day's hours have left Redis the sketch saved earlier is
+// kept.
+func (s *RollupService) BuildDay(ctx context.Context, domainID primitive.ObjectID, day time.Time) error {
+	start := startOfDay(day)
+	end := start.AddDate(0, 0, 1)
+	rollup, err := s.eventRepo.AggregateDay(ctx, domainID, start, end)
+	if err != nil {
+		return err
+	}
+
+	if rollup.VisitorSketch, err = s.uniques.DaySketch(ctx, domainID, start); err != nil {
+		return err
+	}
+	if rollup.VisitorSketch == nil {
+		existing, err := s.rollupRepo.FindRange(ctx, domainID, start, end)
+		if err != nil {
+			return err
+		}
+		for _, r := range existing {
+			if !r.Imported {
+				rollup.VisitorSketch = r.VisitorSketch
+			}
+		}
+	}
+	return s.rollupRepo.Upsert(ctx, rollup)
+}
+
+// RebuildDays recomputes the unique visitor sketches of the given days and
+// the rollups that already exist for them from the raw events still stored,
+// e.g. after a visitor's events were erased so they no longer count towards
+// them.
+func (s *RollupService) RebuildDays(ctx context.Context, domainID primitive.ObjectID, days []time.Time) error {
+	seen := make(map[time.Time]bool)
+	for _, day := range days {
+		start := startOfDay(day)
+		if seen[start] {
+			continue
+		}
+		seen[start] = true
+		end := start.AddDate(0, 0, 1)
+
+		visitors := make(map[time.Time][]string)
+		counted := make(map[string]bool)
+		err := s.eventRepo.StreamRange(ctx, domainID, start, end, func(event *domain.Event) error {
+			if event.VisitorID == "" {
+				return nil
+			}
+			hour := event.Timestamp.UTC().Truncate(time.Hour)
+			if key := hour.Format("15") + event.VisitorID; !counted[key] {
+				counted[key] = true
+				visitors[hour] = append(visitors[hour], event.VisitorID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sketch, err := s.uniques.Rebuild(ctx, domainID, start, visitors)
+		if err != nil {
+			return err
+		}
+
+		exists, err := s.rollupRepo.Exists(ctx, domainID, start)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		rollup, err := s.eventRepo.AggregateDay(ctx, domainID, start, end)
+		if err != nil {
+			return err
+		}
+		rollup.VisitorSketch = sketch
+		if err := s.rollupRepo.Upsert(ctx, rollup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StatsService serves the dashboard's read side of tracking data. It needs no
+// queue, so the API process can run without a NATS connection.
+type StatsService struct {
+	eventRepo  repository.EventStore
+	rollupRepo repository.RollupStore
+	domainRepo repository.DomainStore
+	uniques    *UniqueVisitorService
+	cache      cache.Cache
+	logger     *slog.Logger
+
+	// How long after their last hit a visitor still counts as active
+	activeWindow time.Duration
+}
+
+func NewStatsService(
+	eventRepo repository.EventStore,
+	rollupRepo repository.RollupStore,
+	domainRepo repository.DomainStore,
+	uniques *UniqueVisitorService,
+	cache cache.Cache,
+	logger *slog.Logger,
+	activeWindow time.Duration,
+) *StatsService {
+	return &StatsService{
+		eventRepo:    eventRepo,
+		rollupRepo:   rollupRepo,
+		domainRepo:   domainRepo,
+		uniques:      uniques,
+		cache:        cache,
+		logger:       logger,
+		activeWindow: activeWindow,
+	}
+}
+
+const (
+	// realtimeTopLimit caps the realtime top pages and top referrers.
+	realtimeTopLimit = 10
+	// realtimeUnionTTL is how long a breakdown's hour-long union is reused
+	// by later polls before it is summed again.
+	realtimeUnionTTL = 5 * time.Second
+)
+
+// GetRealtimeStats reports the active visitors and, over the last
+// realtimeMinutes minutes, the hits per minute and the busiest pages,
+// referrers, countries, devices and browsers. Everything is read from the
+// counters Track keeps in Redis.
+func (s *StatsService) GetRealtimeStats(ctx context.Context, userID, domainID primitive.ObjectID) (*domain.RealtimeStats, error) {
+	if err := ensureDomainOwner(ctx, s.domainRepo, userID, domainID); err != nil {
+		return nil, err
+	}
+
+	activeVisitors, err := s.GetActiveVisitorCount(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get active visitor IDs (top 20)
+	activeKey := fmt.Sprintf("active_visitors:%s", domainID.Hex())
+	activeIDs, err := s.cache.ZRevRange(ctx, activeKey, 0, 19)
+	if err != nil {
+		// Log error but continue
+		s.logger.WarnContext(ctx, "failed to get active visitor ids", "domain_id", domainID.Hex(), "error", err)
+		activeIDs = []string{}
+	}
+
+	// Oldest first, ending with the current, partial minute
+	minutes := make([]time.Time, realtimeMinutes)
+	current := time.Now().Truncate(time.Minute)
+	for i := range minutes {
+		minutes[i] = current.Add(time.Duration(i-realtimeMinutes+1) * time.Minute)
+	}
+
+	hitsPerMinute, err := s.realtimeHits(ctx, domainID, minutes)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &domain.RealtimeStats{
+		ActiveVisitors:   activeVisitors,
+		ActiveVisitorIDs: activeIDs,
+		HitsPerMinute:    hitsPerMinute,
+		TopPages:         []domain.PageStats{},
+		TopReferrers:     []domain.ReferrerStats{},
+		Countries:        make(map[string]int),
+		Devices:          make(map[string]int),
+		Browsers:         make(map[string]int),
+	}
+
+	pages, err := s.realtimeBreakdown(ctx, domainID, "pages", minutes, realtimeTopLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range pages {
+		stats.TopPages = append(stats.TopPages, domain.PageStats{Path: page.Member.(string), Hits: int(page.Score)})
+	}
+
+	referrers, err := s.realtimeBreakdown(ctx, domainID, "referrers", minutes, realtimeTopLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, referrer := range referrers {
+		stats.TopReferrers = append(stats.TopReferrers, domain.ReferrerStats{Referrer: referrer.Member.(string), Hits: int(referrer.Score)})
+	}
+
+	for name, counts := range map[string]map[string]int{
+		"countries": stats.Countries,
+		"devices":   stats.Devices,
+		"browsers":  stats.Browsers,
+	} {
+		values, err := s.realtimeBreakdown(ctx, domainID, name, minutes, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			counts[value.Member.(string)] = int(value.Score)
+		}
+	}
+
+	return stats, nil
+}
+
+// realtimeHits returns the hits counted in each of minutes, zero where
+// nothing was tracked.
+func (s *StatsService) realtimeHits(ctx context.Context, domainID primitive.ObjectID, minutes []time.Time) ([]domain.HitsPerMinute, error) {
+	keys := make([]string, len(minutes))
+	for i, minute := range minutes {
+		keys[i] = realtimeHitsKey(domainID, minute)
+	}
+	values, err := s.cache.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]domain.HitsPerMinute, len(minutes))
+	for i, minute := range minutes {
+		series[i] = domain.HitsPerMinute{Minute: minute.UTC().Format(time.RFC3339)}
+		if value, ok := values[i].(string); ok {
+			hits, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hit counter %s: %w", keys[i], err)
+			}
+			series[i].Hits = hits
+		}
+	}
+	return series, nil
+}
+
+// realtimeBreakdown sums a breakdown's counts over minutes and returns the
+// limit values with the most hits, or all of them if limit is 0, highest
+// first and ties by value. Ties at the limit are cut the way Redis orders
+// them, by value descending.
+//
+// The sum is stored under a key named after the window's last minute, so
+// polls in the same minute share it for realtimeUnionTTL instead of summing
+// the minutes again, and polls in different minutes never overwrite each
+// other's.
+func (s *StatsService) realtimeBreakdown(ctx context.Context, domainID primitive.ObjectID, breakdown string, minutes []time.Time, limit int) ([]redis.Z, error) {
+	last := minutes[len(minutes)-1]
+	dest := fmt.Sprintf("hits_%s:%s:window:%s", breakdown, domainID.Hex(), last.UTC().Format("200601021504"))
+
+	// An empty union is not stored, so quiet windows are summed every time;
+	// there is little to sum
+	cached, err := s.cache.ZCard(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+	if cached == 0 {
+		keys := make([]string, len(minutes))
+		for i, minute := range minutes {
+			keys[i] = realtimeBreakdownKey(domainID, breakdown, minute)
+		}
+		err := s.cache.Pipelined(ctx, func(pipe cache.Pipe) {
+			pipe.ZUnionStore(dest, keys...)
+			pipe.Expire(dest, realtimeUnionTTL)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	values, err := s.cache.ZRevRangeWithScores(ctx, dest, 0, int64(limit)-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		if values[i].Score != values[j].Score {
+			return values[i].Score > values[j].Score
+		}
+		return values[i].Member.(string) < values[j].Member.(string)
+	})
+	return values, nil
+}
+
+// liveVisitorLimit caps how many active visitors the live view reads.
+const liveVisitorLimit = 500
+
+// GetLiveView lists the active visitors, most recently seen first, and how
+// many of them are on each page, busiest first. Beyond liveVisitorLimit
+// active visitors only the most recently seen are listed and counted per
+// page.
+func (s *StatsService) GetLiveView(ctx context.Context, userID, domainID primitive.ObjectID) (*domain.LiveView, error) {
+	if err := ensureDomainOwner(ctx, s.domainRepo, userID, domainID); err != nil {
+		return nil, err
+	}
+
+	count, err := s.GetActiveVisitorCount(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	activeKey := fmt.Sprintf("active_visitors:%s", domainID.Hex())
+	ids, err := s.cache.ZRevRange(ctx, activeKey, 0, liveVisitorLimit-1)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &domain.LiveView{
+		ActiveVisitors: count,
+		Pages:          []domain.LivePage{},
+		Visitors:       []domain.LiveVisitor{},
+	}
+	if len(ids) == 0 {
+		return view, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = liveVisitorKey(domainID, id)
+	}
+	values, err := s.cache.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	pageVisitors := make(map[string]int)
+	for i, value := range values {
+		// Missing when the visitor was erased since the set was read
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var visitor domain.LiveVisitor
+		if err := json.Unmarshal([]byte(data), &visitor); err != nil {
+			s.logger.WarnContext(ctx, "invalid live visitor state", "domain_id", domainID.Hex(), "visitor_id", ids[i], "error", err)
+			continue
+		}
+		view.Visitors = append(view.Visitors, visitor)
+		pageVisitors[visitor.Path]++
+	}
+
+	for path, visitors := range pageVisitors {
+		view.Pages = append(view.Pages, domain.LivePage{Path: path, Visitors: visitors})
+	}
+	sort.Slice(view.Pages, func(i, j int) bool {
+		if view.Pages[i].Visitors != view.Pages[j].Visitors {
+			return view.Pages[i].Visitors > view.Pages[j].Visitors
+		}
+		return view.Pages[i].Path < view.Pages[j].Path
+	})
+	return view, nil
+}
+
+// GetOverviewStats returns all-time hits and the unique visitors in
+// [from, to).
+func (s *StatsService) GetOverviewStats(ctx context.Context, userID, domainID primitive.ObjectID, from, to time.Time) (*domain.OverviewStats, error) {
+	if err := ensureDomainOwner(ctx, s.domainRepo, userID, domainID); err != nil {
+		return nil, err
+	}
+
+	totalHits, err := s.eventRepo.CountTotal(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Days whose raw events were purged only survive as rollups
+	oldest, ok, err := s.eventRepo.OldestTimestamp(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		oldest = time.Now()
+	}
+	purgedHits, err := s.rollupRepo.SumPageviews(ctx, domainID, startOfDay(oldest))
+	if err != nil {
+		return nil, err
+	}
+	totalHits += purgedHits
+
+	uniqueVisitors, err := s.uniques.Count(ctx, domainID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.OverviewStats{
+		TotalHits:      totalHits,
+		UniqueVisitors: uniqueVisitors,
+		AvgSessionTime: 0, // TODO: Calculate
+		BounceRate:     0, // TODO: Calculate
+	}, nil
+}
+
+func (s *StatsService) GetActiveVisitorCount(ctx context.Context, domainID primitive.ObjectID) (int, error) {
+	activeKey := fmt.Sprintf("active_visitors:%s", domainID.Hex())
+	windowStart := fmt.Sprintf("%d", time.Now().Add(-s.activeWindow).Unix())
+
+	// Remove old visitors
+	if err := s.cache.ZRemRangeByScore(ctx, activeKey, "-inf", windowStart); err != nil {
+		return 0, err
+	}
+
+	// Count active
+	count, err := s.cache.ZCard(ctx, activeKey)
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
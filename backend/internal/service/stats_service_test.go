@@ -0,0 +1,234 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newStatsService(f *trackingFixture) *service.StatsService {
+	rollupRepo := memory.NewRollupRepository()
+	return service.NewStatsService(
+		memory.NewEventRepository(),
+		rollupRepo,
+		f.domains,
+		service.NewUniqueVisitorService(f.cache, rollupRepo),
+		f.cache,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		5*time.Minute,
+	)
+}
+
+func TestLiveViewShowsEachVisitorsLatestPage(t *testing.T) {
+	f := newTrackingFixture(t)
+	stats := newStatsService(f)
+	domainID := f.addDomain(t, domain.DomainSettings{})
+	ctx := context.Background()
+
+	hits := []domain.TrackRequest{
+		{Path: "/", VisitorID: "v1", Referrer: "https://news.example.org/"},
+		{Path: "/story", VisitorID: "v2"},
+		{Path: "/story", VisitorID: "v1"},
+		{Path: "/about", VisitorID: "v3"},
+		{Path: "/ignored"},
+	}
+	for i := range hits {
+		if err := f.service.Track(ctx, domainID, &hits[i], testIP, testUserAgent); err != nil {
+			t.Fatalf("Track: %v", err)
+		}
+	}
+
+	view, err := stats.GetLiveView(ctx, f.owner(t, domainID), domainID)
+	if err != nil {
+		t.Fatalf("GetLiveView: %v", err)
+	}
+	if view.ActiveVisitors != 3 || len(view.Visitors) != 3 {
+		t.Fatalf("active = %d, listed = %d, want 3 of each", view.ActiveVisitors, len(view.Visitors))
+	}
+
+	wantPages := []domain.LivePage{{Path: "/story", Visitors: 2}, {Path: "/about", Visitors: 1}}
+	if len(view.Pages) != len(wantPages) {
+		t.Fatalf("pages = %+v, want %+v", view.Pages, wantPages)
+	}
+	for i, page := range wantPages {
+		if view.Pages[i] != page {
+			t.Errorf("pages[%d] = %+v, want %+v", i, view.Pages[i], page)
+		}
+	}
+
+	for _, visitor := range view.Visitors {
+		if visitor.VisitorID != "v1" {
+			continue
+		}
+		if visitor.Path != "/story" || visitor.Device != "Desktop" || visitor.LastSeen.IsZero() {
+			t.Errorf("v1 = %+v, want their latest hit on /story", visitor)
+		}
+	}
+}
+
+func TestLiveViewDropsErasedVisitors(t *testing.T) {
+	f := newTrackingFixture(t)
+	stats := newStatsService(f)
+	domainID := f.addDomain(t, domain.DomainSettings{})
+	ctx := context.Background()
+
+	for _, id := range []string{"v1", "v2"} {
+		req := &domain.TrackRequest{Path: "/", VisitorID: id}
+		if err := f.service.Track(ctx, domainID, req, testIP, testUserAgent); err != nil {
+			t.Fatalf("Track: %v", err)
+		}
+	}
+	// The visitor's state is gone but the active set has not caught up yet
+	if err := f.cache.Del(ctx, "live_visitor:"+domainID.Hex()+":v1"); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+
+	view, err := stats.GetLiveView(ctx, f.owner(t, domainID), domainID)
+	if err != nil {
+		t.Fatalf("GetLiveView: %v", err)
+	}
+	if len(view.Visitors) != 1 || view.Visitors[0].VisitorID != "v2" {
+		t.Errorf("visitors = %+v, want only v2", view.Visitors)
+	}
+	if len(view.Pages) != 1 || view.Pages[0].Visitors != 1 {
+		t.Errorf("pages = %+v, want / with 1 visitor", view.Pages)
+	}
+}
+
+func TestLiveViewIsOnlyForTheDomainOwner(t *testing.T) {
+	f := newTrackingFixture(t)
+	stats := newStatsService(f)
+	domainID := f.addDomain(t, domain.DomainSettings{})
+	ctx := context.Background()
+
+	if err := f.service.Track(ctx, domainID, &domain.TrackRequest{Path: "/", VisitorID: "v1"}, testIP, testUserAgent); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+
+	if _, err := stats.GetLiveView(ctx, primitive.NewObjectID(), domainID); !errors.Is(err, service.ErrDomainNotFound) {
+		t.Errorf("GetLiveView by another user error = %v, want ErrDomainNotFound", err)
+	}
+	if _, err := stats.GetRealtimeStats(ctx, primitive.NewObjectID(), domainID); !errors.Is(err, service.ErrDomainNotFound) {
+		t.Errorf("GetRealtimeStats by another user error = %v, want ErrDomainNotFound", err)
+	}
+}
+
+func TestRealtimeStatsCountHitsPerMinute(t *testing.T) {
+	f := newTrackingFixture(t)
+	stats := newStatsService(f)
+	domainID := f.addDomain(t, domain.DomainSettings{})
+	ctx := context.Background()
+
+	hits := []domain.TrackRequest{
+		{Path: "/b", VisitorID: "v1", Referrer: "https://news.example.org/"},
+		{Path: "/a", VisitorID: "v2"},
+		{Path: "/c", VisitorID: "v1", Referrer: "https://news.example.org/"},
+		{Path: "/c", VisitorID: "v3", Referrer: "https://search.example.net/"},
+		{Path: "/b"},
+		{Path: "/c"},
+	}
+	for i := range hits {
+		if err := f.service.Track(ctx, domainID, &hits[i], testIP, testUserAgent); err != nil {
+			t.Fatalf("Track: %v", err)
+		}
+	}
+
+	// Counted before the window and 10 minutes ago
+	now := time.Now().UTC().Truncate(time.Minute)
+	if err := f.cache.Set(ctx, "hits:"+domainID.Hex()+":"+now.Add(-60*time.Minute).Format("200601021504"), 5, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := f.cache.Set(ctx, "hits:"+domainID.Hex()+":"+now.Add(-10*time.Minute).Format("200601021504"), 4, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, err := stats.GetRealtimeStats(ctx, f.owner(t, domainID), domainID)
+	if err != nil {
+		t.Fatalf("GetRealtimeStats: %v", err)
+	}
+
+	if len(got.HitsPerMinute) != 60 {
+		t.Fatalf("got %d points, want 60", len(got.HitsPerMinute))
+	}
+	total := 0
+	for i, point := range got.HitsPerMinute {
+		total += point.Hits
+		if i == 0 {
+			continue
+		}
+		prev, _ := time.Parse(time.RFC3339, got.HitsPerMinute[i-1].Minute)
+		minute, _ := time.Parse(time.RFC3339, point.Minute)
+		if minute.Sub(prev) != time.Minute {
+			t.Fatalf("point %d at %s follows %s", i, point.Minute, got.HitsPerMinute[i-1].Minute)
+		}
+	}
+	if total != len(hits)+4 {
+		t.Errorf("hits in window = %d, want %d", total, len(hits)+4)
+	}
+
+	wantPages := []domain.PageStats{{Path: "/c", Hits: 3}, {Path: "/b", Hits: 2}, {Path: "/a", Hits: 1}}
+	if len(got.TopPages) != len(wantPages) {
+		t.Fatalf("top pages = %+v, want %+v", got.TopPages, wantPages)
+	}
+	for i, page := range wantPages {
+		if got.TopPages[i] != page {
+			t.Errorf("top pages[%d] = %+v, want %+v", i, got.TopPages[i], page)
+		}
+	}
+
+	wantReferrers := []domain.ReferrerStats{
+		{Referrer: "https://news.example.org/", Hits: 2},
+		{Referrer: "https://search.example.net/", Hits: 1},
+	}
+	if len(got.TopReferrers) != len(wantReferrers) {
+		t.Fatalf("top referrers = %+v, want %+v", got.TopReferrers, wantReferrers)
+	}
+	for i, referrer := range wantReferrers {
+		if got.TopReferrers[i] != referrer {
+			t.Errorf("top referrers[%d] = %+v, want %+v", i, got.TopReferrers[i], referrer)
+		}
+	}
+
+	if got.Devices["Desktop"] != len(hits) {
+		t.Errorf("devices = %v, want %d Desktop", got.Devices, len(hits))
+	}
+}
+
+func TestRealtimeStatsLimitTopPages(t *testing.T) {
+	f := newTrackingFixture(t)
+	stats := newStatsService(f)
+	domainID := f.addDomain(t, domain.DomainSettings{})
+	ctx := context.Background()
+
+	for _, path := range []string{"/k", "/j", "/i", "/h", "/g", "/f", "/e", "/d", "/c", "/b", "/a", "/a"} {
+		if err := f.service.Track(ctx, domainID, &domain.TrackRequest{Path: path}, testIP, testUserAgent); err != nil {
+			t.Fatalf("Track: %v", err)
+		}
+	}
+
+	got, err := stats.GetRealtimeStats(ctx, f.owner(t, domainID), domainID)
+	if err != nil {
+		t.Fatalf("GetRealtimeStats: %v", err)
+	}
+	if len(got.TopPages) != 10 {
+		t.Fatalf("got %d top pages, want 10", len(got.TopPages))
+	}
+	// Redis cuts the tie at the limit by path descending, so /b misses out
+	want := []string{"/a", "/c", "/d", "/e", "/f", "/g", "/h", "/i", "/j", "/k"}
+	for i, path := range want {
+		if got.TopPages[i].Path != path {
+			t.Errorf("top pages[%d] = %s, want %s", i, got.TopPages[i].Path, path)
+		}
+	}
+	if len(got.TopReferrers) != 0 {
+		t.Errorf("top referrers = %+v, want none for direct hits", got.TopReferrers)
+	}
+}
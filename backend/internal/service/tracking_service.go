@@ -2,7 +2,11 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/nesohq/backend/internal/domain"
@@ -14,31 +18,64 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrTrackingDropped is returned by Track when the domain's privacy policy
+// discards the hit.
+var ErrTrackingDropped = errors.New("tracking dropped by privacy policy")
+
+// ErrRateLimited is returned by Track when the domain has already had its
+// settings' RateLimit of hits this minute.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
 type TrackingService struct {
-	eventRepo *repository.EventRepository
-	cache     *cache.RedisCache
-	queue     *queue.NATSQueue
+	domainRepo repository.DomainStore
+	cache      cache.Cache
+	queue      queue.Publisher
+	uniques    *UniqueVisitorService
+
+	// How long an idle domain's active visitor set is kept
+	activeTTL time.Duration
 }
 
 func NewTrackingService(
-	eventRepo *repository.EventRepository,
-	cache *cache.RedisCache,
-	queue *queue.NATSQueue,
+	domainRepo repository.DomainStore,
+	cache cache.Cache,
+	queue queue.Publisher,
+	uniques *UniqueVisitorService,
+	activeTTL time.Duration,
 ) *TrackingService {
 	return &TrackingService{
-		eventRepo: eventRepo,
-		cache:     cache,
-		queue:     queue,
+		domainRepo: domainRepo,
+		cache:      cache,
+		queue:      queue,
+		uniques:    uniques,
+		activeTTL:  activeTTL,
 	}
 }
 
 func (s *TrackingService) Track(ctx context.Context, domainID primitive.ObjectID, req *domain.TrackRequest, ip, userAgent string) error {
+	settings, err := s.domainSettings(ctx, domainID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkRateLimit(ctx, domainID, settings.RateLimit); err != nil {
+		return err
+	}
+
+	mode, visitorID, err := s.visitor(ctx, domainID, settings, req.Consent, req.PrivacySignal, req.VisitorID, ip, userAgent)
+	if err != nil {
+		return err
+	}
+
 	// Parse user agent
 	uaInfo := utils.ParseUserAgent(userAgent)
 
 	// Create event
+	// The id is assigned up front so a redelivered event is recognised as a
+	// duplicate instead of being inserted twice
 	event := &domain.Event{
+		ID:        primitive.NewObjectID(),
 		DomainID:  domainID,
+		Timestamp: time.Now(),
 		Path:      req.Path,
 		Referrer:  req.Referrer,
 		UserAgent: userAgent,
@@ -46,134 +83,359 @@ func (s *TrackingService) Track(ctx context.Context, domainID primitive.ObjectID
 		Browser:   uaInfo.Browser,
 		Device:    uaInfo.Device,
 		Country:   "Unknown", // TODO: Add GeoIP
-		VisitorID: req.VisitorID,
+		VisitorID: visitorID,
 	}
 
-	// Publish to queue for async processing
-	if err := s.queue.Publish("events", event); err != nil {
-		return err
+	// Anonymous hits keep only coarse, non-identifying fields
+	if mode == domain.PrivacyPolicyAnonymous {
+		event.UserAgent = ""
+		event.IPHash = ""
 	}
 
-	// Mark visitor as active using Sorted Set (score = timestamp)
-	activeKey := fmt.Sprintf("active_visitors:%s", domainID.Hex())
-	now := float64(time.Now().Unix())
-	if err := s.cache.ZAdd(ctx, activeKey, redis.Z{Score: now, Member: req.VisitorID}); err != nil {
+	// Publish to queue for async processing
+	if err := s.queue.Publish(ctx, queue.SubjectEvents, event); err != nil {
 		return err
 	}
 
-	// Set expiration on the set itself to auto-clean if abandoned (e.g. 1 hour)
-	if err := s.cache.Expire(ctx, activeKey, 1*time.Hour); err != nil {
+	// Redis cannot encode the event itself
+	update, err := json.Marshal(event)
+	if err != nil {
 		return err
 	}
+	var live []byte
+	if event.VisitorID != "" {
+		// Remember where the visitor is for the live view
+		live, err = json.Marshal(domain.LiveVisitor{
+			VisitorID: event.VisitorID,
+			Path:      event.Path,
+			Referrer:  event.Referrer,
+			Country:   event.Country,
+			Device:    event.Device,
+			LastSeen:  event.Timestamp,
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	// Publish real-time update
-	s.cache.Publish(ctx, fmt.Sprintf("realtime:%s", domainID.Hex()), event)
+	// Everything the hit changes in Redis goes in one round trip
+	return s.cache.Pipelined(ctx, func(pipe cache.Pipe) {
+		countHit(pipe, event)
 
-	return nil
+		// Without a visitor id there is nobody to mark as active
+		if event.VisitorID != "" {
+			s.uniques.record(pipe, domainID, event.VisitorID, event.Timestamp)
+
+			// Mark visitor as active using Sorted Set (score = timestamp),
+			// expiring the set itself to auto-clean if abandoned
+			activeKey := fmt.Sprintf("active_visitors:%s", domainID.Hex())
+			pipe.ZAdd(activeKey, redis.Z{Score: float64(time.Now().Unix()), Member: event.VisitorID})
+			pipe.Expire(activeKey, s.activeTTL)
+
+			// The key outlives the active window so it is gone once the
+			// visitor is long inactive
+			pipe.Set(liveVisitorKey(domainID, event.VisitorID), live, s.activeTTL)
+		}
+
+		// Publish real-time update
+		pipe.Publish(fmt.Sprintf("realtime:%s", domainID.Hex()), update)
+	})
 }
 
-func (s *TrackingService) GetRealtimeStats(ctx context.Context, domainID primitive.ObjectID) (*domain.RealtimeStats, error) {
-	// Get active visitors count
-	// Get active visitors count (last 5 minutes)
-	activeKey := fmt.Sprintf("active_visitors:%s", domainID.Hex())
-	fiveMinutesAgo := fmt.Sprintf("%d", time.Now().Add(-5*time.Minute).Unix())
+// countHit adds the event to its minute's realtime counters: the number of
+// hits and, per breakdown, the hits for each page, referrer, country, device
+// and browser. It also counts the hit for its hour, which pageview drop
+// alerts compare against on the following days.
+func countHit(pipe cache.Pipe, event *domain.Event) {
+	minute := event.Timestamp.Truncate(time.Minute)
 
-	// Remove old visitors
-	if err := s.cache.ZRemRangeByScore(ctx, activeKey, "-inf", fiveMinutesAgo); err != nil {
-		return nil, err
+	hitsKey := realtimeHitsKey(event.DomainID, minute)
+	pipe.Incr(hitsKey)
+	pipe.Expire(hitsKey, realtimeTTL)
+
+	hourlyKey := hourlyHitsKey(event.DomainID, event.Timestamp.Truncate(time.Hour))
+	pipe.Incr(hourlyKey)
+	pipe.Expire(hourlyKey, hourlyHitsTTL)
+
+	breakdowns := []struct{ name, value string }{
+		{"pages", event.Path},
+		{"referrers", event.Referrer},
+		{"countries", event.Country},
+		{"devices", event.Device},
+		{"browsers", event.Browser},
+	}
+	for _, breakdown := range breakdowns {
+		// Direct visits have no referrer to count
+		if breakdown.value == "" {
+			continue
+		}
+		key := realtimeBreakdownKey(event.DomainID, breakdown.name, minute)
+		pipe.ZIncrBy(key, 1, breakdown.value)
+		pipe.Expire(key, realtimeTTL)
 	}
+}
 
-	// Count active
-	count, err := s.cache.ZCard(ctx, activeKey)
+func (s *TrackingService) TrackError(ctx context.Context, domainID primitive.ObjectID, req *domain.TrackErrorRequest, ip, userAgent string) error {
+	settings, err := s.domainSettings(ctx, domainID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	activeVisitors := int(count)
-
-	// Get active visitor IDs (top 20)
-	activeIDs, err := s.cache.ZRevRange(ctx, activeKey, 0, 19)
+	_, visitorID, err := s.visitor(ctx, domainID, settings, req.Consent, req.PrivacySignal, req.VisitorID, ip, userAgent)
 	if err != nil {
-		// Log error but continue
-		fmt.Printf("Error getting active visitor IDs: %v\n", err)
-		activeIDs = []string{}
+		return err
 	}
 
-	// Get recent events
-	events, err := s.eventRepo.GetRecentEvents(ctx, domainID, 60)
-	if err != nil {
-		return nil, err
+	uaInfo := utils.ParseUserAgent(userAgent)
+
+	// As for page views, the id and time are fixed before publishing so a
+	// redelivered error is stored once
+	event := &domain.ErrorEvent{
+		ID:          primitive.NewObjectID(),
+		DomainID:    domainID,
+		Timestamp:   time.Now(),
+		Fingerprint: utils.FingerprintError(req.Message, req.Source, req.Stack),
+		Message:     req.Message,
+		Source:      req.Source,
+		Line:        req.Line,
+		Column:      req.Column,
+		Stack:       req.Stack,
+		Path:        req.Path,
+		Browser:     uaInfo.Browser,
+		VisitorID:   visitorID,
 	}
 
-	// Aggregate stats
-	stats := &domain.RealtimeStats{
-		ActiveVisitors:   activeVisitors,
-		ActiveVisitorIDs: activeIDs,
-		HitsPerMinute:    []domain.HitsPerMinute{},
-		TopPages:         []domain.PageStats{},
-		TopReferrers:     []domain.ReferrerStats{},
-		Countries:        make(map[string]int),
-		Devices:          make(map[string]int),
-		Browsers:         make(map[string]int),
+	// Persisted asynchronously by the error worker, like page views
+	if err := s.queue.Publish(ctx, queue.SubjectErrors, event); err != nil {
+		return err
 	}
 
-	// Aggregate data
-	pageHits := make(map[string]int)
-	referrerHits := make(map[string]int)
+	// Counted per minute for error alerts
+	errorsKey := realtimeErrorsKey(domainID, time.Now().Truncate(time.Minute))
+	return s.cache.Pipelined(ctx, func(pipe cache.Pipe) {
+		pipe.Incr(errorsKey)
+		pipe.Expire(errorsKey, realtimeTTL)
+	})
+}
+
+func (s *TrackingService) TrackPurchase(ctx context.Context, domainID primitive.ObjectID, req *domain.TrackPurchaseRequest, ip, userAgent string) error {
+	settings, err := s.domainSettings(ctx, domainID)
+	if err != nil {
+		return err
+	}
+	_, visitorID, err := s.visitor(ctx, domainID, settings, req.Consent, req.PrivacySignal, req.VisitorID, ip, userAgent)
+	if err != nil {
+		return err
+	}
 
-	for _, event := range events {
-		pageHits[event.Path]++
-		if event.Referrer != "" {
-			referrerHits[event.Referrer]++
+	total := req.Total
+	if total == 0 {
+		for _, item := range req.Items {
+			total += item.Price * float64(item.Quantity)
 		}
-		stats.Countries[event.Country]++
-		stats.Devices[event.Device]++
-		stats.Browsers[event.Browser]++
 	}
 
-	// Convert to slices
-	for path, hits := range pageHits {
-		stats.TopPages = append(stats.TopPages, domain.PageStats{Path: path, Hits: hits})
+	items := req.Items
+	if items == nil {
+		items = []domain.LineItem{}
 	}
-	for referrer, hits := range referrerHits {
-		stats.TopReferrers = append(stats.TopReferrers, domain.ReferrerStats{Referrer: referrer, Hits: hits})
+
+	purchase := &domain.Purchase{
+		ID:          primitive.NewObjectID(),
+		DomainID:    domainID,
+		OrderID:     req.OrderID,
+		Currency:    strings.ToUpper(req.Currency),
+		Total:       total,
+		Items:       items,
+		VisitorID:   visitorID,
+		Source:      trafficSource(req.Source, req.Referrer),
+		Campaign:    valueOr(req.Campaign, "(none)"),
+		LandingPage: valueOr(req.LandingPage, "(unknown)"),
+		Timestamp:   time.Now(),
 	}
 
-	return stats, nil
+	return s.queue.Publish(ctx, queue.SubjectPurchases, purchase)
 }
 
-func (s *TrackingService) GetOverviewStats(ctx context.Context, domainID primitive.ObjectID) (*domain.OverviewStats, error) {
-	totalHits, err := s.eventRepo.CountTotal(ctx, domainID)
-	if err != nil {
+// domainSettings returns the domain's settings, read from Redis when a recent
+// hit has already loaded them so most hits do not query the domain store.
+// DomainService drops the cached copy when the domain changes.
+func (s *TrackingService) domainSettings(ctx context.Context, domainID primitive.ObjectID) (*domain.DomainSettings, error) {
+	key := domainSettingsKey(domainID)
+	var settings domain.DomainSettings
+	cached, err := s.cache.Get(ctx, key)
+	if err == nil && json.Unmarshal([]byte(cached), &settings) == nil {
+		return &settings, nil
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
 		return nil, err
 	}
 
-	since := time.Now().Add(-24 * time.Hour)
-	uniqueVisitors, err := s.eventRepo.CountUnique(ctx, domainID, since)
+	d, err := s.domainRepo.FindByID(ctx, domainID)
 	if err != nil {
 		return nil, err
 	}
+	data, err := json.Marshal(d.Settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.Set(ctx, key, data, domainSettingsTTL); err != nil {
+		return nil, err
+	}
+	return &d.Settings, nil
+}
 
-	return &domain.OverviewStats{
-		TotalHits:      totalHits,
-		UniqueVisitors: uniqueVisitors,
-		AvgSessionTime: 0, // TODO: Calculate
-		BounceRate:     0, // TODO: Calculate
-	}, nil
+// checkRateLimit counts the hit against the domain's limit for the current
+// minute and returns ErrRateLimited once it is over. A limit of zero means
+// unlimited. The counter lives in the cache, so replicas share it and lite
+// mode keeps it in memory.
+func (s *TrackingService) checkRateLimit(ctx context.Context, domainID primitive.ObjectID, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf("rate_limit:%s:%s", domainID.Hex(), time.Now().UTC().Format("200601021504"))
+	hits, err := s.cache.Incr(ctx, key)
+	if err != nil {
+		return err
+	}
+	if hits == 1 {
+		// Only the minute's first hit needs to set the expiry
+		if err := s.cache.Expire(ctx, key, 2*time.Minute); err != nil {
+			return err
+		}
+	}
+	if hits > int64(limit) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// visitor applies the domain's privacy settings to a hit of any kind. It
+// returns the tracking mode and the visitor id to store: none for anonymous
+// hits, and one derived from the IP address and user agent on cookieless
+// domains. Hits the policy drops return ErrTrackingDropped.
+func (s *TrackingService) visitor(ctx context.Context, domainID primitive.ObjectID, settings *domain.DomainSettings, consent *bool, privacySignal bool, visitorID, ip, userAgent string) (string, string, error) {
+	mode := trackingMode(*settings, consent, privacySignal)
+	switch {
+	case mode == domain.PrivacyPolicyDrop:
+		return mode, "", ErrTrackingDropped
+	case mode == domain.PrivacyPolicyAnonymous:
+		return mode, "", nil
+	case settings.Cookieless:
+		salt, err := s.dailySalt(ctx)
+		if err != nil {
+			return mode, "", err
+		}
+		return mode, utils.CookielessVisitorID(salt, domainID.Hex(), ip, userAgent), nil
+	}
+	return mode, visitorID, nil
 }
 
-func (s *TrackingService) GetActiveVisitorCount(ctx context.Context, domainID primitive.ObjectID) (int, error) {
-	activeKey := fmt.Sprintf("active_visitors:%s", domainID.Hex())
-	fiveMinutesAgo := fmt.Sprintf("%d", time.Now().Add(-5*time.Minute).Unix())
+// trackingMode resolves how a hit may be tracked. Withheld consent downgrades
+// to anonymous tracking, and DNT/GPC signals apply the domain's policy; the
+// strictest outcome wins. Domains created before the policy existed have an
+// empty value and keep tracking normally.
+func trackingMode(settings domain.DomainSettings, consent *bool, privacySignal bool) string {
+	mode := domain.PrivacyPolicyTrack
+	if consent != nil && !*consent {
+		mode = domain.PrivacyPolicyAnonymous
+	}
 
-	// Remove old visitors
-	if err := s.cache.ZRemRangeByScore(ctx, activeKey, "-inf", fiveMinutesAgo); err != nil {
-		return 0, err
+	if privacySignal {
+		switch settings.PrivacySignalPolicy {
+		case domain.PrivacyPolicyDrop:
+			return domain.PrivacyPolicyDrop
+		case domain.PrivacyPolicyAnonymous:
+			mode = domain.PrivacyPolicyAnonymous
+		}
 	}
+	return mode
+}
 
-	// Count active
-	count, err := s.cache.ZCard(ctx, activeKey)
+// dailySalt returns the salt for the current UTC day, creating it on first use.
+// The key expires after 24 hours so yesterday's salt is gone for good and
+// cookieless visitor ids cannot be linked across days.
+func (s *TrackingService) dailySalt(ctx context.Context) (string, error) {
+	saltKey := fmt.Sprintf("visitor_salt:%s", time.Now().UTC().Format("2006-01-02"))
+
+	salt, err := utils.GenerateSalt()
 	if err != nil {
-		return 0, err
+		return "", err
+	}
+
+	// Only the first writer of the day wins; everyone else reads its salt
+	if _, err := s.cache.SetNX(ctx, saltKey, salt, 24*time.Hour); err != nil {
+		return "", err
+	}
+	return s.cache.Get(ctx, saltKey)
+}
+
+// domainSettingsTTL bounds how long a hit may see settings from before an
+// update that failed to drop the cached copy.
+const domainSettingsTTL = time.Minute
+
+// domainSettingsKey names the cached copy of a domain's settings.
+func domainSettingsKey(domainID primitive.ObjectID) string {
+	return fmt.Sprintf("domain_settings:%s", domainID.Hex())
+}
+
+func liveVisitorKey(domainID primitive.ObjectID, visitorID string) string {
+	return fmt.Sprintf("live_visitor:%s:%s", domainID.Hex(), visitorID)
+}
+
+// realtimeMinutes is how many minutes, up to and including the current one,
+// the realtime stats cover.
+const realtimeMinutes = 60
+
+// realtimeTTL keeps a minute's counters until the minute has left the
+// realtime window.
+const realtimeTTL = (realtimeMinutes + 1) * time.Minute
+
+// realtimeHitsKey names the hit counter for the minute starting at minute.
+func realtimeHitsKey(domainID primitive.ObjectID, minute time.Time) string {
+	return fmt.Sprintf("hits:%s:%s", domainID.Hex(), minute.UTC().Format("200601021504"))
+}
+
+// hourlyHitsTTL keeps an hour's counter for as long as pageview drop alerts
+// look back.
+const hourlyHitsTTL = (alertBaselineDays + 1) * 24 * time.Hour
+
+// hourlyHitsKey names the hit counter for the hour starting at hour.
+func hourlyHitsKey(domainID primitive.ObjectID, hour time.Time) string {
+	return fmt.Sprintf("hourly_hits:%s:%s", domainID.Hex(), hour.UTC().Format("2006010215"))
+}
+
+// realtimeErrorsKey names the error event counter for the minute starting at
+// minute.
+func realtimeErrorsKey(domainID primitive.ObjectID, minute time.Time) string {
+	return fmt.Sprintf("errors:%s:%s", domainID.Hex(), minute.UTC().Format("200601021504"))
+}
+
+// realtimeBreakdownKey names the sorted set counting hits per value of a
+// breakdown, such as "pages", for the minute starting at minute.
+func realtimeBreakdownKey(domainID primitive.ObjectID, breakdown string, minute time.Time) string {
+	return fmt.Sprintf("hits_%s:%s:%s", breakdown, domainID.Hex(), minute.UTC().Format("200601021504"))
+}
+
+// trafficSource prefers an explicit source (e.g. utm_source) and otherwise
+// falls back to the referring host.
+func trafficSource(source, referrer string) string {
+	if source != "" {
+		return source
+	}
+	if referrer == "" {
+		return "(direct)"
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return referrer
+	}
+	return strings.TrimPrefix(u.Host, "www.")
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
 	}
-	return int(count), nil
+	return value
 }
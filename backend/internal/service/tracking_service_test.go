@@ -0,0 +1,534 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/infrastructure/queue"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"github.com/nesohq/backend/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	testIP        = "203.0.113.7"
+	testUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+)
+
+type trackingFixture struct {
+	service *service.TrackingService
+	domains *memory.DomainRepository
+	cache   *cache.MemoryCache
+	queue   *queue.MemoryQueue
+}
+
+func newTrackingFixture(t *testing.T) *trackingFixture {
+	t.Helper()
+	f := &trackingFixture{
+		domains: memory.NewDomainRepository(),
+		cache:   cache.NewMemoryCache(),
+		queue:   queue.NewMemoryQueue(),
+	}
+	uniques := service.NewUniqueVisitorService(f.cache, memory.NewRollupRepository())
+	f.service = service.NewTrackingService(f.domains, f.cache, f.queue, uniques, time.Hour)
+	return f
+}
+
+func (f *trackingFixture) addDomain(t *testing.T, settings domain.DomainSettings) primitive.ObjectID {
+	t.Helper()
+	d := &domain.Domain{UserID: primitive.NewObjectID(), Domain: "example.com", Settings: settings}
+	if err := f.domains.Create(context.Background(), d); err != nil {
+		t.Fatalf("creating domain: %v", err)
+	}
+	return d.ID
+}
+
+func (f *trackingFixture) owner(t *testing.T, domainID primitive.ObjectID) primitive.ObjectID {
+	t.Helper()
+	d, err := f.domains.FindByID(context.Background(), domainID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	return d.UserID
+}
+
+// events decodes everything published on the events subject.
+func (f *trackingFixture) events(t *testing.T) []domain.Event {
+	t.Helper()
+	var events []domain.Event
+	for _, msg := range f.queue.Messages(queue.SubjectEvents) {
+		var event domain.Event
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			t.Fatalf("decoding published event: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func (f *trackingFixture) activeVisitors(t *testing.T, domainID primitive.ObjectID) []string {
+	t.Helper()
+	ids, err := f.cache.ZRevRange(context.Background(), fmt.Sprintf("active_visitors:%s", domainID.Hex()), 0, -1)
+	if err != nil {
+		t.Fatalf("reading active visitors: %v", err)
+	}
+	return ids
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestTrackPublishesEventAndMarksVisitorActive(t *testing.T) {
+	f := newTrackingFixture(t)
+	domainID := f.addDomain(t, domain.DomainSettings{PrivacySignalPolicy: domain.PrivacyPolicyTrack})
+
+	req := &domain.TrackRequest{Path: "/pricing", Referrer: "https://news.example.org/", VisitorID: "v1"}
+	if err := f.service.Track(context.Background(), domainID, req, testIP, testUserAgent); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+
+	events := f.events(t)
+	if len(events) != 1 {
+		t.Fatalf("published %d events, want 1", len(events))
+	}
+	event := events[0]
+	if event.ID.IsZero() {
+		t.Error("event has no id; redeliveries could not be de-duplicated")
+	}
+	if event.DomainID != domainID || event.Path != "/pricing" || event.Referrer != "https://news.example.org/" {
+		t.Errorf("event = %+v, want the request's domain, path and referrer", event)
+	}
+	if event.VisitorID != "v1" {
+		t.Errorf("VisitorID = %q, want the client's id", event.VisitorID)
+	}
+	if event.IPHash != utils.HashIP(testIP) || event.IPHash == testIP {
+		t.Errorf("IPHash = %q, want the hash of the client IP", event.IPHash)
+	}
+	if event.Browser != "Chrome" || event.UserAgent != testUserAgent {
+		t.Errorf("Browser = %q, UserAgent = %q, want the parsed user agent", event.Browser, event.UserAgent)
+	}
+
+	if got := f.activeVisitors(t, domainID); len(got) != 1 || got[0] != "v1" {
+		t.Errorf("active visitors = %v, want [v1]", got)
+	}
+	ttl, ok := f.cache.TTL(fmt.Sprintf("active_visitors:%s", domainID.Hex()))
+	if !ok || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("active visitor set TTL = %v (set %v), want the configured hour", ttl, ok)
+	}
+}
+
+// pipelineOnlyCache lets Track use nothing but Pipelined; any other call
+// panics on the nil Cache it embeds.
+type pipelineOnlyCache struct {
+	cache.Cache
+	memory    *cache.MemoryCache
+	gets      int
+	pipelines int
+}
+
+func (c *pipelineOnlyCache) Get(ctx context.Context, key string) (string, error) {
+	c.gets++
+	return c.memory.Get(ctx, key)
+}
+
+func (c *pipelineOnlyCache) Pipelined(ctx context.Context, fn func(cache.Pipe)) error {
+	c.pipelines++
+	return c.memory.Pipelined(ctx, fn)
+}
+
+func TestTrackWritesToRedisInOneRoundTrip(t *testing.T) {
+	f := newTrackingFixture(t)
+	domainID := f.addDomain(t, domain.DomainSettings{})
+	redisCache := &pipelineOnlyCache{memory: f.cache}
+	tracking := service.NewTrackingService(f.domains, redisCache, f.queue,
+		service.NewUniqueVisitorService(redisCache, memory.NewRollupRepository()), time.Hour)
+
+	// An earlier hit has cached the domain's settings
+	req := &domain.TrackRequest{Path: "/pricing", Referrer: "https://news.example.org/", VisitorID: "v1"}
+	if err := f.service.Track(context.Background(), domainID, req, testIP, testUserAgent); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+
+	if err := tracking.Track(context.Background(), domainID, req, testIP, testUserAgent); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	if redisCache.gets != 1 || redisCache.pipelines != 1 {
+		t.Errorf("Track sent %d gets and %d pipelines, want 1 of each", redisCache.gets, redisCache.pipelines)
+	}
+	if got := f.activeVisitors(t, domainID); len(got) != 1 || got[0] != "v1" {
+		t.Errorf("active visitors = %v, want [v1]", got)
+	}
+
+	published := f.cache.Published(fmt.Sprintf("realtime:%s", domainID.Hex()))
+	if len(published) != 2 {
+		t.Fatalf("published %d realtime updates, want 2", len(published))
+	}
+	var update domain.Event
+	if err := json.Unmarshal([]byte(published[1]), &update); err != nil || update.Path != "/pricing" {
+		t.Errorf("realtime update = %s (%v), want the event as JSON", published[1], err)
+	}
+}
+
+func TestTrackPrivacy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        string
+		consent       *bool
+		privacySignal bool
+		wantDropped   bool
+		wantAnonymous bool
+	}{
+		{name: "no signal", policy: domain.PrivacyPolicyDrop},
+		{name: "consent given", policy: domain.PrivacyPolicyTrack, consent: boolPtr(true)},
+		{name: "consent withheld", policy: domain.PrivacyPolicyTrack, consent: boolPtr(false), wantAnonymous: true},
+		{name: "signal with track policy", policy: domain.PrivacyPolicyTrack, privacySignal: true},
+		{name: "signal with anonymous policy", policy: domain.PrivacyPolicyAnonymous, privacySignal: true, wantAnonymous: true},
+		{name: "signal with drop policy", policy: domain.PrivacyPolicyDrop, privacySignal: true, wantDropped: true},
+		{name: "signal with legacy empty policy", policy: "", privacySignal: true},
+		{name: "drop beats withheld consent", policy: domain.PrivacyPolicyDrop, consent: boolPtr(false), privacySignal: true, wantDropped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTrackingFixture(t)
+			domainID := f.addDomain(t, domain.DomainSettings{PrivacySignalPolicy: tt.policy})
+
+			req := &domain.TrackRequest{Path: "/", VisitorID: "v1", Consent: tt.consent, PrivacySignal: tt.privacySignal}
+			err := f.service.Track(context.Background(), domainID, req, testIP, testUserAgent)
+
+			if tt.wantDropped {
+				if !errors.Is(err, service.ErrTrackingDropped) {
+					t.Fatalf("Track error = %v, want ErrTrackingDropped", err)
+				}
+				if n := len(f.events(t)); n != 0 {
+					t.Errorf("published %d events for a dropped hit", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Track: %v", err)
+			}
+
+			events := f.events(t)
+			if len(events) != 1 {
+				t.Fatalf("published %d events, want 1", len(events))
+			}
+			anonymous := events[0].VisitorID == "" && events[0].IPHash == "" && events[0].UserAgent == ""
+			if anonymous != tt.wantAnonymous {
+				t.Errorf("event = %+v, anonymous = %v, want %v", events[0], anonymous, tt.wantAnonymous)
+			}
+			if tt.wantAnonymous && len(f.activeVisitors(t, domainID)) != 0 {
+				t.Error("anonymous hit marked a visitor as active")
+			}
+		})
+	}
+}
+
+func TestTrackCookielessDerivesStableVisitorID(t *testing.T) {
+	f := newTrackingFixture(t)
+	domainID := f.addDomain(t, domain.DomainSettings{Cookieless: true})
+
+	for _, clientID := range []string{"client-a", "client-b"} {
+		req := &domain.TrackRequest{Path: "/", VisitorID: clientID}
+		if err := f.service.Track(context.Background(), domainID, req, testIP, testUserAgent); err != nil {
+			t.Fatalf("Track: %v", err)
+		}
+	}
+	other := &domain.TrackRequest{Path: "/"}
+	if err := f.service.Track(context.Background(), domainID, other, "198.51.100.1", testUserAgent); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+
+	events := f.events(t)
+	if len(events) != 3 {
+		t.Fatalf("published %d events, want 3", len(events))
+	}
+	first, second, third := events[0].VisitorID, events[1].VisitorID, events[2].VisitorID
+	if first == "client-a" || first == "" {
+		t.Errorf("VisitorID = %q, want a server-derived id", first)
+	}
+	if first != second {
+		t.Errorf("same visitor got ids %q and %q on the same day", first, second)
+	}
+	if third == first {
+		t.Error("different IPs were given the same visitor id")
+	}
+}
+
+func TestTrackUnknownDomain(t *testing.T) {
+	f := newTrackingFixture(t)
+
+	err := f.service.Track(context.Background(), primitive.NewObjectID(), &domain.TrackRequest{Path: "/"}, testIP, testUserAgent)
+	if err == nil {
+		t.Fatal("Track succeeded for a domain that does not exist")
+	}
+	if n := len(f.events(t)); n != 0 {
+		t.Errorf("published %d events", n)
+	}
+}
+
+func TestTrackSeesDomainUpdatesImmediately(t *testing.T) {
+	f := newTrackingFixture(t)
+	ctx := context.Background()
+	users := memory.NewUserRepository()
+	user := &domain.User{Email: "owner@example.com", Plan: domain.PlanFree}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	domains := service.NewDomainService(f.domains, users, f.cache)
+	d, err := domains.Create(ctx, user.ID, &domain.CreateDomainRequest{Domain: "example.com"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	req := &domain.TrackRequest{Path: "/", VisitorID: "v1", PrivacySignal: true}
+	if err := f.service.Track(ctx, d.ID, req, testIP, testUserAgent); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+
+	settings := d.Settings
+	settings.PrivacySignalPolicy = domain.PrivacyPolicyDrop
+	if _, err := domains.Update(ctx, d.ID, &domain.UpdateDomainRequest{Settings: settings}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := f.service.Track(ctx, d.ID, req, testIP, testUserAgent); !errors.Is(err, service.ErrTrackingDropped) {
+		t.Errorf("Track after the update: error = %v, want ErrTrackingDropped", err)
+	}
+
+	if err := domains.Delete(ctx, d.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := f.service.Track(ctx, d.ID, &domain.TrackRequest{Path: "/"}, testIP, testUserAgent); err == nil {
+		t.Error("Track succeeded for a deleted domain")
+	}
+}
+
+func TestTrackRateLimit(t *testing.T) {
+	f := newTrackingFixture(t)
+	limited := f.addDomain(t, domain.DomainSettings{RateLimit: 2})
+	unlimited := f.addDomain(t, domain.DomainSettings{})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := f.service.Track(ctx, limited, &domain.TrackRequest{Path: "/"}, testIP, testUserAgent); err != nil {
+			t.Fatalf("Track %d: %v", i+1, err)
+		}
+	}
+	if err := f.service.Track(ctx, limited, &domain.TrackRequest{Path: "/"}, testIP, testUserAgent); !errors.Is(err, service.ErrRateLimited) {
+		t.Errorf("third Track in a minute: error = %v, want ErrRateLimited", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := f.service.Track(ctx, unlimited, &domain.TrackRequest{Path: "/"}, testIP, testUserAgent); err != nil {
+			t.Fatalf("Track without a limit: %v", err)
+		}
+	}
+	if n := len(f.events(t)); n != 5 {
+		t.Errorf("published %d events, want 2 limited + 3 unlimited", n)
+	}
+}
+
+func TestTrackQueueFailure(t *testing.T) {
+	f := newTrackingFixture(t)
+	domainID := f.addDomain(t, domain.DomainSettings{})
+	f.queue.FailWith(errors.New("nats: no responders"))
+
+	err := f.service.Track(context.Background(), domainID, &domain.TrackRequest{Path: "/", VisitorID: "v1"}, testIP, testUserAgent)
+	if err == nil {
+		t.Fatal("Track succeeded although the event could not be queued")
+	}
+	if got := f.activeVisitors(t, domainID); len(got) != 0 {
+		t.Errorf("active visitors = %v for a hit that was never queued", got)
+	}
+}
+
+func TestTrackError(t *testing.T) {
+	f := newTrackingFixture(t)
+	domainID := f.addDomain(t, domain.DomainSettings{})
+
+	req := &domain.TrackErrorRequest{
+		Message:   "TypeError: x is undefined",
+		Source:    "https://example.com/app.js",
+		Line:      10,
+		Column:    4,
+		Stack:     "at f (app.js:10:4)",
+		VisitorID: "v1",
+	}
+	if err := f.service.TrackError(context.Background(), domainID, req, testIP, testUserAgent); err != nil {
+		t.Fatalf("TrackError: %v", err)
+	}
+
+	messages := f.queue.Messages(queue.SubjectErrors)
+	if len(messages) != 1 {
+		t.Fatalf("published %d errors, want 1", len(messages))
+	}
+	var event domain.ErrorEvent
+	if err := json.Unmarshal(messages[0].Data, &event); err != nil {
+		t.Fatal(err)
+	}
+	if want := utils.FingerprintError(req.Message, req.Source, req.Stack); event.Fingerprint != want {
+		t.Errorf("Fingerprint = %q, want %q", event.Fingerprint, want)
+	}
+	if event.DomainID != domainID || event.Browser != "Chrome" || event.Line != 10 {
+		t.Errorf("event = %+v", event)
+	}
+	if event.ID.IsZero() || event.Timestamp.IsZero() {
+		t.Errorf("event published without an id and time: %+v", event)
+	}
+}
+
+func TestTrackPurchase(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          domain.TrackPurchaseRequest
+		wantTotal    float64
+		wantSource   string
+		wantCampaign string
+		wantLanding  string
+	}{
+		{
+			name: "total from items and source from referrer",
+			req: domain.TrackPurchaseRequest{
+				OrderID:  "o1",
+				Currency: "usd",
+				Items: []domain.LineItem{
+					{SKU: "a", Quantity: 2, Price: 10},
+					{SKU: "b", Quantity: 1, Price: 5.5},
+				},
+				Referrer: "https://www.google.com/search?q=x",
+			},
+			wantTotal:    25.5,
+			wantSource:   "google.com",
+			wantCampaign: "(none)",
+			wantLanding:  "(unknown)",
+		},
+		{
+			name: "explicit total and attribution",
+			req: domain.TrackPurchaseRequest{
+				OrderID:     "o2",
+				Currency:    "EUR",
+				Total:       99,
+				Source:      "newsletter",
+				Campaign:    "spring",
+				LandingPage: "/sale",
+			},
+			wantTotal:    99,
+			wantSource:   "newsletter",
+			wantCampaign: "spring",
+			wantLanding:  "/sale",
+		},
+		{
+			name:         "direct traffic",
+			req:          domain.TrackPurchaseRequest{OrderID: "o3", Currency: "GBP", Total: 1},
+			wantTotal:    1,
+			wantSource:   "(direct)",
+			wantCampaign: "(none)",
+			wantLanding:  "(unknown)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTrackingFixture(t)
+			domainID := f.addDomain(t, domain.DomainSettings{})
+			if err := f.service.TrackPurchase(context.Background(), domainID, &tt.req, testIP, testUserAgent); err != nil {
+				t.Fatalf("TrackPurchase: %v", err)
+			}
+
+			messages := f.queue.Messages(queue.SubjectPurchases)
+			if len(messages) != 1 {
+				t.Fatalf("published %d purchases, want 1", len(messages))
+			}
+			var purchase domain.Purchase
+			if err := json.Unmarshal(messages[0].Data, &purchase); err != nil {
+				t.Fatal(err)
+			}
+			if purchase.Total != tt.wantTotal {
+				t.Errorf("Total = %v, want %v", purchase.Total, tt.wantTotal)
+			}
+			if purchase.Currency != "USD" && purchase.Currency != "EUR" && purchase.Currency != "GBP" {
+				t.Errorf("Currency = %q, want upper case", purchase.Currency)
+			}
+			if purchase.Source != tt.wantSource || purchase.Campaign != tt.wantCampaign || purchase.LandingPage != tt.wantLanding {
+				t.Errorf("attribution = %q/%q/%q, want %q/%q/%q",
+					purchase.Source, purchase.Campaign, purchase.LandingPage, tt.wantSource, tt.wantCampaign, tt.wantLanding)
+			}
+			if purchase.Items == nil {
+				t.Error("Items is null; the dashboard expects a list")
+			}
+			if purchase.ID.IsZero() || purchase.Timestamp.IsZero() {
+				t.Errorf("id = %v, timestamp = %v, want both set when tracked", purchase.ID, purchase.Timestamp)
+			}
+		})
+	}
+}
+
+func TestErrorsAndPurchasesFollowPrivacySettings(t *testing.T) {
+	tests := []struct {
+		name          string
+		settings      domain.DomainSettings
+		consent       *bool
+		privacySignal bool
+		wantDropped   bool
+		wantVisitor   string
+	}{
+		{name: "tracked", settings: domain.DomainSettings{PrivacySignalPolicy: domain.PrivacyPolicyDrop}, wantVisitor: "v1"},
+		{name: "consent withheld", consent: boolPtr(false)},
+		{name: "signal with anonymous policy", settings: domain.DomainSettings{PrivacySignalPolicy: domain.PrivacyPolicyAnonymous}, privacySignal: true},
+		{name: "signal with drop policy", settings: domain.DomainSettings{PrivacySignalPolicy: domain.PrivacyPolicyDrop}, privacySignal: true, wantDropped: true},
+		{name: "cookieless", settings: domain.DomainSettings{Cookieless: true}, wantVisitor: "cookieless"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTrackingFixture(t)
+			ctx := context.Background()
+			domainID := f.addDomain(t, tt.settings)
+
+			errReq := &domain.TrackErrorRequest{Message: "boom", VisitorID: "v1", Consent: tt.consent, PrivacySignal: tt.privacySignal}
+			errErr := f.service.TrackError(ctx, domainID, errReq, testIP, testUserAgent)
+			purchaseReq := &domain.TrackPurchaseRequest{OrderID: "o1", Currency: "EUR", Total: 1, VisitorID: "v1", Consent: tt.consent, PrivacySignal: tt.privacySignal}
+			purchaseErr := f.service.TrackPurchase(ctx, domainID, purchaseReq, testIP, testUserAgent)
+
+			if tt.wantDropped {
+				if !errors.Is(errErr, service.ErrTrackingDropped) || !errors.Is(purchaseErr, service.ErrTrackingDropped) {
+					t.Fatalf("errors = %v and %v, want ErrTrackingDropped", errErr, purchaseErr)
+				}
+				if n := len(f.queue.Messages(queue.SubjectErrors)) + len(f.queue.Messages(queue.SubjectPurchases)); n != 0 {
+					t.Errorf("published %d messages for dropped hits", n)
+				}
+				return
+			}
+			if errErr != nil || purchaseErr != nil {
+				t.Fatalf("TrackError: %v, TrackPurchase: %v", errErr, purchaseErr)
+			}
+
+			want := tt.wantVisitor
+			if want == "cookieless" {
+				// The same id page views from this visitor get today
+				if err := f.service.Track(ctx, domainID, &domain.TrackRequest{Path: "/", VisitorID: "v1"}, testIP, testUserAgent); err != nil {
+					t.Fatalf("Track: %v", err)
+				}
+				want = f.events(t)[0].VisitorID
+			}
+			var event domain.ErrorEvent
+			if err := json.Unmarshal(f.queue.Messages(queue.SubjectErrors)[0].Data, &event); err != nil {
+				t.Fatal(err)
+			}
+			var purchase domain.Purchase
+			if err := json.Unmarshal(f.queue.Messages(queue.SubjectPurchases)[0].Data, &purchase); err != nil {
+				t.Fatal(err)
+			}
+			if event.VisitorID != want || purchase.VisitorID != want {
+				t.Errorf("visitor ids = %q and %q, want %q", event.VisitorID, purchase.VisitorID, want)
+			}
+		})
+	}
+}
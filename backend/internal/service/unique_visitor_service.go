@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// uniqueHourTTL keeps an hour's HyperLogLog until the retention job has
+	// had the whole of the next day to merge it into the day's rollup
+	uniqueHourTTL = 48 * time.Hour
+
+	// sketchTTL is how long a rollup's sketch stays loaded in Redis after a
+	// count needed it
+	sketchTTL = 10 * time.Minute
+
+	// daySketchTTL bounds how long a day's merge outlives DaySketch
+	daySketchTTL = time.Minute
+
+	// uniqueMaxRange is the longest range Count will estimate
+	uniqueMaxRange = 366 * 24 * time.Hour
+)
+
+// ErrRangeTooLong is returned when a unique visitor count is asked for over
+// more than uniqueMaxRange.
+var ErrRangeTooLong = errors.New("range is longer than 366 days")
+
+// UniqueVisitorService counts distinct visitors with Redis HyperLogLogs, one
+// per domain and UTC hour. Once a day is complete its hours are merged into a
+// sketch saved with the day's rollup. Counting a range merges those sketches
+// and the hours still in Redis, so it costs the same however much traffic the
+// range saw. Counts are estimates, typically within 1%. Erasing a visitor
+// rebuilds the sketches of the days they were seen from the events left.
+type UniqueVisitorService struct {
+	cache      cache.Cache
+	rollupRepo repository.RollupStore
+}
+
+func NewUniqueVisitorService(cache cache.Cache, rollupRepo repository.RollupStore) *UniqueVisitorService {
+	return &UniqueVisitorService{
+		cache:      cache,
+		rollupRepo: rollupRepo,
+	}
+}
+
+// Record counts visitorID in the hour containing t.
+func (s *UniqueVisitorService) Record(ctx context.Context, domainID primitive.ObjectID, visitorID string, t time.Time) error {
+	return s.cache.Pipelined(ctx, func(pipe cache.Pipe) {
+		s.record(pipe, domainID, visitorID, t)
+	})
+}
+
+// record queues Record's commands on pipe, for callers batching a hit's
+// writes.
+func (s *UniqueVisitorService) record(pipe cache.Pipe, domainID primitive.ObjectID, visitorID string, t time.Time) {
+	key := uniqueHourKey(domainID, t)
+	pipe.PFAdd(key, visitorID)
+	pipe.Expire(key, uniqueHourTTL)
+}
+
+// DaySketch merges the hours of the UTC day containing day into one
+// HyperLogLog and returns it, or nil when no visitors were recorded in them
+// (or their keys have expired).
+func (s *UniqueVisitorService) DaySketch(ctx context.Context, domainID primitive.ObjectID, day time.Time) ([]byte, error) {
+	start := startOfDay(day)
+	hours := make([]string, 24)
+	for i := range hours {
+		hours[i] = uniqueHourKey(domainID, start.Add(time.Duration(i)*time.Hour))
+	}
+
+	// Each call merges into its own key, so a rollup and an erasure building
+	// the same day at once do not clear each other's merge
+	key := fmt.Sprintf("uniques:%s:day:%s:%s", domainID.Hex(), start.Format("20060102"), primitive.NewObjectID().Hex())
+	if err := s.cache.PFMerge(ctx, key, hours...); err != nil {
+		return nil, err
+	}
+	defer s.cache.Del(ctx, key)
+	// In case this process stops before deleting it
+	if err := s.cache.Expire(ctx, key, daySketchTTL); err != nil {
+		return nil, err
+	}
+
+	count, err := s.cache.PFCount(ctx, key)
+	if err != nil || count == 0 {
+		return nil, err
+	}
+	sketch, err := s.cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sketch), nil
+}
+
+// Rebuild replaces the HyperLogLogs of the UTC day containing day with ones
+// counting only visitors, the visitor IDs seen in each hour, and returns the
+// day's sketch built from them, or nil when there are none. Hours that have
+// already left Redis are not recreated. A hit recorded while its hour is
+// being replaced may be left out of it.
+func (s *UniqueVisitorService) Rebuild(ctx context.Context, domainID primitive.ObjectID, day time.Time, visitors map[time.Time][]string) ([]byte, error) {
+	start := startOfDay(day)
+	key := fmt.Sprintf("uniques:%s:day:%s:%s", domainID.Hex(), start.Format("20060102"), primitive.NewObjectID().Hex())
+	defer s.cache.Del(ctx, key)
+
+	var live []string
+	ttls := make(map[string]time.Duration)
+	for i := 0; i < 24; i++ {
+		hour := start.Add(time.Duration(i) * time.Hour)
+		// An hour's key lives uniqueHourTTL past its last hit
+		if ttl := time.Until(hour.Add(time.Hour + uniqueHourTTL)); ttl > 0 {
+			live = append(live, uniqueHourKey(domainID, hour))
+			ttls[uniqueHourKey(domainID, hour)] = ttl
+		}
+	}
+	if len(live) > 0 {
+		if err := s.cache.Del(ctx, live...); err != nil {
+			return nil, err
+		}
+	}
+
+	var seen bool
+	err := s.cache.Pipelined(ctx, func(pipe cache.Pipe) {
+		for hour, ids := range visitors {
+			if len(ids) == 0 || !startOfDay(hour).Equal(start) {
+				continue
+			}
+			elements := make([]interface{}, len(ids))
+			for i, id := range ids {
+				elements[i] = id
+			}
+			seen = true
+			pipe.PFAdd(key, elements...)
+			hourKey := uniqueHourKey(domainID, hour)
+			if ttl, ok := ttls[hourKey]; ok {
+				pipe.PFAdd(hourKey, elements...)
+				pipe.Expire(hourKey, ttl)
+			}
+		}
+		// In case this process stops before deleting it
+		pipe.Expire(key, daySketchTTL)
+	})
+	if err != nil || !seen {
+		return nil, err
+	}
+
+	sketch, err := s.cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sketch), nil
+}
+
+// Count estimates the distinct visitors in [from, to), widened to whole
+// hours. Whole days are counted from their rollup's sketch when they have
+// one and other hours from Redis; hours with neither (expired from Redis and
+// not rolled up) count no visitors. Ranges longer than 366 days are refused
+// with ErrRangeTooLong.
+func (s *UniqueVisitorService) Count(ctx context.Context, domainID primitive.ObjectID, from, to time.Time) (int64, error) {
+	if to.Sub(from) > uniqueMaxRange {
+		return 0, ErrRangeTooLong
+	}
+	from = from.UTC().Truncate(time.Hour)
+	if end := to.UTC().Truncate(time.Hour); end.Before(to) {
+		to = end.Add(time.Hour)
+	} else {
+		to = end
+	}
+	if !from.Before(to) {
+		return 0, nil
+	}
+
+	rollups, err := s.rollupRepo.FindRange(ctx, domainID, startOfDay(from), startOfDay(to.Add(-time.Hour)).AddDate(0, 0, 1))
+	if err != nil {
+		return 0, err
+	}
+	sketches := make(map[time.Time][]byte, len(rollups))
+	for _, rollup := range rollups {
+		if !rollup.Imported && len(rollup.VisitorSketch) > 0 {
+			sketches[rollup.Date.UTC()] = rollup.VisitorSketch
+		}
+	}
+
+	// Whole days use their sketch; the hours left over only count while
+	// Redis still has them
+	expired := time.Now().Add(-uniqueHourTTL).Truncate(time.Hour)
+	var keys []string
+	loads := make(map[string][]byte)
+	for hour := from; hour.Before(to); {
+		day := startOfDay(hour)
+		next := day.AddDate(0, 0, 1)
+		if sketch, ok := sketches[day]; ok && hour.Equal(day) && !next.After(to) {
+			key := fmt.Sprintf("uniques:%s:sketch:%s", domainID.Hex(), day.Format("20060102"))
+			loads[key] = sketch
+			keys = append(keys, key)
+			hour = next
+			continue
+		}
+		if !hour.Before(expired) {
+			keys = append(keys, uniqueHourKey(domainID, hour))
+		}
+		hour = hour.Add(time.Hour)
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	// The sketches are loaded in one round trip and counted together in
+	// another
+	if len(loads) > 0 {
+		err := s.cache.Pipelined(ctx, func(pipe cache.Pipe) {
+			for key, sketch := range loads {
+				pipe.Set(key, sketch, sketchTTL)
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return s.cache.PFCount(ctx, keys...)
+}
+
+func uniqueHourKey(domainID primitive.ObjectID, t time.Time) string {
+	return fmt.Sprintf("uniques:%s:%s", domainID.Hex(), t.UTC().Format("2006010215"))
+}
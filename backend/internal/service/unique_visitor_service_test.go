@@ -0,0 +1,215 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nesohq/backend/internal/domain"
+	"github.com/nesohq/backend/internal/infrastructure/cache"
+	"github.com/nesohq/backend/internal/repository/memory"
+	"github.com/nesohq/backend/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type uniqueVisitorFixture struct {
+	uniques *service.UniqueVisitorService
+	rollups *service.RollupService
+	events  *memory.EventRepository
+	cache   *cache.MemoryCache
+}
+
+func newUniqueVisitorFixture() *uniqueVisitorFixture {
+	f := &uniqueVisitorFixture{cache: cache.NewMemoryCache(), events: memory.NewEventRepository()}
+	rollupRepo := memory.NewRollupRepository()
+	f.uniques = service.NewUniqueVisitorService(f.cache, rollupRepo)
+	f.rollups = service.NewRollupService(f.events, rollupRepo, f.uniques)
+	return f
+}
+
+func (f *uniqueVisitorFixture) record(t *testing.T, domainID primitive.ObjectID, at time.Time, visitorIDs ...string) {
+	t.Helper()
+	for _, id := range visitorIDs {
+		if err := f.uniques.Record(context.Background(), domainID, id, at); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+}
+
+func (f *uniqueVisitorFixture) count(t *testing.T, domainID primitive.ObjectID, from, to time.Time) int64 {
+	t.Helper()
+	n, err := f.uniques.Count(context.Background(), domainID, from, to)
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	return n
+}
+
+func TestUniqueVisitorsCountEachVisitorOncePerRange(t *testing.T) {
+	f := newUniqueVisitorFixture()
+	domainID, otherID := primitive.NewObjectID(), primitive.NewObjectID()
+	now := time.Now()
+
+	f.record(t, domainID, now, "v1", "v2", "v1")
+	f.record(t, domainID, now.Add(-3*time.Hour), "v1", "v3")
+	f.record(t, otherID, now, "v4")
+
+	if got := f.count(t, domainID, now.Add(-24*time.Hour), now); got != 3 {
+		t.Errorf("last 24h = %d visitors, want 3", got)
+	}
+	if got := f.count(t, domainID, now.Add(-time.Hour), now); got != 2 {
+		t.Errorf("last hour = %d visitors, want 2", got)
+	}
+	if got := f.count(t, otherID, now.Add(-24*time.Hour), now); got != 1 {
+		t.Errorf("other domain = %d visitors, want 1", got)
+	}
+	// Ranges widen to whole hours
+	if got := f.count(t, domainID, now.Add(-time.Second), now); got != 2 {
+		t.Errorf("current hour = %d visitors, want 2", got)
+	}
+}
+
+func TestUniqueVisitorsOfPastDaysComeFromRollupSketches(t *testing.T) {
+	f := newUniqueVisitorFixture()
+	domainID := primitive.NewObjectID()
+	ctx := context.Background()
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	f.record(t, domainID, day.Add(2*time.Hour), "v1", "v2")
+	f.record(t, domainID, day.Add(20*time.Hour), "v2", "v3")
+	f.record(t, domainID, day.AddDate(0, 0, 1).Add(time.Minute), "v3", "v4")
+
+	if err := f.rollups.BuildDay(ctx, domainID, day); err != nil {
+		t.Fatalf("BuildDay: %v", err)
+	}
+
+	// Expire the day's hours, as Redis would two days on
+	for h := 0; h < 24; h++ {
+		key := "uniques:" + domainID.Hex() + ":" + day.Add(time.Duration(h)*time.Hour).Format("2006010215")
+		if err := f.cache.Del(ctx, key); err != nil {
+			t.Fatalf("Del: %v", err)
+		}
+	}
+
+	if got := f.count(t, domainID, day, day.AddDate(0, 0, 1)); got != 3 {
+		t.Errorf("rolled up day = %d visitors, want 3", got)
+	}
+	if got := f.count(t, domainID, day, day.AddDate(0, 0, 2)); got != 4 {
+		t.Errorf("rolled up day and the next = %d visitors, want 4 (v3 once)", got)
+	}
+
+	// Rebuilding once the hours are gone keeps the saved sketch
+	if err := f.rollups.BuildDay(ctx, domainID, day); err != nil {
+		t.Fatalf("BuildDay: %v", err)
+	}
+	if got := f.count(t, domainID, day, day.AddDate(0, 0, 1)); got != 3 {
+		t.Errorf("rebuilt day = %d visitors, want 3", got)
+	}
+}
+
+func TestErasedVisitorsLeaveTheUniqueVisitorSketches(t *testing.T) {
+	f := newUniqueVisitorFixture()
+	domainID := primitive.NewObjectID()
+	ctx := context.Background()
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	hits := []struct {
+		at      time.Time
+		visitor string
+	}{
+		{day.Add(2 * time.Hour), "v1"},
+		{day.Add(2 * time.Hour), "v2"},
+		{day.Add(20 * time.Hour), "v2"},
+		{day.Add(20 * time.Hour), "v3"},
+	}
+	for _, hit := range hits {
+		event := &domain.Event{ID: primitive.NewObjectID(), DomainID: domainID, VisitorID: hit.visitor, Path: "/", Timestamp: hit.at}
+		if err := f.events.Create(ctx, event); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		f.record(t, domainID, hit.at, hit.visitor)
+	}
+	if err := f.rollups.BuildDay(ctx, domainID, day); err != nil {
+		t.Fatalf("BuildDay: %v", err)
+	}
+
+	erase := func(visitorID string) {
+		t.Helper()
+		if _, err := f.events.DeleteByVisitor(ctx, domainID, visitorID); err != nil {
+			t.Fatalf("DeleteByVisitor: %v", err)
+		}
+		if err := f.rollups.RebuildDays(ctx, domainID, []time.Time{day}); err != nil {
+			t.Fatalf("RebuildDays: %v", err)
+		}
+	}
+
+	erase("v2")
+	if got := f.count(t, domainID, day, day.AddDate(0, 0, 1)); got != 2 {
+		t.Errorf("day after erasing v2 = %d visitors, want 2", got)
+	}
+	if got := f.count(t, domainID, day.Add(20*time.Hour), day.Add(21*time.Hour)); got != 1 {
+		t.Errorf("hour after erasing v2 = %d visitors, want 1", got)
+	}
+
+	// Once the hours have left Redis the sketch is still rebuilt from the
+	// events left
+	for h := 0; h < 24; h++ {
+		key := "uniques:" + domainID.Hex() + ":" + day.Add(time.Duration(h)*time.Hour).Format("2006010215")
+		if err := f.cache.Del(ctx, key); err != nil {
+			t.Fatalf("Del: %v", err)
+		}
+	}
+	erase("v3")
+	if got := f.count(t, domainID, day, day.AddDate(0, 0, 1)); got != 1 {
+		t.Errorf("day after erasing v3 = %d visitors, want 1", got)
+	}
+}
+
+func TestUniqueVisitorsRefuseRangesOverAYear(t *testing.T) {
+	f := newUniqueVisitorFixture()
+	now := time.Now()
+
+	_, err := f.uniques.Count(context.Background(), primitive.NewObjectID(), now.AddDate(-2, 0, 0), now)
+	if !errors.Is(err, service.ErrRangeTooLong) {
+		t.Errorf("Count over two years: error = %v, want ErrRangeTooLong", err)
+	}
+	if got := f.count(t, primitive.NewObjectID(), now.Add(-366*24*time.Hour), now); got != 0 {
+		t.Errorf("366 days = %d visitors, want 0", got)
+	}
+}
+
+// interleavingCache runs between once, right after the first PFMerge, to
+// stand in for another process building a sketch at the same moment.
+type interleavingCache struct {
+	cache.Cache
+	between func()
+}
+
+func (c *interleavingCache) PFMerge(ctx context.Context, dest string, keys ...string) error {
+	err := c.Cache.PFMerge(ctx, dest, keys...)
+	if between := c.between; between != nil {
+		c.between = nil
+		between()
+	}
+	return err
+}
+
+func TestUniqueVisitorDaySketchesCanBeBuiltConcurrently(t *testing.T) {
+	f := newUniqueVisitorFixture()
+	domainID := primitive.NewObjectID()
+	yesterday := time.Now().UTC().Truncate(24 * time.Hour).Add(-12 * time.Hour)
+	f.record(t, domainID, yesterday, "v1", "v2")
+
+	// A rollup and an erasure may build the same day at once
+	interleaved := &interleavingCache{Cache: f.cache}
+	uniques := service.NewUniqueVisitorService(interleaved, memory.NewRollupRepository())
+	interleaved.between = func() {
+		if sketch, err := uniques.DaySketch(context.Background(), domainID, yesterday); err != nil || sketch == nil {
+			t.Errorf("inner DaySketch = %d bytes, %v, want a sketch", len(sketch), err)
+		}
+	}
+	if sketch, err := uniques.DaySketch(context.Background(), domainID, yesterday); err != nil || sketch == nil {
+		t.Errorf("outer DaySketch = %d bytes, %v, want a sketch", len(sketch), err)
+	}
+}
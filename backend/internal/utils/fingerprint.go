@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+var digitsPattern = regexp.MustCompile(`\d+`)
+
+// FingerprintError derives a stable grouping key for a client-side error.
+// Numbers are stripped from the message so that errors like "index 3 out of
+// range" and "index 7 out of range" land in the same issue, and only the top
+// stack frame is used since deeper frames vary with the call site.
+func FingerprintError(message, source, stack string) string {
+	normalized := digitsPattern.ReplaceAllString(strings.TrimSpace(message), "?")
+
+	topFrame := ""
+	for _, line := range strings.Split(stack, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "at ") || strings.Contains(line, "@") {
+			topFrame = digitsPattern.ReplaceAllString(line, "?")
+			break
+		}
+	}
+
+	hash := sha256.Sum256([]byte(normalized + "|" + source + "|" + topFrame))
+	return hex.EncodeToString(hash[:16])
+}
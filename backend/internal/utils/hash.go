@@ -1,10 +1,12 @@
 package utils
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -24,6 +26,22 @@ func HashIP(ip string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// CookielessVisitorID derives an anonymous visitor id that is stable for the
+// lifetime of salt. Once the salt is discarded the id cannot be recomputed or
+// linked to ids issued under any other salt.
+func CookielessVisitorID(salt, domainID, ip, userAgent string) string {
+	hash := sha256.Sum256([]byte(salt + "|" + domainID + "|" + ip + "|" + userAgent))
+	return fmt.Sprintf("c_%s", hex.EncodeToString(hash[:12]))
+}
+
+func GenerateSalt() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
 func GenerateAPIKey() (string, error) {
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
@@ -31,3 +49,22 @@ func GenerateAPIKey() (string, error) {
 	}
 	return fmt.Sprintf("hrd_%s", hex.EncodeToString(bytes)), nil
 }
+
+func GenerateWebhookSecret() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("whsec_%s", hex.EncodeToString(bytes)), nil
+}
+
+// SignWebhook returns the signature header for a webhook body sent at
+// timestamp: "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". The
+// timestamp is signed too, so receivers can reject replayed deliveries.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	t := timestamp.Unix()
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", t)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
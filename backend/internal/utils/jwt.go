@@ -14,12 +14,12 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID primitive.ObjectID, email, secret string) (string, error) {
+func GenerateToken(userID primitive.ObjectID, email, secret string, ttl time.Duration) (string, error) {
 	claims := &Claims{
 		UserID: userID.Hex(),
 		Email:  email,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -28,12 +28,12 @@ func GenerateToken(userID primitive.ObjectID, email, secret string) (string, err
 	return token.SignedString([]byte(secret))
 }
 
-func GenerateRefreshToken(userID primitive.ObjectID, email, secret string) (string, error) {
+func GenerateRefreshToken(userID primitive.ObjectID, email, secret string, ttl time.Duration) (string, error) {
 	claims := &Claims{
 		UserID: userID.Hex(),
 		Email:  email,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -0,0 +1,26 @@
+// Package version reports which build is running.
+package version
+
+import "runtime/debug"
+
+// Version is set at build time with
+// -ldflags "-X github.com/nesohq/backend/internal/version.Version=v1.2.3".
+var Version = "dev"
+
+// String returns Version, falling back to the VCS revision Go embeds in the
+// binary when no version was set.
+func String() string {
+	if Version != "dev" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return "dev-" + setting.Value[:12]
+		}
+	}
+	return Version
+}
@@ -21,6 +21,8 @@
     })(),
     apiKey: null,
     visitorId: null,
+    cookieless: false,
+    consent: null,
   };
 
   // Generate or retrieve visitor ID
@@ -33,6 +35,36 @@
     return visitorId;
   }
 
+  // Remember where the session started so purchases can be attributed
+  function getAttribution() {
+    if (config.cookieless || config.consent === false) {
+      const params = new URLSearchParams(window.location.search);
+      return {
+        referrer: document.referrer,
+        source: params.get('utm_source') || '',
+        campaign: params.get('utm_campaign') || '',
+        landing_page: '',
+      };
+    }
+
+    let attribution = null;
+    try {
+      attribution = JSON.parse(sessionStorage.getItem('hrd_attribution'));
+    } catch (e) {}
+
+    if (!attribution) {
+      const params = new URLSearchParams(window.location.search);
+      attribution = {
+        referrer: document.referrer,
+        source: params.get('utm_source') || '',
+        campaign: params.get('utm_campaign') || '',
+        landing_page: window.location.pathname,
+      };
+      sessionStorage.setItem('hrd_attribution', JSON.stringify(attribution));
+    }
+    return attribution;
+  }
+
   // Track page view
   function track(data) {
     if (!config.apiKey) {
@@ -46,6 +78,9 @@
       user_agent: navigator.userAgent,
       visitor_id: config.visitorId,
     };
+    if (config.consent !== null) {
+      payload.consent = config.consent;
+    }
 
     // Use fetch with API key header
     fetch(config.apiUrl, {
@@ -68,6 +103,69 @@
     .catch(err => console.error('Krakens tracking error:', err));
   }
 
+  // Report a JavaScript error
+  function trackError(data) {
+    if (!config.apiKey) {
+      return;
+    }
+
+    const payload = {
+      message: String(data.message || 'Unknown error'),
+      source: data.source || '',
+      line: data.line || 0,
+      column: data.column || 0,
+      stack: data.stack || '',
+      path: window.location.pathname,
+      visitor_id: config.visitorId,
+    };
+
+    fetch(config.apiUrl + '/error', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        'X-API-Key': config.apiKey,
+      },
+      body: JSON.stringify(payload),
+      keepalive: true,
+    }).catch(() => {});
+  }
+
+  // Track a completed order
+  function trackPurchase(order) {
+    if (!config.apiKey) {
+      console.error('Krakens: API key not set');
+      return;
+    }
+
+    const attribution = getAttribution();
+    const payload = {
+      order_id: String(order.orderId),
+      currency: order.currency,
+      total: order.total || 0,
+      items: (order.items || []).map(item => ({
+        sku: String(item.sku),
+        name: item.name || '',
+        quantity: item.quantity || 1,
+        price: item.price || 0,
+      })),
+      visitor_id: config.visitorId,
+      referrer: attribution.referrer,
+      source: attribution.source,
+      campaign: attribution.campaign,
+      landing_page: attribution.landing_page,
+    };
+
+    fetch(config.apiUrl + '/purchase', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        'X-API-Key': config.apiKey,
+      },
+      body: JSON.stringify(payload),
+      keepalive: true,
+    }).catch(err => console.error('Krakens purchase tracking error:', err));
+  }
+
   // Initialize
   function init(apiKey, options = {}) {
     if (!apiKey) {
@@ -76,7 +174,18 @@
     }
 
     config.apiKey = apiKey;
-    config.visitorId = getVisitorId();
+    config.cookieless = !!options.cookieless;
+    if (options.requireConsent) {
+      config.consent = false;
+    }
+
+    // In cookieless mode nothing is written to the browser; the server
+    // derives an anonymous daily visitor id instead. Sites that require
+    // consent wait for setConsent(true) before storing anything.
+    if (!config.cookieless && config.consent !== false) {
+      config.visitorId = getVisitorId();
+      getAttribution();
+    }
     
     if (options.apiUrl) {
       config.apiUrl = options.apiUrl;
@@ -90,6 +199,24 @@
     // Track initial page view
     track({});
 
+    // Capture uncaught errors and unhandled promise rejections
+    window.addEventListener('error', (event) => {
+      trackError({
+        message: event.message,
+        source: event.filename,
+        line: event.lineno,
+        column: event.colno,
+        stack: event.error && event.error.stack,
+      });
+    });
+    window.addEventListener('unhandledrejection', (event) => {
+      const reason = event.reason || {};
+      trackError({
+        message: reason.message || reason,
+        stack: reason.stack,
+      });
+    });
+
     // Track page changes for SPAs
     let lastPath = window.location.pathname;
     setInterval(() => {
@@ -100,9 +227,21 @@
     }, 500);
   }
 
+  // Record the visitor's consent decision
+  function setConsent(granted) {
+    config.consent = !!granted;
+    if (config.consent && !config.cookieless && !config.visitorId) {
+      config.visitorId = getVisitorId();
+      getAttribution();
+    }
+  }
+
   // Expose API
   window.Krakens = {
     init: init,
     track: track,
+    trackError: trackError,
+    trackPurchase: trackPurchase,
+    setConsent: setConsent,
   };
 })();
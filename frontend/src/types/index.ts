@@ -22,6 +22,9 @@ export interface DomainSettings {
   track_query_params: boolean;
   session_timeout: number;
   timezone: string;
+  cookieless: boolean;
+  privacy_signal_policy: 'track' | 'anonymous' | 'drop';
+  retention_days: number;
 }
 
 export interface APIKey {